@@ -5,8 +5,11 @@ import (
 	"io"
 	"time"
 
+	"filippo.io/age"
 	"github.com/deepsquare-io/cfctl/analytics"
 	"github.com/deepsquare-io/cfctl/phase"
+	"github.com/deepsquare-io/cfctl/pkg/backup"
+	"github.com/deepsquare-io/cfctl/pkg/notify"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -22,8 +25,24 @@ type Apply struct {
 	NoWait bool
 	// NoDrain skips draining worker nodes
 	NoDrain bool
+	// Canary is the number of workers upgraded and health checked before the others
+	Canary int
+	// PauseAfterCanary waits for a confirmation after the upgrade of the canaries
+	PauseAfterCanary bool
+	// ResumeFile resumes the upgrade paused after the canaries when created
+	ResumeFile string
+	// AllowSkip upgrades across several k0s minor versions at once
+	AllowSkip bool
+	// UpgradeIndex lists the k0s versions of the upgrade path, the github releases are used when empty
+	UpgradeIndex string
 	// RestoreFrom is the path to a cluster backup archive to restore the state from
 	RestoreFrom string
+	// AgeIdentities decrypt the age encrypted backup archives
+	AgeIdentities []age.Identity
+	// AllowVersionMismatch restores an archive taken with an incompatible version of k0s
+	AllowVersionMismatch bool
+	// UpgradeBackup stores a backup taken before upgrading the controllers, no backup is taken when nil
+	UpgradeBackup backup.Destination
 	// KubeconfigOut is a writer to write the kubeconfig to
 	KubeconfigOut io.Writer
 	// KubeconfigAPIAddress is the API address to use in the kubeconfig
@@ -38,6 +57,11 @@ func (a Apply) Run() error {
 
 	lockPhase := &phase.Lock{}
 
+	upgradeWorkers := &phase.UpgradeWorkers{NoDrain: a.NoDrain, Canary: a.Canary}
+	if a.PauseAfterCanary {
+		upgradeWorkers.PauseAfterCanary = pauseAfterCanary(a.ResumeFile)
+	}
+
 	a.Manager.AddPhase(
 		&phase.DefaultK0sVersion{},
 		&phase.Connect{},
@@ -47,8 +71,31 @@ func (a Apply) Run() error {
 		&phase.GatherFacts{},
 		&phase.ValidateHosts{},
 		&phase.GatherK0sFacts{},
+		&phase.ClusterLock{Lock: lockPhase},
+		&phase.Notify{Action: "apply"},
 		&phase.ValidateFacts{SkipDowngradeCheck: a.DisableDowngradeCheck},
+		&phase.ValidateRestore{
+			RestoreFrom:          a.RestoreFrom,
+			AgeIdentities:        a.AgeIdentities,
+			AllowVersionMismatch: a.AllowVersionMismatch,
+		},
+		&phase.PlanUpgrade{
+			AllowSkip:        a.AllowSkip,
+			Index:            a.UpgradeIndex,
+			NoDrain:          a.NoDrain,
+			Canary:           a.Canary,
+			PauseAfterCanary: upgradeWorkers.PauseAfterCanary,
+		},
 		&phase.RunHooks{Stage: "before", Action: "apply"},
+	)
+
+	if a.UpgradeBackup != nil {
+		a.Manager.AddPhase(&phase.UpgradeBackup{Backup: phase.Backup{Destination: a.UpgradeBackup}})
+	}
+
+	a.Manager.AddPhase(
+		// if upgradeStrategy: autopilot
+		&phase.UpgradeAutopilot{},
 
 		// if UploadBinaries: true
 		&phase.DownloadBinaries{}, // downloads k0s binaries to local cache
@@ -63,13 +110,14 @@ func (a Apply) Run() error {
 		&phase.ConfigureK0s{},
 		&phase.UploadFiles{},
 		&phase.Restore{
-			RestoreFrom: a.RestoreFrom,
+			RestoreFrom:   a.RestoreFrom,
+			AgeIdentities: a.AgeIdentities,
 		},
 		&phase.InitializeK0s{},
 		&phase.InstallControllers{},
 		&phase.InstallWorkers{},
 		&phase.UpgradeControllers{},
-		&phase.UpgradeWorkers{NoDrain: a.NoDrain},
+		upgradeWorkers,
 		&phase.ResetWorkers{NoDrain: a.NoDrain},
 		&phase.ResetControllers{NoDrain: a.NoDrain},
 		&phase.RunHooks{Stage: "after", Action: "apply"},
@@ -93,6 +141,7 @@ func (a Apply) Run() error {
 			"apply-failure",
 			map[string]interface{}{"clusterID": a.Manager.Config.Spec.K0s.Metadata.ClusterID},
 		)
+		notifyEvent(a.Manager, "apply", notify.StatusFailure, start, result)
 		log.Info(phase.Colorize.Red("==> Apply failed").String())
 		return result
 	}
@@ -104,6 +153,7 @@ func (a Apply) Run() error {
 			"clusterID": a.Manager.Config.Spec.K0s.Metadata.ClusterID,
 		},
 	)
+	notifyEvent(a.Manager, "apply", notify.StatusSuccess, start, nil)
 	if a.KubeconfigOut != nil {
 		if _, err := a.KubeconfigOut.Write([]byte(a.Manager.Config.Metadata.Kubeconfig)); err != nil {
 			log.Warnf("failed to write kubeconfig to %s: %v", a.KubeconfigOut, err)
@@ -6,6 +6,8 @@ import (
 
 	"github.com/deepsquare-io/cfctl/analytics"
 	"github.com/deepsquare-io/cfctl/phase"
+	"github.com/deepsquare-io/cfctl/pkg/backup"
+	"github.com/deepsquare-io/cfctl/pkg/notify"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -13,6 +15,12 @@ import (
 type Backup struct {
 	// Manager is the phase manager
 	Manager *phase.Manager
+	// Destination stores the archive, defaults to the current directory
+	Destination backup.Destination
+	// Retention prunes the old archives of the destination
+	Retention backup.Retention
+	// Encrypter encrypts the archive when set
+	Encrypter backup.Encrypter
 }
 
 func (b Backup) Run() error {
@@ -27,8 +35,10 @@ func (b Backup) Run() error {
 		&phase.PrepareHosts{},
 		&phase.GatherFacts{},
 		&phase.GatherK0sFacts{},
+		&phase.ClusterLock{Lock: lockPhase},
+		&phase.Notify{Action: "backup"},
 		&phase.RunHooks{Stage: "before", Action: "backup"},
-		&phase.Backup{},
+		&phase.Backup{Destination: b.Destination, Retention: b.Retention, Encrypter: b.Encrypter},
 		&phase.RunHooks{Stage: "after", Action: "backup"},
 		&phase.Unlock{Cancel: lockPhase.Cancel},
 		&phase.Disconnect{},
@@ -41,6 +51,7 @@ func (b Backup) Run() error {
 			"backup-failure",
 			map[string]interface{}{"clusterID": b.Manager.Config.Spec.K0s.Metadata.ClusterID},
 		)
+		notifyEvent(b.Manager, "backup", notify.StatusFailure, start, err)
 		return err
 	}
 
@@ -51,6 +62,7 @@ func (b Backup) Run() error {
 			"clusterID": b.Manager.Config.Spec.K0s.Metadata.ClusterID,
 		},
 	)
+	notifyEvent(b.Manager, "backup", notify.StatusSuccess, start, nil)
 
 	duration := time.Since(start).Truncate(time.Second)
 	text := fmt.Sprintf("==> Finished in %s", duration)
@@ -0,0 +1,88 @@
+package action
+
+import (
+	"io"
+
+	"github.com/deepsquare-io/cfctl/analytics"
+	"github.com/deepsquare-io/cfctl/phase"
+	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1/cluster"
+	"github.com/deepsquare-io/cfctl/pkg/backup"
+	"github.com/deepsquare-io/cfctl/pkg/cron"
+)
+
+// BackupSchedule manages the scheduled backups of the controllers
+type BackupSchedule struct {
+	// Manager is the phase manager
+	Manager *phase.Manager
+	// Schedule is the cron schedule of the backups
+	Schedule cron.Schedule
+	// Destination receives the archives
+	Destination backup.Destination
+	// Retention prunes the old archives of the destination
+	Retention backup.Retention
+	// Encrypter encrypts the archives when set
+	Encrypter backup.Encrypter
+	// UploadIdentity allows copying the private key of a sftp destination to the controllers
+	UploadIdentity bool
+}
+
+// Install installs the backup script and its timer on the controllers
+func (b BackupSchedule) Install() error {
+	lockPhase := &phase.Lock{}
+
+	b.Manager.AddPhase(
+		&phase.Connect{},
+		&phase.DetectOS{},
+		lockPhase,
+		&phase.PrepareHosts{},
+		&phase.GatherFacts{},
+		&phase.GatherK0sFacts{},
+		&phase.ClusterLock{Lock: lockPhase},
+		&phase.InstallBackupSchedule{
+			Schedule:       b.Schedule,
+			Destination:    b.Destination,
+			Retention:      b.Retention,
+			Encrypter:      b.Encrypter,
+			UploadIdentity: b.UploadIdentity,
+		},
+		&phase.Unlock{Cancel: lockPhase.Cancel},
+		&phase.Disconnect{},
+	)
+
+	analytics.Client.Publish("backup-schedule-install", map[string]interface{}{})
+
+	return b.Manager.Run()
+}
+
+// Status prints the state of the backup schedule of the controllers
+func (b BackupSchedule) Status(w io.Writer) error {
+	b.controllersOnly()
+	b.Manager.AddPhase(
+		&phase.Connect{},
+		&phase.DetectOS{},
+		&phase.BackupScheduleStatus{Writer: w},
+		&phase.Disconnect{},
+	)
+
+	return b.Manager.Run()
+}
+
+// Remove removes the backup script and its timer from the controllers
+func (b BackupSchedule) Remove() error {
+	b.controllersOnly()
+	b.Manager.AddPhase(
+		&phase.Connect{},
+		&phase.DetectOS{},
+		&phase.RemoveBackupSchedule{},
+		&phase.Disconnect{},
+	)
+
+	analytics.Client.Publish("backup-schedule-remove", map[string]interface{}{})
+
+	return b.Manager.Run()
+}
+
+// controllersOnly avoids connecting to the workers
+func (b BackupSchedule) controllersOnly() {
+	b.Manager.Config.Spec.Hosts = cluster.Hosts(b.Manager.Config.Spec.Hosts.Controllers())
+}
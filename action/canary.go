@@ -0,0 +1,67 @@
+package action
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1/cluster"
+	"github.com/mattn/go-isatty"
+	log "github.com/sirupsen/logrus"
+)
+
+// resumePollInterval is how often the resume file is looked for
+var resumePollInterval = time.Second
+
+// pauseAfterCanary returns a function waiting for a confirmation on a
+// terminal, or else for the resume file to be created, before the upgrade
+// goes on. The upgrade stops when not confirmed or when the resume file
+// holds "abort".
+func pauseAfterCanary(resumeFile string) func(cluster.Hosts, int) error {
+	return func(canaries cluster.Hosts, remaining int) error {
+		if isatty.IsTerminal(os.Stdin.Fd()) {
+			confirmed := false
+			prompt := &survey.Confirm{
+				Message: fmt.Sprintf("The canary workers %s were upgraded, upgrade the remaining %d workers?", canaries, remaining),
+			}
+			if err := survey.AskOne(prompt, &confirmed); err != nil {
+				return err
+			}
+			if !confirmed {
+				return errors.New("not confirmed")
+			}
+			return nil
+		}
+
+		if err := os.Remove(resumeFile); err == nil {
+			log.Debugf("removed the stale resume file %s", resumeFile)
+		}
+		log.Warnf("The canary workers %s were upgraded, create %s to upgrade the remaining %d workers or write \"abort\" into it to stop", canaries, resumeFile, remaining)
+		return waitResumeFile(resumeFile)
+	}
+}
+
+// waitResumeFile waits for the resume file, removes it and returns an error
+// when it holds "abort"
+func waitResumeFile(path string) error {
+	for {
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			time.Sleep(resumePollInterval)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("read resume file: %w", err)
+		}
+		if err := os.Remove(path); err != nil {
+			log.Warnf("failed to remove the resume file %s: %s", path, err)
+		}
+		if strings.TrimSpace(string(data)) == "abort" {
+			return errors.New("aborted")
+		}
+		return nil
+	}
+}
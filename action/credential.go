@@ -0,0 +1,85 @@
+package action
+
+import (
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/deepsquare-io/cfctl/phase"
+	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1/cluster"
+	"github.com/deepsquare-io/cfctl/pkg/kubeconfig"
+	log "github.com/sirupsen/logrus"
+)
+
+// CredentialRenewBefore is how long before its expiry a cached credential is renewed
+const CredentialRenewBefore = 5 * time.Minute
+
+// Credential prints the ExecCredential of a short-lived client certificate
+// signed by the cluster, for kubeconfigs using cfctl as exec credential plugin
+type Credential struct {
+	// Manager is the phase manager
+	Manager *phase.Manager
+	Stdout  io.Writer
+
+	User   string
+	Groups []string
+	// Expiry is the validity of the certificate
+	Expiry time.Duration
+	// CacheFile keeps the credential until it is about to expire when set
+	CacheFile string
+}
+
+func (c Credential) Run() error {
+	if c.CacheFile != "" {
+		cached, err := kubeconfig.ReadExecCredential(c.CacheFile)
+		switch {
+		case err == nil && cached.ValidFor(CredentialRenewBefore):
+			log.Debugf("using the cached credential %s", c.CacheFile)
+			return c.print(cached)
+		case err != nil && !errors.Is(err, os.ErrNotExist):
+			log.Warnf("ignoring the cached credential: %s", err)
+		}
+	}
+
+	c.Manager.Config.Spec.Hosts = cluster.Hosts{c.Manager.Config.Spec.K0sLeader()}
+
+	sign := &phase.SignUserCertificate{
+		User:   c.User,
+		Groups: c.Groups,
+		Expiry: c.Expiry,
+	}
+	c.Manager.AddPhase(
+		&phase.Connect{},
+		&phase.DetectOS{},
+		sign,
+		&phase.Disconnect{},
+	)
+
+	if err := c.Manager.Run(); err != nil {
+		return err
+	}
+	if c.Manager.DryRun {
+		return nil
+	}
+
+	credential, err := kubeconfig.NewExecCredential(sign.Certificate, sign.Key)
+	if err != nil {
+		return err
+	}
+	if c.CacheFile != "" {
+		if err := credential.Save(c.CacheFile); err != nil {
+			log.Warnf("failed to cache the credential: %s", err)
+		}
+	}
+	return c.print(credential)
+}
+
+func (c Credential) print(credential *kubeconfig.ExecCredential) error {
+	data, err := credential.Marshal()
+	if err != nil {
+		return err
+	}
+	_, err = c.Stdout.Write(data)
+	return err
+}
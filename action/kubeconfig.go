@@ -1,8 +1,11 @@
 package action
 
 import (
+	"time"
+
 	"github.com/deepsquare-io/cfctl/phase"
 	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1/cluster"
+	"github.com/deepsquare-io/cfctl/pkg/kubeconfig"
 )
 
 type Kubeconfig struct {
@@ -10,9 +13,31 @@ type Kubeconfig struct {
 	Manager              *phase.Manager
 	KubeconfigAPIAddress string
 
+	// User gets a kubeconfig signed for the user instead of the admin kubeconfig when set
+	User   string
+	Groups []string
+	// Expiry is the validity of the certificate of the user
+	Expiry time.Duration
+	// Role is a cluster role bound to the user, in Namespace or cluster wide
+	Role      string
+	Namespace string
+
+	// ExecCommand and ExecArgs get the credentials of the user from an exec
+	// credential plugin instead of a certificate signed now when set
+	ExecCommand string
+	ExecArgs    []string
+
 	Kubeconfig string
 }
 
+// ContextName returns the name of the context of the kubeconfig
+func (k *Kubeconfig) ContextName() string {
+	if k.User == "" {
+		return k.Manager.Config.Metadata.Name
+	}
+	return k.User + "@" + k.Manager.Config.Metadata.Name
+}
+
 func (k *Kubeconfig) Run() error {
 	// Change so that the internal config has only single controller host as we
 	// do not need to connect to all nodes
@@ -22,8 +47,44 @@ func (k *Kubeconfig) Run() error {
 		&phase.Connect{},
 		&phase.DetectOS{},
 		&phase.GetKubeconfig{APIAddress: k.KubeconfigAPIAddress},
-		&phase.Disconnect{},
 	)
 
-	return k.Manager.Run()
+	var sign *phase.SignUserCertificate
+	if k.User != "" && k.ExecCommand == "" {
+		sign = &phase.SignUserCertificate{
+			User:      k.User,
+			Groups:    k.Groups,
+			Expiry:    k.Expiry,
+			Role:      k.Role,
+			Namespace: k.Namespace,
+		}
+		k.Manager.AddPhase(sign)
+	}
+
+	k.Manager.AddPhase(&phase.Disconnect{})
+
+	if err := k.Manager.Run(); err != nil {
+		return err
+	}
+	if k.Manager.DryRun {
+		return nil
+	}
+
+	admin := []byte(k.Manager.Config.Metadata.Kubeconfig)
+	var cfg []byte
+	var err error
+	switch {
+	case k.ExecCommand != "":
+		cfg, err = kubeconfig.ExecConfig(admin, k.User, k.ContextName(), k.ExecCommand, k.ExecArgs)
+	case sign != nil:
+		cfg, err = kubeconfig.UserConfig(admin, k.User, k.ContextName(), sign.Certificate, sign.Key)
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	k.Manager.Config.Metadata.Kubeconfig = string(cfg)
+
+	return nil
 }
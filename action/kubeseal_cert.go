@@ -0,0 +1,89 @@
+package action
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1"
+	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1/cluster"
+	"github.com/deepsquare-io/cfctl/pkg/kubeseal"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/k0sproject/rig/exec"
+)
+
+// KubesealCertificate fetches the public certificate of the sealed secrets
+// controller through the k0s leader
+type KubesealCertificate struct {
+	Config              *v1beta1.Cluster
+	ControllerName      string
+	ControllerNamespace string
+	Writer              io.Writer
+}
+
+func (k KubesealCertificate) Run() error {
+	h := k.Config.Spec.K0sLeader()
+
+	if err := h.Connect(); err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer h.Disconnect()
+
+	if err := h.ResolveConfigurer(); err != nil {
+		return err
+	}
+
+	cert, err := k.fromService(h)
+	if err != nil {
+		log.Debugf("%s: failed to fetch the certificate from the sealed secrets service, trying the key secret: %v", h, err)
+		cert, err = k.fromSecret(h)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: failed to fetch the sealed secrets certificate: %w", h, err)
+	}
+
+	if _, err := kubeseal.ParseCertificate(cert); err != nil {
+		return fmt.Errorf("%s: invalid sealed secrets certificate: %w", h, err)
+	}
+
+	_, err = k.Writer.Write(cert)
+	return err
+}
+
+// fromService reads the certificate from the /v1/cert.pem endpoint of the controller
+func (k KubesealCertificate) fromService(h *cluster.Host) ([]byte, error) {
+	output, err := h.ExecOutput(
+		h.Configurer.KubectlCmdf(
+			h,
+			h.K0sDataDir(),
+			"get --raw %s",
+			kubeseal.CertificatePath(k.ControllerNamespace, k.ControllerName),
+		),
+		exec.HideOutput(),
+		exec.Sudo(h),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(output + "\n"), nil
+}
+
+// fromSecret reads the certificate of the newest active key of the controller
+func (k KubesealCertificate) fromSecret(h *cluster.Host) ([]byte, error) {
+	output, err := h.ExecOutput(
+		h.Configurer.KubectlCmdf(
+			h,
+			h.K0sDataDir(),
+			"-n %s get secret -l %s -o json",
+			k.ControllerNamespace,
+			kubeseal.KeyLabel,
+		),
+		exec.HideOutput(),
+		exec.Sudo(h),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return kubeseal.CertificateFromSecrets([]byte(output))
+}
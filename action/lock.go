@@ -0,0 +1,40 @@
+package action
+
+import (
+	"io"
+
+	"github.com/deepsquare-io/cfctl/analytics"
+	"github.com/deepsquare-io/cfctl/phase"
+)
+
+// Lock inspects and releases the cfctl lock files of the hosts
+type Lock struct {
+	// Manager is the phase manager
+	Manager *phase.Manager
+}
+
+// Status prints the holders of the lock files of the hosts
+func (l Lock) Status(w io.Writer) error {
+	l.Manager.AddPhase(
+		&phase.Connect{},
+		&phase.DetectOS{},
+		&phase.LockStatus{Writer: w},
+		&phase.Disconnect{},
+	)
+
+	return l.Manager.Run()
+}
+
+// Release removes the expired lock files of the hosts, or all of them when force is set
+func (l Lock) Release(force bool) error {
+	l.Manager.AddPhase(
+		&phase.Connect{},
+		&phase.DetectOS{},
+		&phase.ReleaseLock{Force: force},
+		&phase.Disconnect{},
+	)
+
+	analytics.Client.Publish("lock-release", map[string]interface{}{"force": force})
+
+	return l.Manager.Run()
+}
@@ -0,0 +1,17 @@
+package action
+
+import (
+	"time"
+
+	"github.com/deepsquare-io/cfctl/phase"
+)
+
+// notifyEvent sends the end event of an action to the notification targets
+// of the cluster, the start event is sent by the phase.Notify phase. Nothing
+// is sent in dry-run mode
+func notifyEvent(m *phase.Manager, action, status string, start time.Time, result error) {
+	if m.DryRun {
+		return
+	}
+	phase.SendNotifications(m.Config, action, status, time.Since(start), result)
+}
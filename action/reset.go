@@ -8,6 +8,7 @@ import (
 
 	"github.com/deepsquare-io/cfctl/analytics"
 	"github.com/deepsquare-io/cfctl/phase"
+	"github.com/deepsquare-io/cfctl/pkg/notify"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/AlecAivazis/survey/v2"
@@ -43,13 +44,17 @@ func (r Reset) Run() error {
 	}
 
 	lockPhase := &phase.Lock{}
+	clusterLockPhase := &phase.ClusterLock{Lock: lockPhase}
 	r.Manager.AddPhase(
 		&phase.Connect{},
 		&phase.DetectOS{},
 		lockPhase,
 		&phase.PrepareHosts{},
 		&phase.GatherK0sFacts{},
+		clusterLockPhase,
+		&phase.Notify{Action: "reset"},
 		&phase.RunHooks{Stage: "before", Action: "reset"},
+		&phase.ReleaseClusterLock{ClusterLock: clusterLockPhase},
 		&phase.ResetWorkers{
 			NoDrain:  true,
 			NoDelete: true,
@@ -72,6 +77,7 @@ func (r Reset) Run() error {
 			"reset-failure",
 			map[string]interface{}{"clusterID": r.Manager.Config.Spec.K0s.Metadata.ClusterID},
 		)
+		notifyEvent(r.Manager, "reset", notify.StatusFailure, start, err)
 		return err
 	}
 
@@ -82,6 +88,7 @@ func (r Reset) Run() error {
 			"clusterID": r.Manager.Config.Spec.K0s.Metadata.ClusterID,
 		},
 	)
+	notifyEvent(r.Manager, "reset", notify.StatusSuccess, start, nil)
 
 	duration := time.Since(start).Truncate(time.Second)
 	text := fmt.Sprintf("==> Finished in %s", duration)
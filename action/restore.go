@@ -0,0 +1,151 @@
+package action
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"filippo.io/age"
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/deepsquare-io/cfctl/analytics"
+	"github.com/deepsquare-io/cfctl/phase"
+	"github.com/mattn/go-isatty"
+	log "github.com/sirupsen/logrus"
+)
+
+// Restore rebuilds a cluster from a backup archive: the leader is restored
+// and started, then the other controllers and the workers join it
+type Restore struct {
+	// Manager is the phase manager
+	Manager *phase.Manager
+	Stdout  io.Writer
+	// RestoreFrom is the path to the backup archive
+	RestoreFrom string
+	// AgeIdentities decrypt the age encrypted backup archives
+	AgeIdentities []age.Identity
+	// Reset wipes the hosts running k0s or holding the state of a previous
+	// cluster instead of refusing to restore onto them
+	Reset bool
+	// Force skips the confirmation of Reset
+	Force bool
+	// AllowVersionMismatch restores an archive taken with an incompatible version of k0s
+	AllowVersionMismatch bool
+}
+
+func (r Restore) Run() error {
+	if r.RestoreFrom == "" {
+		return fmt.Errorf("no backup archive given")
+	}
+
+	if r.Reset && !r.Force && !r.Manager.DryRun {
+		if stdoutFile, ok := r.Stdout.(*os.File); ok && !isatty.IsTerminal(stdoutFile.Fd()) {
+			return fmt.Errorf("restore with --reset requires --force")
+		}
+		confirmed := false
+		prompt := &survey.Confirm{
+			Message: "Going to reset the hosts running k0s, which will destroy their configuration and data, Are you sure?",
+		}
+		_ = survey.AskOne(prompt, &confirmed)
+		if !confirmed {
+			return fmt.Errorf("confirmation or --force required to proceed")
+		}
+	}
+
+	start := time.Now()
+
+	phase.Force = r.Force
+
+	lockPhase := &phase.Lock{}
+	clusterLockPhase := &phase.ClusterLock{Lock: lockPhase}
+
+	r.Manager.AddPhase(
+		&phase.DefaultK0sVersion{},
+		&phase.Connect{},
+		&phase.DetectOS{},
+		lockPhase,
+		&phase.PrepareHosts{},
+		&phase.GatherFacts{},
+		&phase.ValidateHosts{},
+		&phase.GatherK0sFacts{},
+		clusterLockPhase,
+		&phase.ValidateRestoreTarget{Reset: r.Reset},
+		&phase.ValidateRestore{
+			RestoreFrom:          r.RestoreFrom,
+			AgeIdentities:        r.AgeIdentities,
+			AllowVersionMismatch: r.AllowVersionMismatch,
+		},
+		&phase.RunHooks{Stage: "before", Action: "restore"},
+
+		// if --reset: wipe the hosts running k0s
+		&phase.ReleaseClusterLock{ClusterLock: clusterLockPhase},
+		&phase.ResetWorkers{
+			NoDrain:  true,
+			NoDelete: true,
+		},
+		&phase.ResetControllers{
+			NoDrain:  true,
+			NoDelete: true,
+			NoLeave:  true,
+		},
+		&phase.ResetLeader{},
+		&phase.RejoinResetHosts{},
+
+		&phase.DownloadBinaries{},
+		&phase.UploadK0s{},
+		&phase.DownloadK0s{},
+		&phase.DownloadCNI{},
+		&phase.SymlinkKubelet{},
+		&phase.InstallBinaries{},
+		&phase.PrepareArm{},
+		&phase.ConfigureK0s{},
+		&phase.UploadFiles{},
+		&phase.Restore{
+			RestoreFrom:   r.RestoreFrom,
+			AgeIdentities: r.AgeIdentities,
+		},
+		&phase.InitializeK0s{},
+		&phase.InstallControllers{},
+		&phase.InstallWorkers{},
+		&phase.RunHooks{Stage: "after", Action: "restore"},
+		&phase.Unlock{Cancel: lockPhase.Cancel},
+		&phase.Disconnect{},
+	)
+
+	analytics.Client.Publish("restore-start", map[string]interface{}{})
+
+	if err := r.Manager.Run(); err != nil {
+		analytics.Client.Publish(
+			"restore-failure",
+			map[string]interface{}{"clusterID": r.Manager.Config.Spec.K0s.Metadata.ClusterID},
+		)
+		log.Info(phase.Colorize.Red("==> Restore failed").String())
+		return err
+	}
+
+	analytics.Client.Publish(
+		"restore-success",
+		map[string]interface{}{
+			"duration":  time.Since(start),
+			"clusterID": r.Manager.Config.Spec.K0s.Metadata.ClusterID,
+		},
+	)
+
+	if r.Manager.DryRun {
+		return nil
+	}
+
+	duration := time.Since(start).Truncate(time.Second)
+	text := fmt.Sprintf("==> Finished in %s", duration)
+	log.Infof(phase.Colorize.Green(text).String())
+
+	log.Infof(
+		"Cluster restored from %s onto %s with %d controllers and %d workers",
+		r.RestoreFrom,
+		r.Manager.Config.Spec.K0sLeader(),
+		len(r.Manager.Config.Spec.Hosts.Controllers()),
+		len(r.Manager.Config.Spec.Hosts.Workers()),
+	)
+
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/deepsquare-io/cfctl/action"
 	"github.com/deepsquare-io/cfctl/phase"
+	"github.com/deepsquare-io/cfctl/pkg/backup"
 
 	"github.com/urfave/cli/v2"
 )
@@ -27,11 +28,46 @@ var applyCommand = &cli.Command{
 			Name:  "no-drain",
 			Usage: "Do not drain worker nodes when upgrading",
 		},
+		&cli.IntFlag{
+			Name:  "canary",
+			Usage: "Upgrade and health check N workers before the others",
+		},
+		&cli.BoolFlag{
+			Name:  "allow-skip",
+			Usage: "Upgrade across several k0s minor versions at once instead of through every minor version in between",
+		},
+		&cli.StringFlag{
+			Name:    "upgrade-index",
+			Usage:   "Local file or url of a mirror listing the k0s versions to plan upgrades with, one per line (default: the k0s releases on github)",
+			EnvVars: []string{"CFCTL_UPGRADE_INDEX"},
+		},
+		&cli.BoolFlag{
+			Name:  "pause-after-canary",
+			Usage: "Wait for a confirmation, or for the --resume-file without a terminal, after upgrading the canary workers",
+		},
+		&cli.StringFlag{
+			Name:      "resume-file",
+			Usage:     "File to create to resume the upgrade paused after the canary workers, or to write \"abort\" into to stop it",
+			Value:     "cfctl-upgrade.resume",
+			TakesFile: true,
+		},
 		&cli.StringFlag{
 			Name:      "restore-from",
-			Usage:     "Path to cluster backup archive to restore the state from",
+			Usage:     "Path to cluster backup archive to restore the state from, verified with its manifest and decrypted when encrypted",
 			TakesFile: true,
 		},
+		ageIdentityFlag,
+		allowVersionMismatchFlag,
+		&cli.StringFlag{
+			Name:    "upgrade-backup-to",
+			Usage:   "Destination of the backup taken before upgrading the controllers: a local directory, s3://bucket/prefix or sftp://user@host/path",
+			Value:   ".",
+			EnvVars: []string{"CFCTL_UPGRADE_BACKUP_DESTINATION"},
+		},
+		&cli.BoolFlag{
+			Name:  "no-upgrade-backup",
+			Usage: "Do not take a backup before upgrading the controllers",
+		},
 		&cli.StringFlag{
 			Name:      "kubeconfig-out",
 			Usage:     "Write kubeconfig to given path after a successful apply",
@@ -81,15 +117,46 @@ var applyCommand = &cli.Command{
 			kubeconfigOut = out
 		}
 
+		if ctx.Int("canary") < 0 {
+			return fmt.Errorf("--canary can not be negative")
+		}
+		if ctx.Bool("pause-after-canary") && ctx.Int("canary") == 0 {
+			return fmt.Errorf("--pause-after-canary needs --canary")
+		}
+		manager := ctx.Context.Value(ctxManagerKey{}).(*phase.Manager)
+		if ctx.Int("canary") > 0 && manager.Config.Spec.K0s.IsAutopilot() {
+			return fmt.Errorf("--canary is not supported with the autopilot upgrade strategy")
+		}
+
+		identities, err := ageIdentities(ctx)
+		if err != nil {
+			return err
+		}
+
+		var upgradeBackup backup.Destination
+		if !ctx.Bool("no-upgrade-backup") {
+			if upgradeBackup, err = backup.ParseDestination(ctx.String("upgrade-backup-to")); err != nil {
+				return fmt.Errorf("--upgrade-backup-to: %w", err)
+			}
+		}
+
 		applyAction := action.Apply{
 			Force:                 ctx.Bool("force"),
-			Manager:               ctx.Context.Value(ctxManagerKey{}).(*phase.Manager),
+			Manager:               manager,
 			KubeconfigOut:         kubeconfigOut,
 			KubeconfigAPIAddress:  ctx.String("kubeconfig-api-address"),
 			NoWait:                ctx.Bool("no-wait"),
 			NoDrain:               ctx.Bool("no-drain"),
+			Canary:                ctx.Int("canary"),
+			PauseAfterCanary:      ctx.Bool("pause-after-canary"),
+			ResumeFile:            ctx.String("resume-file"),
+			AllowSkip:             ctx.Bool("allow-skip"),
+			UpgradeIndex:          ctx.String("upgrade-index"),
 			DisableDowngradeCheck: ctx.Bool("disable-downgrade-check"),
 			RestoreFrom:           ctx.String("restore-from"),
+			AgeIdentities:         identities,
+			AllowVersionMismatch:  ctx.Bool("allow-version-mismatch"),
+			UpgradeBackup:         upgradeBackup,
 		}
 
 		if err := applyAction.Run(); err != nil {
@@ -5,12 +5,47 @@ import (
 
 	"github.com/deepsquare-io/cfctl/action"
 	"github.com/deepsquare-io/cfctl/phase"
+	"github.com/deepsquare-io/cfctl/pkg/backup"
 	"github.com/urfave/cli/v2"
 )
 
 var backupCommand = &cli.Command{
 	Name:  "backup",
 	Usage: "Take backup of existing clusters state",
+	Description: `Take a backup on the k0s leader and stream it to the --to destination:
+a local directory (default: the current directory), "s3://bucket/prefix" or
+"sftp://user@host:port/path".
+
+S3 destinations use the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY credentials.
+Any S3 compatible store can be used by setting its URL in AWS_ENDPOINT_URL or
+in the "endpoint" query parameter, such as
+"s3://backups/cluster?endpoint=http://minio.local:9000".
+
+SFTP destinations authenticate with the ssh agent or the default ssh keys and
+verify the server with ~/.ssh/known_hosts.
+
+With --keep and --keep-within, the archives of the destination that are not
+among the N newest or younger than the duration are deleted.
+
+With --encrypt-to, the archive is encrypted for age public keys ("age1...")
+or with gpg for GPG key IDs, fingerprints or emails. The GPG keys must be
+trusted in the keyring, gpg refuses to encrypt to unverified keys. A
+manifest holding the sha256 of the archive, the k0s version, the cluster ID
+and the controller is written next to every archive. "cfctl restore" and
+"cfctl apply --restore-from" verify the archive with its manifest and
+decrypt it, age archives with the identity file given with --age-identity
+and gpg archives with the keys of the gpg agent.
+
+"cfctl backup ls" lists the archives of a destination and "cfctl backup
+inspect" shows the contents of an archive. Archives taken with another minor
+version of k0s or a newer one are not restored, unless --force is given.
+
+"cfctl backup schedule" installs scheduled backups on the leader controller.`,
+	Subcommands: []*cli.Command{
+		backupScheduleCommand,
+		backupLsCommand,
+		backupInspectCommand,
+	},
 	Flags: []cli.Flag{
 		configFlag,
 		dryRunFlag,
@@ -22,20 +57,42 @@ var backupCommand = &cli.Command{
 		retryTimeoutFlag,
 		analyticsFlag,
 		upgradeCheckFlag,
+		&cli.StringFlag{
+			Name:    "to",
+			Usage:   "Backup destination: a local directory, s3://bucket/prefix or sftp://user@host/path",
+			Value:   ".",
+			EnvVars: []string{"CFCTL_BACKUP_DESTINATION"},
+		},
+		encryptToFlag,
+		keepFlag,
+		keepWithinFlag,
 	},
 	Before: actions(
 		initLogging,
 		startCheckUpgrade,
-		initConfig,
-		initManager,
-		displayLogo,
-		initAnalytics,
-		displayCopyright,
+		unlessSubcommand(initConfig, initManager, displayLogo, initAnalytics, displayCopyright),
 	),
 	After: actions(reportCheckUpgrade, closeAnalytics),
 	Action: func(ctx *cli.Context) error {
+		destination, err := backup.ParseDestination(ctx.String("to"))
+		if err != nil {
+			return err
+		}
+
+		retention, err := backupRetention(ctx)
+		if err != nil {
+			return err
+		}
+		encrypter, err := backupEncrypter(ctx)
+		if err != nil {
+			return err
+		}
+
 		backupAction := action.Backup{
-			Manager: ctx.Context.Value(ctxManagerKey{}).(*phase.Manager),
+			Manager:     ctx.Context.Value(ctxManagerKey{}).(*phase.Manager),
+			Destination: destination,
+			Retention:   retention,
+			Encrypter:   encrypter,
 		}
 
 		if err := backupAction.Run(); err != nil {
@@ -49,3 +106,44 @@ var backupCommand = &cli.Command{
 		return nil
 	},
 }
+
+var (
+	encryptToFlag = &cli.StringSliceFlag{
+		Name:    "encrypt-to",
+		Usage:   "Encrypt the archive for an age public key (age1...) or a GPG key ID, fingerprint or email, can be repeated",
+		EnvVars: []string{"CFCTL_BACKUP_RECIPIENTS"},
+	}
+	keepFlag = &cli.IntFlag{
+		Name:  "keep",
+		Usage: "Keep the N newest backups of the destination and delete the others",
+	}
+	keepWithinFlag = &cli.StringFlag{
+		Name:  "keep-within",
+		Usage: "Keep the backups of the destination younger than a duration such as 30d, 2w or 12h and delete the others",
+	}
+)
+
+// backupRetention returns the retention policy of the keep and keep-within flags
+func backupRetention(ctx *cli.Context) (backup.Retention, error) {
+	retention := backup.Retention{Keep: ctx.Int("keep")}
+	if d := ctx.String("keep-within"); d != "" {
+		var err error
+		if retention.KeepWithin, err = backup.ParseDuration(d); err != nil {
+			return retention, fmt.Errorf("--keep-within: %w", err)
+		}
+	}
+	return retention, nil
+}
+
+// backupEncrypter returns the encrypter of the encrypt-to flag, nil without recipients
+func backupEncrypter(ctx *cli.Context) (backup.Encrypter, error) {
+	recipients := ctx.StringSlice("encrypt-to")
+	if len(recipients) == 0 {
+		return nil, nil
+	}
+	encrypter, err := backup.NewEncrypter(recipients)
+	if err != nil {
+		return nil, fmt.Errorf("--encrypt-to: %w", err)
+	}
+	return encrypter, nil
+}
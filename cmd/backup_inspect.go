@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/deepsquare-io/cfctl/pkg/backup"
+	"github.com/urfave/cli/v2"
+)
+
+var backupOutputFlag = &cli.StringFlag{
+	Name:    "output",
+	Usage:   "Output format (table, json)",
+	Aliases: []string{"o"},
+	Value:   "table",
+}
+
+var backupLsCommand = &cli.Command{
+	Name:      "ls",
+	Usage:     "List the backups of a destination",
+	ArgsUsage: "[destination]",
+	Description: `List the archives of a local directory, "s3://bucket/prefix" or
+"sftp://user@host/path" with the k0s version, cluster ID, controller and
+components recorded in their manifests. The archives are not downloaded.`,
+	Flags: []cli.Flag{backupOutputFlag},
+	Action: func(ctx *cli.Context) error {
+		if ctx.NArg() > 1 {
+			return errors.New("too many arguments, use --help")
+		}
+		to := "."
+		if ctx.Args().Present() {
+			to = ctx.Args().First()
+		}
+		destination, err := backup.ParseDestination(to)
+		if err != nil {
+			return err
+		}
+
+		infos, err := backup.ListInfo(ctx.Context, destination)
+		if err != nil {
+			return err
+		}
+
+		switch ctx.String("output") {
+		case "json":
+			return backup.WriteJSON(ctx.App.Writer, infos)
+		case "table":
+			return backup.WriteTable(ctx.App.Writer, infos)
+		default:
+			return fmt.Errorf("unknown output format %q", ctx.String("output"))
+		}
+	},
+}
+
+var backupInspectCommand = &cli.Command{
+	Name:      "inspect",
+	Usage:     "Show the contents of a local backup archive",
+	ArgsUsage: "<file>",
+	Description: `Read a local archive, decrypting it when encrypted, and show the k0s
+version, cluster ID, creation time, components and size of the backup. The
+archive is verified against the manifest stored next to it.`,
+	Flags: []cli.Flag{ageIdentityFlag, backupOutputFlag},
+	Action: func(ctx *cli.Context) error {
+		if ctx.NArg() != 1 {
+			return errors.New("no archive given, use --help")
+		}
+
+		var write func(io.Writer, *backup.Info) error
+		switch ctx.String("output") {
+		case "json":
+			write = func(w io.Writer, info *backup.Info) error {
+				return backup.WriteJSON(w, []*backup.Info{info})
+			}
+		case "table":
+			write = backup.WriteDetails
+		default:
+			return fmt.Errorf("unknown output format %q", ctx.String("output"))
+		}
+
+		identities, err := ageIdentities(ctx)
+		if err != nil {
+			return err
+		}
+
+		info, inspectErr := backup.InspectFile(ctx.Args().First(), identities)
+		if info == nil {
+			return inspectErr
+		}
+		if err := write(ctx.App.Writer, info); err != nil {
+			return err
+		}
+		return inspectErr
+	},
+}
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/deepsquare-io/cfctl/action"
+	"github.com/deepsquare-io/cfctl/phase"
+	"github.com/deepsquare-io/cfctl/pkg/backup"
+	"github.com/deepsquare-io/cfctl/pkg/cron"
+	"github.com/urfave/cli/v2"
+)
+
+var backupScheduleCommand = &cli.Command{
+	Name:  "schedule",
+	Usage: "Take backups on the controllers on a cron schedule",
+	Description: `Install a script and a systemd timer (a crond entry on Alpine) on the
+controllers taking a backup with k0s and shipping it to the --to destination
+like "cfctl backup" does: with a manifest, encrypted with --encrypt-to and
+pruned with --keep and --keep-within. On every run, the first controller
+taking the "` + backup.ScheduleLeaseName + `" lease of the ` + backup.ScheduleLeaseNamespace + ` namespace takes the
+backup and the others skip it, so that a single backup is taken on every run
+and the backups go on when a controller is lost. The runs starting less than
+` + backup.ScheduleLeaseDuration.String() + ` after the previous one are skipped.
+
+The destination must be an absolute directory of the controllers,
+"s3://bucket/prefix" or "sftp://user@host/path?identity=path". The S3
+credentials are read from the environment like for "cfctl backup" and stored
+in a root only file on the controllers, which need curl 7.75 or newer. The
+SFTP private key is only copied to the controllers with --upload-identity,
+use a key dedicated to the backups. The key of the SFTP server is verified
+with the known hosts like for "cfctl backup" and pinned on the controllers.
+Encrypted backups need the age or gpg command on the controllers, the public
+keys of the GPG recipients are copied to them once gpg accepted to encrypt
+for them.
+
+Use "cfctl backup schedule status" to show the next runs and the result of the
+last backups and "cfctl backup schedule remove" to uninstall them.`,
+	Flags: []cli.Flag{
+		configFlag,
+		dryRunFlag,
+		concurrencyFlag,
+		&cli.StringFlag{
+			Name:  "cron",
+			Usage: `Cron schedule of the backups, such as "0 2 * * *" or "@daily"`,
+		},
+		&cli.StringFlag{
+			Name:    "to",
+			Usage:   "Backup destination: an absolute directory of the controllers, s3://bucket/prefix or sftp://user@host/path?identity=path",
+			EnvVars: []string{"CFCTL_BACKUP_DESTINATION"},
+		},
+		&cli.BoolFlag{
+			Name:  "upload-identity",
+			Usage: "Copy the private key of a sftp destination to the controllers",
+		},
+		encryptToFlag,
+		keepFlag,
+		keepWithinFlag,
+	},
+	Subcommands: []*cli.Command{
+		{
+			Name:   "status",
+			Usage:  "Show the backup schedule of the controllers and their last backup",
+			Flags:  []cli.Flag{configFlag, concurrencyFlag},
+			Before: actions(initConfig, initManager, displayLogo, initAnalytics, displayCopyright),
+			Action: func(ctx *cli.Context) error {
+				return action.BackupSchedule{
+					Manager: ctx.Context.Value(ctxManagerKey{}).(*phase.Manager),
+				}.Status(ctx.App.Writer)
+			},
+		},
+		{
+			Name:   "remove",
+			Usage:  "Remove the backup schedule from the controllers",
+			Flags:  []cli.Flag{configFlag, dryRunFlag, concurrencyFlag},
+			Before: actions(initConfig, initManager, displayLogo, initAnalytics, displayCopyright),
+			Action: func(ctx *cli.Context) error {
+				return action.BackupSchedule{
+					Manager: ctx.Context.Value(ctxManagerKey{}).(*phase.Manager),
+				}.Remove()
+			},
+		},
+	},
+	Before: unlessSubcommand(initConfig, initManager, displayLogo, initAnalytics, displayCopyright),
+	Action: func(ctx *cli.Context) error {
+		if ctx.String("cron") == "" {
+			return errors.New("no schedule given, use --cron")
+		}
+		schedule, err := cron.Parse(ctx.String("cron"))
+		if err != nil {
+			return fmt.Errorf("--cron: %w", err)
+		}
+
+		if ctx.String("to") == "" {
+			return errors.New("no destination given, use --to")
+		}
+		destination, err := backup.ParseDestination(ctx.String("to"))
+		if err != nil {
+			return err
+		}
+
+		retention, err := backupRetention(ctx)
+		if err != nil {
+			return err
+		}
+		encrypter, err := backupEncrypter(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = action.BackupSchedule{
+			Manager:        ctx.Context.Value(ctxManagerKey{}).(*phase.Manager),
+			Schedule:       schedule,
+			Destination:    destination,
+			Retention:      retention,
+			Encrypter:      encrypter,
+			UploadIdentity: ctx.Bool("upload-identity"),
+		}.Install()
+		if err != nil {
+			return fmt.Errorf(
+				"backup schedule failed - log file saved to %s: %w",
+				ctx.Context.Value(ctxLogFileKey{}).(string),
+				err,
+			)
+		}
+		return nil
+	},
+}
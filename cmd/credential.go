@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/deepsquare-io/cfctl/action"
+	"github.com/deepsquare-io/cfctl/phase"
+	"github.com/urfave/cli/v2"
+)
+
+// localUser returns the name of the current user
+func localUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// credentialCacheFile returns the cache file of the credentials of a user of a cluster
+func credentialCacheFile(config, user string, groups []string) (string, error) {
+	sum := sha256.Sum256([]byte(strings.Join([]string{config, user, strings.Join(groups, ",")}, "\x00")))
+	return xdg.CacheFile(path.Join("cfctl", "credentials", hex.EncodeToString(sum[:8])+".json"))
+}
+
+var credentialCommand = &cli.Command{
+	Name:  "credential",
+	Usage: "Print a short-lived client certificate as an exec credential for kubectl",
+	Description: `Get a client certificate signed by the cluster for a user over ssh and print
+it as an ExecCredential, for the kubeconfigs written by "cfctl kubeconfig
+--exec-plugin". The groups must be bound to a role in the cluster, the
+cluster does not sign certificates for system:masters. The certificate is cached in the XDG cache directory until
+it is about to expire.`,
+	Flags: []cli.Flag{
+		configFlag,
+		&cli.StringFlag{
+			Name:  "user",
+			Usage: "User of the certificate (default: the current user)",
+		},
+		&cli.StringSliceFlag{
+			Name:     "group",
+			Usage:    "Group of the user, bound to a role in the cluster, can be repeated",
+			Required: true,
+		},
+		&cli.DurationFlag{
+			Name:  "expiry",
+			Usage: "Validity of the certificate",
+			Value: time.Hour,
+		},
+		&cli.BoolFlag{
+			Name:  "no-cache",
+			Usage: "Do not use nor store a cached certificate",
+		},
+		debugFlag,
+		traceFlag,
+		redactFlag,
+		retryIntervalFlag,
+		retryTimeoutFlag,
+	},
+	Before: actions(initStderrLogging, initConfig, initManager),
+	Action: func(ctx *cli.Context) error {
+		username := ctx.String("user")
+		if username == "" {
+			username = localUser()
+		}
+		if username == "" {
+			return errors.New("can't determine the current user, use --user")
+		}
+		groups := ctx.StringSlice("group")
+
+		var cacheFile string
+		if !ctx.Bool("no-cache") {
+			config, err := configPath(ctx.String("config"))
+			if err != nil {
+				return err
+			}
+			if cacheFile, err = credentialCacheFile(config, username, groups); err != nil {
+				return fmt.Errorf("credential cache: %w", err)
+			}
+		}
+
+		credentialAction := action.Credential{
+			Manager:   ctx.Context.Value(ctxManagerKey{}).(*phase.Manager),
+			Stdout:    ctx.App.Writer,
+			User:      username,
+			Groups:    groups,
+			Expiry:    ctx.Duration("expiry"),
+			CacheFile: cacheFile,
+		}
+
+		if err := credentialAction.Run(); err != nil {
+			return fmt.Errorf(
+				"getting credential failed - log file saved to %s: %w",
+				ctx.Context.Value(ctxLogFileKey{}).(string),
+				err,
+			)
+		}
+		return nil
+	},
+}
@@ -11,6 +11,7 @@ import (
 	"runtime"
 	"time"
 
+	"filippo.io/age"
 	"github.com/a8m/envsubst"
 	"github.com/adrg/xdg"
 	"github.com/deepsquare-io/cfctl/analytics"
@@ -18,6 +19,7 @@ import (
 	"github.com/deepsquare-io/cfctl/integration/segment"
 	"github.com/deepsquare-io/cfctl/phase"
 	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1"
+	"github.com/deepsquare-io/cfctl/pkg/backup"
 	"github.com/deepsquare-io/cfctl/pkg/retry"
 	cfctl "github.com/deepsquare-io/cfctl/version"
 	"github.com/k0sproject/rig"
@@ -60,6 +62,18 @@ var (
 		Value: false,
 	}
 
+	ageIdentityFlag = &cli.StringFlag{
+		Name:      "age-identity",
+		Usage:     "Path to the age identity file decrypting age encrypted backups",
+		EnvVars:   []string{"CFCTL_AGE_IDENTITY_FILE"},
+		TakesFile: true,
+	}
+
+	allowVersionMismatchFlag = &cli.BoolFlag{
+		Name:  "allow-version-mismatch",
+		Usage: "Restore a backup archive taken with an incompatible version of k0s",
+	}
+
 	configFlag = &cli.StringFlag{
 		Name:      "config",
 		Usage:     "Path to cluster config yaml. Use '-' to read from stdin.",
@@ -127,6 +141,26 @@ func actions(funcs ...func(*cli.Context) error) func(*cli.Context) error {
 	}
 }
 
+// ageIdentities reads the age identity file given with the age-identity flag
+func ageIdentities(ctx *cli.Context) ([]age.Identity, error) {
+	f := ctx.String("age-identity")
+	if f == "" {
+		return nil, nil
+	}
+	return backup.ReadAgeIdentities(f)
+}
+
+// unlessSubcommand runs the funcs only when no subcommand is invoked, for the
+// commands whose subcommands initialize themselves
+func unlessSubcommand(funcs ...func(*cli.Context) error) func(*cli.Context) error {
+	return func(ctx *cli.Context) error {
+		if ctx.Args().Present() && ctx.Command.Command(ctx.Args().First()) != nil {
+			return nil
+		}
+		return actions(funcs...)(ctx)
+	}
+}
+
 // initConfig takes the config flag, does some magic and replaces the value with the file contents
 func initConfig(ctx *cli.Context) error {
 	f := ctx.String("config")
@@ -249,7 +283,7 @@ func initManager(ctx *cli.Context) error {
 func initLogging(ctx *cli.Context) error {
 	log.SetLevel(log.TraceLevel)
 	log.SetOutput(io.Discard)
-	initScreenLogger(logLevelFromCtx(ctx, log.InfoLevel))
+	initScreenLogger(os.Stdout, logLevelFromCtx(ctx, log.InfoLevel))
 	exec.DisableRedact = ctx.Bool("no-redact")
 	rig.SetLogger(log.StandardLogger())
 	return initFileLogger(ctx)
@@ -261,7 +295,18 @@ func initSilentLogging(ctx *cli.Context) error {
 	log.SetLevel(log.TraceLevel)
 	log.SetOutput(io.Discard)
 	exec.DisableRedact = ctx.Bool("no-redact")
-	initScreenLogger(logLevelFromCtx(ctx, log.FatalLevel))
+	initScreenLogger(os.Stdout, logLevelFromCtx(ctx, log.FatalLevel))
+	rig.SetLogger(log.StandardLogger())
+	return initFileLogger(ctx)
+}
+
+// initStderrLogging initializes the logger in silent mode with the screen
+// logs on stderr, for the commands whose output is read by programs
+func initStderrLogging(ctx *cli.Context) error {
+	log.SetLevel(log.TraceLevel)
+	log.SetOutput(io.Discard)
+	exec.DisableRedact = ctx.Bool("no-redact")
+	initScreenLogger(os.Stderr, logLevelFromCtx(ctx, log.FatalLevel))
 	rig.SetLogger(log.StandardLogger())
 	return initFileLogger(ctx)
 }
@@ -276,8 +321,8 @@ func logLevelFromCtx(ctx *cli.Context, defaultLevel log.Level) log.Level {
 	}
 }
 
-func initScreenLogger(lvl log.Level) {
-	log.AddHook(screenLoggerHook(lvl))
+func initScreenLogger(out *os.File, lvl log.Level) {
+	log.AddHook(screenLoggerHook(out, lvl))
 }
 
 func initFileLogger(ctx *cli.Context) error {
@@ -327,6 +372,15 @@ func configReader(f string) (io.ReadCloser, error) {
 		return nil, fmt.Errorf("can't read stdin")
 	}
 
+	fp, err := configPath(f)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(fp)
+}
+
+// configPath returns the absolute path of the config file f
+func configPath(f string) (string, error) {
 	variants := []string{f}
 	// add .yml to default value lookup
 	if f == "cfctl.yaml" {
@@ -338,19 +392,10 @@ func configReader(f string) (io.ReadCloser, error) {
 			continue
 		}
 
-		fp, err := filepath.Abs(fn)
-		if err != nil {
-			return nil, err
-		}
-		file, err := os.Open(fp)
-		if err != nil {
-			return nil, err
-		}
-
-		return file, nil
+		return filepath.Abs(fn)
 	}
 
-	return nil, fmt.Errorf("failed to locate configuration")
+	return "", fmt.Errorf("failed to locate configuration")
 }
 
 type loghook struct {
@@ -383,15 +428,15 @@ func (h *loghook) Fire(entry *log.Entry) error {
 	return err
 }
 
-func screenLoggerHook(lvl log.Level) *loghook {
+func screenLoggerHook(out *os.File, lvl log.Level) *loghook {
 	var forceColors bool
 	var writer io.Writer
 	if runtime.GOOS == "windows" {
-		writer = ansicolor.NewAnsiColorWriter(os.Stdout)
+		writer = ansicolor.NewAnsiColorWriter(out)
 		forceColors = true
 	} else {
-		writer = os.Stdout
-		if fi, _ := os.Stdout.Stat(); (fi.Mode() & os.ModeCharDevice) != 0 {
+		writer = out
+		if fi, _ := out.Stat(); (fi.Mode() & os.ModeCharDevice) != 0 {
 			forceColors = true
 		}
 	}
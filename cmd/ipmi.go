@@ -1,60 +1,112 @@
 package cmd
 
 import (
-	"bytes"
-	"crypto/tls"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"net/http"
+	"net/url"
+	"slices"
 
+	"github.com/deepsquare-io/cfctl/pkg/ipmi"
+	"github.com/deepsquare-io/cfctl/pkg/secret"
 	"github.com/deepsquare-io/cfctl/utils/generators"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/urfave/cli/v2"
 )
 
-type Credential struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
-}
-
-var credential = Credential{}
-var address string
 var ipmiCommand = &cli.Command{
-	Name:        "ipmi",
-	ArgsUsage:   "hostnames action",
-	Usage:       "Manage compute nodes using ipmi-api",
-	Description: "Send action to IPMI API. Available actions: on, off, cycle, status, soft, reset.",
+	Name:      "ipmi",
+	ArgsUsage: "hostnames action",
+	Usage:     "Manage compute nodes using ipmi-api",
+	Description: `Send action to IPMI API. Available power actions: on, off, cycle, status, soft, reset.
+
+The sensors, inventory and sel actions read the BMC sensors, the hardware
+inventory and the system event log and print them as a table or as JSON
+(--output json). "sel --clear" clears the event log after reading it.
+
+The user and password flags accept secret references: "env:NAME" reads an
+environment variable, "file:PATH" reads the first line of a file and
+"literal:VALUE" escapes a value starting with one of the prefixes. When they
+are not given, the credentials are looked up in the netrc file using the API
+host name as the machine name.`,
 	Flags: []cli.Flag{
 		&cli.StringFlag{
-			Name:        "user",
-			Destination: &credential.Username,
-			Required:    true,
-			Usage:       "IPMI user provided",
-			EnvVars:     []string{"IPMIUSER"},
+			Name:    "user",
+			Usage:   "IPMI user provided",
+			EnvVars: []string{"IPMIUSER"},
+		},
+		&cli.StringFlag{
+			Name:    "password",
+			Usage:   "IPMI password",
+			EnvVars: []string{"IPMIPASS"},
+		},
+		&cli.StringFlag{
+			Name:      "password-file",
+			Usage:     "Read the IPMI password from the first line of a file",
+			EnvVars:   []string{"IPMIPASS_FILE"},
+			TakesFile: true,
+		},
+		&cli.StringFlag{
+			Name:      "netrc-file",
+			Usage:     "Path to a netrc file holding the IPMI credentials (default: $NETRC or ~/.netrc)",
+			EnvVars:   []string{"IPMI_NETRC"},
+			TakesFile: true,
+		},
+		&cli.StringFlag{
+			Name:    "address",
+			Usage:   "API address",
+			Value:   "https://ipmi.internal",
+			EnvVars: []string{"IPMIADDRESS"},
+		},
+		&cli.StringFlag{
+			Name:      "ca-cert",
+			Usage:     "Path to a PEM bundle used to verify the API server certificate (default: system roots)",
+			EnvVars:   []string{"IPMI_CA_CERT"},
+			TakesFile: true,
+		},
+		&cli.StringFlag{
+			Name:      "client-cert",
+			Usage:     "Path to a PEM client certificate for mutual TLS",
+			EnvVars:   []string{"IPMI_CLIENT_CERT"},
+			TakesFile: true,
 		},
 		&cli.StringFlag{
-			Name:        "password",
-			Destination: &credential.Password,
-			Required:    true,
-			Usage:       "IPMI password",
-			EnvVars:     []string{"IPMIPASS"},
+			Name:      "client-key",
+			Usage:     "Path to the PEM private key of the client certificate",
+			EnvVars:   []string{"IPMI_CLIENT_KEY"},
+			TakesFile: true,
+		},
+		&cli.BoolFlag{
+			Name:    "insecure",
+			Usage:   "Do not verify the API server certificate",
+			EnvVars: []string{"IPMI_INSECURE"},
 		},
 		&cli.StringFlag{
-			Name:        "address",
-			Destination: &address,
-			Usage:       "API address",
-			Value:       "https://ipmi.internal",
-			EnvVars:     []string{"IPMIADDRESS"},
+			Name:    "output",
+			Usage:   "Output format of the sensors, inventory and sel actions (table, json)",
+			Aliases: []string{"o"},
+			Value:   "table",
+		},
+		&cli.BoolFlag{
+			Name:  "clear",
+			Usage: "Clear the system event log after reading it (sel action only)",
 		},
 	},
 	Action: func(ctx *cli.Context) error {
-		if ctx.NArg() != 2 {
+		if ctx.NArg() < 2 {
 			return errors.New("not enough arguments, use --help")
 		}
 
+		// flags are not parsed after the positional arguments
+		clearSEL := ctx.Bool("clear")
+		for _, a := range ctx.Args().Slice()[2:] {
+			if a != "--clear" {
+				return fmt.Errorf("unexpected argument %q, use --help", a)
+			}
+			clearSEL = true
+		}
+
 		arg := ctx.Args().Get(0)
 		hostnamesRanges := generators.SplitCommaOutsideOfBrackets(arg)
 
@@ -65,43 +117,169 @@ var ipmiCommand = &cli.Command{
 		}
 
 		action := ctx.Args().Get(1)
-
-		client := &http.Client{
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-			},
+		if !slices.Contains(ipmi.PowerActions, action) && !slices.Contains(ipmiReadoutActions, action) {
+			return fmt.Errorf("unknown action %q, use --help", action)
+		}
+		if clearSEL && action != "sel" {
+			return errors.New("--clear can only be used with the sel action")
 		}
 
-		postData, err := json.Marshal(credential)
+		backend, err := ipmiBackend(ctx)
 		if err != nil {
 			return err
 		}
 
-		for _, host := range hostnames {
-
-			requestPath := fmt.Sprintf("%s/host/%s/%s", address, host, action)
+		if slices.Contains(ipmiReadoutActions, action) {
+			return ipmiReadout(ctx, backend, hostnames, action, clearSEL)
+		}
 
-			resp, err := client.Post(requestPath, "application/json", bytes.NewBuffer(postData))
+		for _, host := range hostnames {
+			out, err := backend.Power(ctx.Context, host, action)
 			if err != nil {
+				log.WithError(err).Error("ipmi request failed")
 				return err
 			}
-			defer resp.Body.Close()
-			b, err := io.ReadAll(resp.Body)
-			if err != nil {
-				log.WithError(err).Warn("ipmi response body couldn't be read")
-			}
+			log.Info(out)
+		}
+
+		return nil
+	},
+}
+
+var ipmiReadoutActions = []string{"sensors", "inventory", "sel"}
+
+// ipmiReadout reads the sensors, inventory or event log of the hosts and prints them
+func ipmiReadout(ctx *cli.Context, backend ipmi.ReadoutBackend, hostnames []string, action string, clearSEL bool) error {
+	var write func(io.Writer, []ipmi.HostReport) error
+	switch ctx.String("output") {
+	case "json":
+		write = ipmi.WriteJSON
+	case "table", "":
+		switch action {
+		case "sensors":
+			write = ipmi.WriteSensorsTable
+		case "inventory":
+			write = ipmi.WriteInventoryTable
+		case "sel":
+			write = ipmi.WriteSELTable
+		}
+	default:
+		return fmt.Errorf("unknown output format %q", ctx.String("output"))
+	}
 
-			if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-				log.WithFields(log.Fields{
-					"status": resp.StatusCode,
-					"body":   string(b),
-				}).Error("ipmi API returned non-OK status code")
-				return errors.New("ipmi API returned non-OK status code")
+	var errs []error
+	reports := make([]ipmi.HostReport, 0, len(hostnames))
+	for _, host := range hostnames {
+		report := ipmi.HostReport{Host: host}
+		var err error
+		switch action {
+		case "sensors":
+			report.Sensors, err = backend.Sensors(ctx.Context, host)
+		case "inventory":
+			report.Inventory, err = backend.Inventory(ctx.Context, host)
+		case "sel":
+			report.SEL, err = backend.SEL(ctx.Context, host)
+			if err == nil && clearSEL {
+				if err = backend.ClearSEL(ctx.Context, host); err == nil {
+					log.Infof("%s: system event log cleared", host)
+				}
 			}
-			log.Info(string(b))
+		}
+		if err != nil {
+			log.WithError(err).Errorf("%s: ipmi %s failed", host, action)
+			report.Error = err.Error()
+			errs = append(errs, err)
+		}
+		reports = append(reports, report)
+	}
+
+	if err := write(ctx.App.Writer, reports); err != nil {
+		return err
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("ipmi %s failed on %d hosts: %w", action, len(errs), errors.Join(errs...))
+	}
+
+	return nil
+}
+
+func ipmiBackend(ctx *cli.Context) (ipmi.ReadoutBackend, error) {
+	address := ctx.String("address")
+
+	credential, err := ipmiCredential(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+
+	if ctx.Bool("insecure") {
+		log.Warn("TLS certificate verification of the IPMI API is disabled")
+	}
+
+	client, err := ipmi.NewHTTPClient(ipmi.TLSOptions{
+		CACert:     ctx.String("ca-cert"),
+		ClientCert: ctx.String("client-cert"),
+		ClientKey:  ctx.String("client-key"),
+		Insecure:   ctx.Bool("insecure"),
+	})
+	if err != nil {
+		return nil, err
+	}
 
+	return ipmi.NewAPIBackend(address, credential, client), nil
+}
+
+// ipmiCredential resolves the credentials from the flags, the password file and the netrc file in that order
+func ipmiCredential(ctx *cli.Context, address string) (ipmi.Credential, error) {
+	var credential ipmi.Credential
+	var err error
+
+	if credential.Username, err = secret.Resolve(ctx.String("user")); err != nil {
+		return credential, fmt.Errorf("user: %w", err)
+	}
+
+	if credential.Password, err = secret.Resolve(ctx.String("password")); err != nil {
+		return credential, fmt.Errorf("password: %w", err)
+	}
+
+	if credential.Password == "" && ctx.String("password-file") != "" {
+		if credential.Password, err = secret.ReadFile(ctx.String("password-file")); err != nil {
+			return credential, err
 		}
+	}
 
-		return nil
-	},
+	if credential.Username == "" || credential.Password == "" {
+		netrc := ctx.String("netrc-file")
+		if netrc == "" {
+			netrc = ipmi.DefaultNetrcPath()
+		}
+		u, err := url.Parse(address)
+		if err != nil {
+			return credential, fmt.Errorf("invalid API address: %w", err)
+		}
+		if netrc != "" {
+			entry, ok, err := ipmi.LookupNetrc(netrc, u.Hostname())
+			if err != nil {
+				return credential, err
+			}
+			if ok {
+				log.Debugf("using credentials for %s from %s", u.Hostname(), netrc)
+				if credential.Username == "" {
+					credential.Username = entry.Username
+				}
+				if credential.Password == "" {
+					credential.Password = entry.Password
+				}
+			}
+		}
+	}
+
+	if credential.Username == "" {
+		return credential, errors.New("no IPMI user given, use --user or a netrc entry")
+	}
+	if credential.Password == "" {
+		return credential, errors.New("no IPMI password given, use --password, --password-file or a netrc entry")
+	}
+
+	return credential, nil
 }
@@ -1,23 +1,124 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"time"
 
 	"github.com/deepsquare-io/cfctl/action"
 	"github.com/deepsquare-io/cfctl/analytics"
 	"github.com/deepsquare-io/cfctl/phase"
+	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1"
+	"github.com/deepsquare-io/cfctl/pkg/kubeconfig"
+	log "github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
 )
 
+// optionalPath is the value of a flag that can be given alone (--merge) or
+// with a path (--merge=path)
+type optionalPath struct {
+	set  bool
+	path string
+}
+
+func (o *optionalPath) Set(v string) error {
+	o.set = true
+	if v != "true" {
+		o.path = v
+	}
+	return nil
+}
+
+func (o *optionalPath) String() string {
+	return o.path
+}
+
+// IsBoolFlag makes the value optional
+func (o *optionalPath) IsBoolFlag() bool {
+	return true
+}
+
+// kubeconfigPath returns the path of the kubeconfig to merge into, the default one when not given
+func kubeconfigPath(ctx *cli.Context) string {
+	if merge, ok := ctx.Generic("merge").(*optionalPath); ok && merge.path != "" {
+		return merge.path
+	}
+	return kubeconfig.DefaultPath()
+}
+
 var kubeconfigCommand = &cli.Command{
 	Name:  "kubeconfig",
-	Usage: "Output the admin kubeconfig of the cluster",
+	Usage: "Output the admin kubeconfig of the cluster or a kubeconfig signed for a user",
+	Description: `Print the admin kubeconfig of the cluster, or merge it with --merge into
+$KUBECONFIG or ~/.kube/config, or the file given with --merge=path. The
+cluster, user and context are named after metadata.name of the configuration
+or --context-name and replaced when they exist.
+
+With --user, a client certificate valid for --expiry is signed by the cluster
+for the user and the groups given with --group, and a kubeconfig using it is
+output instead of the admin one. The private key is generated locally and
+never sent to the hosts. --role binds a cluster role to the user, in the
+--namespace or cluster wide. Its context is named "user@metadata.name".
+
+With --exec-plugin, the kubeconfig gets its credentials from "cfctl
+credential", which gets a short-lived certificate from the leader over ssh and
+caches it until it is about to expire, so that the ssh access is the only long
+lived secret. The groups are required and must be bound to a role in the
+cluster, such as cluster-admin, the cluster does not sign certificates for
+system:masters. The user defaults to the current user and the expiry to 1h.
+
+With --remove, the context of the cluster is removed from the kubeconfig file
+along with its cluster and user, such as after a reset, without connecting to
+the hosts.`,
 	Flags: []cli.Flag{
 		&cli.StringFlag{
 			Name:  "address",
 			Usage: "Set kubernetes API address (default: auto-detect)",
 			Value: "",
 		},
+		&cli.GenericFlag{
+			Name:  "merge",
+			Usage: "Merge into $KUBECONFIG or ~/.kube/config instead of printing, --merge=path to merge into another file",
+			Value: &optionalPath{},
+		},
+		&cli.StringFlag{
+			Name:  "context-name",
+			Usage: "Name of the merged context, cluster and user (default: metadata.name)",
+		},
+		&cli.BoolFlag{
+			Name:  "set-current",
+			Usage: "Make the merged context the current context",
+		},
+		&cli.StringFlag{
+			Name:  "user",
+			Usage: "Output a kubeconfig signed for this user instead of the admin kubeconfig",
+		},
+		&cli.StringSliceFlag{
+			Name:  "group",
+			Usage: "Group of the user, can be repeated",
+		},
+		&cli.DurationFlag{
+			Name:  "expiry",
+			Usage: "Validity of the certificate of the user",
+			Value: 24 * time.Hour,
+		},
+		&cli.BoolFlag{
+			Name:  "exec-plugin",
+			Usage: `Output a kubeconfig getting short-lived certificates from "cfctl credential"`,
+		},
+		&cli.StringFlag{
+			Name:  "role",
+			Usage: "Bind this cluster role to the user",
+		},
+		&cli.StringFlag{
+			Name:  "namespace",
+			Usage: "Namespace of the role binding (default: cluster wide)",
+		},
+		&cli.BoolFlag{
+			Name:  "remove",
+			Usage: "Remove the context of the cluster from the kubeconfig file",
+		},
 		configFlag,
 		dryRunFlag,
 		debugFlag,
@@ -33,9 +134,76 @@ var kubeconfigCommand = &cli.Command{
 		return nil
 	},
 	Action: func(ctx *cli.Context) error {
+		if ctx.Args().Present() {
+			return fmt.Errorf("unexpected argument %q, use --merge=path to merge into a file", ctx.Args().First())
+		}
+
+		user := ctx.String("user")
+		execPlugin := ctx.Bool("exec-plugin")
+		if user == "" && !execPlugin && (ctx.IsSet("group") || ctx.IsSet("role") || ctx.IsSet("namespace") || ctx.IsSet("expiry")) {
+			return errors.New("--group, --role, --namespace and --expiry need --user")
+		}
+		if ctx.IsSet("namespace") && !ctx.IsSet("role") {
+			return errors.New("--namespace needs --role")
+		}
+		if execPlugin && ctx.IsSet("role") {
+			return errors.New("--role can not be used with --exec-plugin")
+		}
+		if execPlugin && len(ctx.StringSlice("group")) == 0 {
+			return errors.New("--exec-plugin needs --group, a group bound to a role in the cluster")
+		}
+		if err := kubeconfig.ValidateGroups(ctx.StringSlice("group")); err != nil {
+			return err
+		}
+
+		var execCommand string
+		var execArgs []string
+		if execPlugin {
+			if user == "" {
+				user = localUser()
+			}
+			var err error
+			if execCommand, execArgs, err = credentialExec(ctx, user); err != nil {
+				return err
+			}
+		}
+
+		contextName := ctx.String("context-name")
+		if contextName == "" {
+			contextName = ctx.Context.Value(ctxConfigKey{}).(*v1beta1.Cluster).Metadata.Name
+			if user != "" {
+				contextName = user + "@" + contextName
+			}
+		}
+
+		if ctx.Bool("remove") {
+			path := kubeconfigPath(ctx)
+			if ctx.Bool("dry-run") {
+				_, err := fmt.Fprintf(ctx.App.Writer, "dry-run: would remove context %q from %s\n", contextName, path)
+				return err
+			}
+			found, err := kubeconfig.Remove(path, contextName)
+			if err != nil {
+				return err
+			}
+			if !found {
+				log.Warnf("no context %q in %s", contextName, path)
+				return nil
+			}
+			_, err = fmt.Fprintf(ctx.App.Writer, "Removed context %q from %s\n", contextName, path)
+			return err
+		}
+
 		kubeconfigAction := action.Kubeconfig{
 			Manager:              ctx.Context.Value(ctxManagerKey{}).(*phase.Manager),
 			KubeconfigAPIAddress: ctx.String("address"),
+			User:                 user,
+			Groups:               ctx.StringSlice("group"),
+			Expiry:               ctx.Duration("expiry"),
+			Role:                 ctx.String("role"),
+			Namespace:            ctx.String("namespace"),
+			ExecCommand:          execCommand,
+			ExecArgs:             execArgs,
 		}
 
 		if err := kubeconfigAction.Run(); err != nil {
@@ -46,6 +214,19 @@ var kubeconfigCommand = &cli.Command{
 			)
 		}
 
+		if ctx.IsSet("merge") {
+			path := kubeconfigPath(ctx)
+			if kubeconfigAction.Manager.DryRun {
+				_, err := fmt.Fprintf(ctx.App.Writer, "dry-run: would merge context %q into %s\n", contextName, path)
+				return err
+			}
+			if err := kubeconfig.Merge(path, []byte(kubeconfigAction.Manager.Config.Metadata.Kubeconfig), contextName, ctx.Bool("set-current")); err != nil {
+				return err
+			}
+			_, err := fmt.Fprintf(ctx.App.Writer, "Merged context %q into %s\n", contextName, path)
+			return err
+		}
+
 		_, err := fmt.Fprintf(
 			ctx.App.Writer,
 			"%s\n",
@@ -54,3 +235,30 @@ var kubeconfigCommand = &cli.Command{
 		return err
 	},
 }
+
+// credentialExec returns the command and the arguments of "cfctl credential"
+// for the exec credential plugin of the user
+func credentialExec(ctx *cli.Context, user string) (string, []string, error) {
+	if user == "" {
+		return "", nil, errors.New("can't determine the current user, use --user")
+	}
+	command, err := os.Executable()
+	if err != nil {
+		return "", nil, fmt.Errorf("locate cfctl: %w", err)
+	}
+	config, err := configPath(ctx.String("config"))
+	if err != nil {
+		return "", nil, fmt.Errorf("the exec plugin needs a configuration file: %w", err)
+	}
+
+	args := []string{"credential", "--config", config, "--user", user}
+	for _, g := range ctx.StringSlice("group") {
+		args = append(args, "--group", g)
+	}
+	expiry := time.Hour
+	if ctx.IsSet("expiry") {
+		expiry = ctx.Duration("expiry")
+	}
+	args = append(args, "--expiry", expiry.String())
+	return command, args, nil
+}
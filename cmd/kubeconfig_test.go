@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"flag"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptionalPath(t *testing.T) {
+	parse := func(args ...string) (*optionalPath, []string) {
+		t.Helper()
+		v := &optionalPath{}
+		set := flag.NewFlagSet("test", flag.ContinueOnError)
+		set.SetOutput(io.Discard)
+		set.Var(v, "merge", "")
+		require.NoError(t, set.Parse(args))
+		return v, set.Args()
+	}
+
+	v, _ := parse()
+	require.False(t, v.set)
+
+	v, _ = parse("--merge")
+	require.True(t, v.set)
+	require.Equal(t, "", v.path)
+
+	v, _ = parse("--merge=/tmp/kubeconfig")
+	require.True(t, v.set)
+	require.Equal(t, "/tmp/kubeconfig", v.path)
+
+	// the path must be given with =
+	v, args := parse("--merge", "/tmp/kubeconfig")
+	require.Equal(t, "", v.path)
+	require.Equal(t, []string{"/tmp/kubeconfig"}, args)
+}
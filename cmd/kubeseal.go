@@ -1,138 +1,414 @@
 package cmd
 
 import (
-	"context"
+	"bytes"
 	"crypto/x509"
-	"encoding/pem"
 	"errors"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
-	"path/filepath"
-	"regexp"
 	"time"
 
+	"github.com/deepsquare-io/cfctl/action"
+	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1"
+	"github.com/deepsquare-io/cfctl/pkg/kubeseal"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+var (
+	kubesealCertFlag = &cli.StringFlag{
+		Name:    "cert",
+		Value:   "kubeseal.crt",
+		Usage:   "The name of the sealed secrets certificate, used for encryption.",
+		EnvVars: []string{"SEALED_SECRETS_CERTIFICATE"},
+	}
+
+	kubesealControllerNamespaceFlag = &cli.StringFlag{
+		Name:    "controller-namespace",
+		Value:   "sealed-secrets",
+		Usage:   "The namespace where the sealed secrets controller resides (not needed if certificate present).",
+		EnvVars: []string{"SEALED_SECRETS_CONTROLLER_NAMESPACE"},
+	}
+
+	kubesealControllerNameFlag = &cli.StringFlag{
+		Name:    "controller-name",
+		Value:   "sealed-secrets",
+		Usage:   "The name of the sealed secrets controller (not needed if certificate present).",
+		EnvVars: []string{"SEALED_SECRETS_CONTROLLER_NAME"},
+	}
+
+	kubesealConfigFlag = &cli.StringFlag{
+		Name:      "config",
+		Usage:     "Path to cluster config yaml, fetch the certificate through the k0s leader instead of the current kubectl context",
+		Aliases:   []string{"c"},
+		TakesFile: true,
+	}
+
+	kubesealRootFlag = &cli.StringSliceFlag{
+		Name:  "root",
+		Usage: "Directory to search for secret files, can be given multiple times",
+		Value: cli.NewStringSlice("."),
+	}
+
+	kubesealIncludeFlag = &cli.StringSliceFlag{
+		Name:  "include",
+		Usage: "Glob of the secret files to seal, relative to the root (default: \"**/*-secret.yaml.local\", \"**/*-secret.yml.local\")",
+	}
+
+	kubesealExcludeFlag = &cli.StringSliceFlag{
+		Name:  "exclude",
+		Usage: "Glob of the files and directories to skip, relative to the root",
+	}
+
+	kubesealHashKeyFlag = &cli.StringFlag{
+		Name:    "hash-key",
+		Usage:   "Key of the HMAC recording the plaintext of the sealed secrets (default: plain SHA-256)",
+		EnvVars: []string{"SEALED_SECRETS_HASH_KEY"},
+	}
 )
 
-var secretFileRegex = regexp.MustCompile(`^(.*)-secret.(yml|yaml).local$`)
 var kubesealCommand = &cli.Command{
 	Name:  "kubeseal",
 	Usage: "Kubeseal every '-secret.yaml.local' files recursively",
+	Description: `Seal every '-secret.yaml.local' file into a '-sealed-secret.yaml' file.
+
+The files are searched in the --root directories and can be selected with the
+--include and --exclude globs. Files matched by other patterns are sealed into
+'.sealed.yaml' files. The sealed files themselves and the '` + kubeseal.DirConfigFile + `'
+files are never sealed, even when the globs match them. A file may hold several secrets separated by '---'. A
+'` + kubeseal.DirConfigFile + `' file sets the "scope" and the default "namespace" of the
+secrets of its directory and subdirectories.
+
+A hash of the plaintext is recorded in the sealed file so that sources edited
+after sealing are resealed. Use --hash-key to record a keyed HMAC instead of a
+plain SHA-256, which is recommended for low entropy secrets. Use --check in CI
+to fail when a sealed file is stale or missing.
+
+The sealed files without a recorded hash, such as the ones sealed by an older
+cfctl, are left as they are with a warning and --check only warns about them.
+Use --unrecorded to reseal them and record their hash.
+
+The certificate is fetched from the controller, or from its key secret when the
+controller can not be reached, using the current context of the kubeconfig
+(KUBECONFIG or ~/.kube/config). With --config, it is fetched through the k0s
+leader of the cluster instead.
+
+The fingerprint of the certificate is recorded as well, see "cfctl kubeseal
+rotate" to reseal the secrets after the controller rotated its key.`,
+	Subcommands: []*cli.Command{
+		kubesealRotateCommand,
+	},
 	Flags: []cli.Flag{
+		kubesealCertFlag,
+		kubesealControllerNamespaceFlag,
+		kubesealControllerNameFlag,
+		kubesealConfigFlag,
+		kubesealHashKeyFlag,
+		kubesealRootFlag,
+		kubesealIncludeFlag,
+		kubesealExcludeFlag,
 		&cli.StringFlag{
-			Name:    "cert",
-			Value:   "kubeseal.crt",
-			Usage:   "The name of the sealed secrets certificate, used for encryption.",
-			EnvVars: []string{"SEALED_SECRETS_CERTIFICATE"},
+			Name:  "scope",
+			Usage: "Scope of the sealed secrets, overriding the annotations and " + kubeseal.DirConfigFile + " (strict, namespace-wide, cluster-wide)",
 		},
 		&cli.StringFlag{
-			Name:    "controller-namespace",
-			Value:   "sealed-secrets",
-			Usage:   "The namespace where the sealed secrets controller resides (not needed if certificate present).",
-			EnvVars: []string{"SEALED_SECRETS_CONTROLLER_NAMESPACE"},
+			Name:  "namespace",
+			Usage: "Namespace of the secrets that do not define one, overriding " + kubeseal.DirConfigFile,
+		},
+		&cli.BoolFlag{
+			Name:  "raw",
+			Usage: "Encrypt a single value read from --from-file or stdin and print it",
 		},
 		&cli.StringFlag{
-			Name:    "controller-name",
-			Value:   "sealed-secrets",
-			Usage:   "The name of the sealed secrets controller (not needed if certificate present).",
-			EnvVars: []string{"SEALED_SECRETS_CONTROLLER_NAME"},
+			Name:  "name",
+			Usage: "Name of the secret the raw value is sealed for",
+		},
+		&cli.StringFlag{
+			Name:      "from-file",
+			Usage:     "Read the raw value from a file instead of stdin",
+			TakesFile: true,
+		},
+		&cli.BoolFlag{
+			Name:  "force",
+			Usage: "Reseal every secret even when the sealed file is up to date",
+		},
+		&cli.BoolFlag{
+			Name:  "unrecorded",
+			Usage: "Reseal the sealed files without a recorded source hash, such as the ones sealed by an older cfctl",
+		},
+		&cli.BoolFlag{
+			Name:  "check",
+			Usage: "Do not seal, exit with an error when a sealed file is stale or missing",
 		},
 	},
+	Before: initConfig,
 	Action: func(ctx *cli.Context) error {
-		cert := ctx.String("cert")
-		if _, err := os.Stat(cert); errors.Is(err, os.ErrNotExist) {
-			if err := fetchCertificate(ctx.Context, cert, ctx.String("controller-name"), ctx.String("controller-namespace")); err != nil {
-				return err
-			}
+		scope, err := kubeseal.ParseScope(ctx.String("scope"))
+		if err != nil {
+			return err
 		}
 
-		// Check certificate expiration
-		certData, err := os.ReadFile(cert)
-		if err != nil {
+		if ctx.Bool("raw") {
+			return sealRaw(ctx, scope)
+		}
+
+		hashKey := []byte(ctx.String("hash-key"))
+
+		discovery := &kubeseal.Discovery{
+			Roots:   ctx.StringSlice("root"),
+			Include: ctx.StringSlice("include"),
+			Exclude: ctx.StringSlice("exclude"),
+		}
+		files, err := discovery.Find()
+		if err != nil && len(files) == 0 {
 			return err
 		}
+		// keep sealing the files that were found and report the walk errors at the end
+		var errs []error
+		if err != nil {
+			errs = append(errs, err)
+		}
 
-		block, _ := pem.Decode(certData)
-		if block == nil {
-			logrus.Error("failed to decode certificate")
-			return errors.New("failed to decode certificate")
+		if ctx.Bool("check") {
+			return errors.Join(append(errs, checkSecretFiles(files, hashKey))...)
 		}
 
-		certParsed, err := x509.ParseCertificate(block.Bytes)
+		certParsed, err := loadCertificate(ctx, false)
 		if err != nil {
 			return err
 		}
 
-		// Check if the certificate has expired
-		if time.Now().After(certParsed.NotAfter) {
-			logrus.Warn("Certificate has expired. Fetching new certificate.")
-			if err := fetchCertificate(ctx.Context, cert, ctx.String("controller-name"), ctx.String("controller-namespace")); err != nil {
-				return err
-			}
-		} else {
-			logrus.WithField("expirationDate", certParsed.NotAfter).Info("Certificate has not expired")
+		sealer, err := kubeseal.NewSealer(certParsed)
+		if err != nil {
+			return err
 		}
+		sealer.Scope = scope
+		sealer.Namespace = ctx.String("namespace")
 
 		logrus.Info("Processing...")
-		if err := filepath.Walk(".",
-			func(path string, info os.FileInfo, err error) error {
-				if info.IsDir() {
-					return nil
+		var sealed, unrecorded int
+		for _, f := range files {
+			source, err := os.ReadFile(f.Source)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			if !ctx.Bool("force") {
+				status, err := kubeseal.CheckStatus(source, f.Sealed, hashKey)
+				if err != nil {
+					errs = append(errs, err)
+					continue
+				}
+				if status == kubeseal.Unrecorded && !ctx.Bool("unrecorded") {
+					logrus.Debugf("%s: %s, skipping", f.Sealed, status)
+					unrecorded++
+					continue
 				}
-				if res := secretFileRegex.FindStringSubmatch(path); len(res) == 3 {
-					sealedFilePath := fmt.Sprintf("%s-sealed-secret.%s", res[1], res[2])
-					if _, err := os.Stat(sealedFilePath); err == nil {
-						return nil
-					}
-					out, err := exec.Command(
-						"kubeseal",
-						"--cert",
-						cert,
-						"--format",
-						"yaml",
-						"--secret-file",
-						path,
-						"--sealed-secret-file",
-						sealedFilePath,
-					).CombinedOutput()
-					if err != nil {
-						logrus.Errorf("%v: %s\n", err, out)
-					}
-					logrus.Printf("Sealed at %s\n", sealedFilePath)
+				if status == kubeseal.UpToDate {
+					continue
 				}
-				return nil
-			},
-		); err != nil {
-			logrus.Println(err)
+				logrus.Debugf("%s: %s", f.Sealed, status)
+			}
+
+			if err := sealFile(sealer, f, source, hashKey); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", f.Source, err))
+				continue
+			}
+			sealed++
+			logrus.Printf("Sealed at %s\n", f.Sealed)
+		}
+
+		if unrecorded > 0 {
+			logrus.Warnf("%d sealed secrets have no recorded source hash and were left as they are, use --unrecorded to reseal them", unrecorded)
+		}
+		if err := errors.Join(errs...); err != nil {
+			logrus.Errorf("Sealed %d secret files, %d failures", sealed, len(errs))
+			return err
 		}
 		return nil
 	},
 }
 
-func fetchCertificate(
-	ctx context.Context,
-	cert string,
-	ctrlName string,
-	ctrlNamespace string,
-) error {
-	logrus.WithField("path", cert).Warn(
-		"sealed secret certificate not found, trying to fetching it",
-	)
-	// Fetch certificate
-	data, err := exec.CommandContext(
-		ctx,
-		"kubeseal",
-		"--controller-namespace",
-		ctrlNamespace,
-		"--controller-name",
-		ctrlName,
-		"--fetch-cert",
-	).CombinedOutput()
+// sealRaw encrypts a single value and prints it
+func sealRaw(ctx *cli.Context, scope kubeseal.Scope) error {
+	name, namespace := ctx.String("name"), ctx.String("namespace")
+	if scope == kubeseal.ScopeDefault {
+		scope = kubeseal.ScopeStrict
+	}
+	if scope != kubeseal.ScopeClusterWide && namespace == "" {
+		return errors.New("--namespace is required to seal a raw value, unless the scope is cluster-wide")
+	}
+	if scope == kubeseal.ScopeStrict && name == "" {
+		return errors.New("--name is required to seal a raw value with the strict scope")
+	}
+
+	var value []byte
+	var err error
+	if f := ctx.String("from-file"); f != "" {
+		value, err = os.ReadFile(f)
+	} else {
+		value, err = io.ReadAll(ctx.App.Reader)
+	}
+	if err != nil {
+		return err
+	}
+
+	cert, err := loadCertificate(ctx, false)
+	if err != nil {
+		return err
+	}
+
+	sealer, err := kubeseal.NewSealer(cert)
+	if err != nil {
+		return err
+	}
+
+	encrypted, err := sealer.EncryptValue(namespace, name, scope, value)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(ctx.App.Writer, encrypted)
+	return err
+}
+
+// loadCertificate reads the sealed secrets certificate, fetching it from the
+// controller when it is missing, has expired or when refresh is set
+func loadCertificate(ctx *cli.Context, refresh bool) (*x509.Certificate, error) {
+	cert := ctx.String("cert")
+	if _, err := os.Stat(cert); refresh || errors.Is(err, os.ErrNotExist) {
+		if !refresh {
+			logrus.WithField("path", cert).Warn("sealed secret certificate not found, trying to fetching it")
+		}
+		if err := fetchCertificate(ctx, cert); err != nil {
+			return nil, err
+		}
+	}
+
+	// Check certificate expiration
+	certData, err := os.ReadFile(cert)
+	if err != nil {
+		return nil, err
+	}
+
+	certParsed, err := kubeseal.ParseCertificate(certData)
+	if err != nil {
+		logrus.Error("failed to decode certificate")
+		return nil, err
+	}
+
+	// Check if the certificate has expired
+	if time.Now().After(certParsed.NotAfter) {
+		if refresh {
+			return nil, fmt.Errorf("the certificate of the controller expired on %s", certParsed.NotAfter)
+		}
+		logrus.Warn("Certificate has expired. Fetching new certificate.")
+		return loadCertificate(ctx, true)
+	}
+
+	logrus.WithField("expirationDate", certParsed.NotAfter).Info("Certificate has not expired")
+	return certParsed, nil
+}
+
+// checkSecretFiles reports the stale or missing sealed files, the files
+// without a recorded source hash are only warned about
+func checkSecretFiles(files []kubeseal.SecretFile, hashKey []byte) error {
+	var errs []error
+	var stale, unrecorded int
+	for _, f := range files {
+		source, err := os.ReadFile(f.Source)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		status, err := kubeseal.CheckStatus(source, f.Sealed, hashKey)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		switch {
+		case status.Stale():
+			stale++
+			logrus.Errorf("%s: %s (source %s)", f.Sealed, status, f.Source)
+		case status == kubeseal.Unrecorded:
+			unrecorded++
+			logrus.Warnf("%s: %s (source %s)", f.Sealed, status, f.Source)
+		}
+	}
+
+	if unrecorded > 0 {
+		logrus.Warnf("%d sealed secrets have no recorded source hash, run cfctl kubeseal --unrecorded to record it", unrecorded)
+	}
+
+	if stale > 0 {
+		errs = append(errs, fmt.Errorf("%d sealed secrets are stale or missing, run cfctl kubeseal", stale))
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	logrus.Infof("All %d sealed secrets are up to date", len(files)-unrecorded)
+	return nil
+}
+
+// sealFile seals the secret manifest source of f into its sealed file, using
+// the scope and namespace of the directory configuration unless the sealer
+// sets them
+func sealFile(sealer *kubeseal.Sealer, f kubeseal.SecretFile, source []byte, hashKey []byte) error {
+	s := *sealer
+	if s.Scope == kubeseal.ScopeDefault {
+		scope, err := kubeseal.ParseScope(f.Config.Scope)
+		if err != nil {
+			return err
+		}
+		s.Scope = scope
+	}
+	if s.Namespace == "" {
+		s.Namespace = f.Config.Namespace
+	}
+	s.Annotations = map[string]string{
+		kubeseal.SourceHashAnnotation: kubeseal.SourceHash(source, hashKey),
+	}
+	sealed, err := s.SealYAML(source)
 	if err != nil {
-		fmt.Printf("%v: %s\n", err, cert)
 		return err
 	}
-	return os.WriteFile(cert, data, os.ModePerm)
+	return os.WriteFile(f.Sealed, sealed, 0644)
+}
+
+// fetchCertificate fetches the certificate of the controller through the k0s
+// leader when a cluster config is given, or with the current kubeconfig
+// context otherwise
+func fetchCertificate(ctx *cli.Context, cert string) error {
+	logrus.WithField("path", cert).Info("fetching the sealed secret certificate")
+
+	var buf bytes.Buffer
+	if config, ok := ctx.Context.Value(ctxConfigKey{}).(*v1beta1.Cluster); ok {
+		certAction := action.KubesealCertificate{
+			Config:              config,
+			ControllerName:      ctx.String("controller-name"),
+			ControllerNamespace: ctx.String("controller-namespace"),
+			Writer:              &buf,
+		}
+		if err := certAction.Run(); err != nil {
+			return err
+		}
+	} else {
+		config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+			clientcmd.NewDefaultClientConfigLoadingRules(),
+			&clientcmd.ConfigOverrides{},
+		).ClientConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load the kubeconfig: %w", err)
+		}
+		data, err := kubeseal.FetchCertificate(ctx.Context, config, ctx.String("controller-namespace"), ctx.String("controller-name"))
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+	}
+	return os.WriteFile(cert, buf.Bytes(), os.ModePerm)
 }
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/deepsquare-io/cfctl/pkg/kubeseal"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+)
+
+var kubesealRotateCommand = &cli.Command{
+	Name:  "rotate",
+	Usage: "Reseal the secrets sealed for another certificate",
+	Description: `Fetch the current certificate of the sealed secrets controller and reseal
+every sealed file that was not encrypted for it from its source. The sealed
+files are those "cfctl kubeseal" writes for the secret files selected by
+--root, --include and --exclude, such as the '-sealed-secret.yaml' files of the
+'-secret.yaml.local' files, with the scope and namespace of their
+'` + kubeseal.DirConfigFile + `'. Sealed files without a source are reported and make the
+command fail.`,
+	Flags: []cli.Flag{
+		kubesealCertFlag,
+		kubesealControllerNamespaceFlag,
+		kubesealControllerNameFlag,
+		kubesealConfigFlag,
+		kubesealHashKeyFlag,
+		kubesealRootFlag,
+		kubesealIncludeFlag,
+		kubesealExcludeFlag,
+	},
+	Before: initConfig,
+	Action: func(ctx *cli.Context) error {
+		hashKey := []byte(ctx.String("hash-key"))
+
+		discovery := &kubeseal.Discovery{
+			Roots:   ctx.StringSlice("root"),
+			Include: ctx.StringSlice("include"),
+			Exclude: ctx.StringSlice("exclude"),
+		}
+		files, err := discovery.FindSealed()
+		if err != nil && len(files) == 0 {
+			return err
+		}
+		// keep resealing the files that were found and report the walk errors at the end
+		var errs []error
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		cert, err := loadCertificate(ctx, true)
+		if err != nil {
+			return err
+		}
+
+		sealer, err := kubeseal.NewSealer(cert)
+		if err != nil {
+			return err
+		}
+		logrus.WithField("fingerprint", sealer.Fingerprint).Info("Resealing the secrets for the current certificate")
+
+		var resealed int
+		var missing []string
+		for _, f := range files {
+			current, err := kubeseal.CheckFingerprint(f.Sealed, sealer.Fingerprint)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if current {
+				continue
+			}
+
+			source, err := os.ReadFile(f.Source)
+			if errors.Is(err, os.ErrNotExist) {
+				logrus.Warnf("%s: sealed for another certificate but the source %s is missing", f.Sealed, f.Source)
+				missing = append(missing, f.Sealed)
+				continue
+			}
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			if err := sealFile(sealer, f, source, hashKey); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", f.Source, err))
+				continue
+			}
+			resealed++
+			logrus.Printf("Resealed %s\n", f.Sealed)
+		}
+
+		logrus.Infof("Resealed %d of %d sealed secrets", resealed, len(files))
+
+		if len(missing) > 0 {
+			errs = append(errs, fmt.Errorf("%d sealed secrets could not be resealed because their sources are missing: %v", len(missing), missing))
+		}
+		return errors.Join(errs...)
+	},
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"github.com/deepsquare-io/cfctl/action"
+	"github.com/deepsquare-io/cfctl/phase"
+	"github.com/urfave/cli/v2"
+)
+
+var lockCommand = &cli.Command{
+	Name:  "lock",
+	Usage: "Inspect and release the cfctl locks of the hosts",
+	Description: `Every run of cfctl changing the cluster holds a lock file on the hosts,
+refreshed every 10 seconds and recording the user, the local hostname, the
+command line, the start time and the version of cfctl holding it. A lock
+which was not refreshed for 30 seconds is expired and taken over by the next
+run. With spec.clusterLock, the lock lease of the cluster is shown and
+released too.`,
+	Subcommands: []*cli.Command{
+		{
+			Name:   "status",
+			Usage:  "Show who holds the lock of the hosts",
+			Flags:  []cli.Flag{configFlag, concurrencyFlag, debugFlag, traceFlag, redactFlag},
+			Before: actions(initLogging, initConfig, initManager, initAnalytics),
+			After:  actions(closeAnalytics),
+			Action: func(ctx *cli.Context) error {
+				return action.Lock{
+					Manager: ctx.Context.Value(ctxManagerKey{}).(*phase.Manager),
+				}.Status(ctx.App.Writer)
+			},
+		},
+		{
+			Name:  "release",
+			Usage: "Remove the lock files left on the hosts by an interrupted run",
+			Description: `Remove the expired lock files of the hosts. The locks still refreshed by
+a running instance of cfctl are only removed with --force, make sure that
+instance was stopped first.`,
+			Flags: []cli.Flag{
+				configFlag,
+				dryRunFlag,
+				concurrencyFlag,
+				debugFlag,
+				traceFlag,
+				redactFlag,
+				&cli.BoolFlag{
+					Name:  "force",
+					Usage: "Release the locks held by a running instance of cfctl too",
+				},
+			},
+			Before: actions(initLogging, initConfig, initManager, initAnalytics),
+			After:  actions(closeAnalytics),
+			Action: func(ctx *cli.Context) error {
+				return action.Lock{
+					Manager: ctx.Context.Value(ctxManagerKey{}).(*phase.Manager),
+				}.Release(ctx.Bool("force"))
+			},
+		},
+	},
+}
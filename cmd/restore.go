@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/deepsquare-io/cfctl/action"
+	"github.com/deepsquare-io/cfctl/phase"
+
+	"github.com/urfave/cli/v2"
+)
+
+var restoreCommand = &cli.Command{
+	Name:      "restore",
+	Usage:     "Rebuild a cluster from a backup archive",
+	ArgsUsage: "<archive>",
+	Description: `Restore the cluster state from a backup archive onto the k0s leader of the
+configuration, start it and join the other controllers and the workers with
+fresh tokens.
+
+The archive is verified with its manifest and decrypted when encrypted before
+anything is changed on the hosts. The version of k0s it was taken with is read
+from the archive, where cfctl records it, or from its manifest. Archives taken
+with another minor version of k0s or with a newer one than the version of the
+configuration are refused unless --allow-version-mismatch is given. Archives
+without a manifest or a known k0s version, such as the ones of k0s backup, are
+restored with a warning.
+
+The hosts must not run k0s nor hold the state of a previous cluster. With
+--reset, such hosts are reset first.`,
+	Flags: []cli.Flag{
+		configFlag,
+		concurrencyFlag,
+		concurrentUploadsFlag,
+		dryRunFlag,
+		ageIdentityFlag,
+		allowVersionMismatchFlag,
+		&cli.BoolFlag{
+			Name:  "reset",
+			Usage: "Reset the hosts running k0s or holding the state of a previous cluster before restoring",
+		},
+		&cli.BoolFlag{
+			Name:    "force",
+			Usage:   "Don't ask for confirmation",
+			Aliases: []string{"f"},
+		},
+		debugFlag,
+		traceFlag,
+		redactFlag,
+		retryIntervalFlag,
+		retryTimeoutFlag,
+		analyticsFlag,
+		upgradeCheckFlag,
+	},
+	Before: actions(
+		initLogging,
+		startCheckUpgrade,
+		initConfig,
+		initManager,
+		displayLogo,
+		initAnalytics,
+		displayCopyright,
+		warnOldCache,
+	),
+	After: actions(reportCheckUpgrade, closeAnalytics),
+	Action: func(ctx *cli.Context) error {
+		if ctx.NArg() != 1 {
+			return errors.New("no backup archive given, use --help")
+		}
+
+		identities, err := ageIdentities(ctx)
+		if err != nil {
+			return err
+		}
+
+		restoreAction := action.Restore{
+			Manager:              ctx.Context.Value(ctxManagerKey{}).(*phase.Manager),
+			Stdout:               ctx.App.Writer,
+			RestoreFrom:          ctx.Args().First(),
+			AgeIdentities:        identities,
+			Reset:                ctx.Bool("reset"),
+			Force:                ctx.Bool("force"),
+			AllowVersionMismatch: ctx.Bool("allow-version-mismatch"),
+		}
+
+		if err := restoreAction.Run(); err != nil {
+			return fmt.Errorf(
+				"restore failed - log file saved to %s: %w",
+				ctx.Context.Value(ctxLogFileKey{}).(string),
+				err,
+			)
+		}
+
+		return nil
+	},
+}
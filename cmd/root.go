@@ -17,9 +17,12 @@ var App = &cli.App{
 		versionCommand,
 		applyCommand,
 		kubeconfigCommand,
+		credentialCommand,
 		initCommand,
 		resetCommand,
+		lockCommand,
 		backupCommand,
+		restoreCommand,
 		{
 			Name:  "config",
 			Usage: "Configuration related sub-commands",
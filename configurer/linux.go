@@ -9,6 +9,7 @@ import (
 	"sync"
 
 	"github.com/alessio/shellescape"
+	"github.com/deepsquare-io/cfctl/pkg/cron"
 	"github.com/k0sproject/rig/exec"
 	"github.com/k0sproject/rig/os"
 	"github.com/k0sproject/version"
@@ -37,6 +38,9 @@ func (l *Linux) initPaths() {
 		"K0sConfigPath":      "/etc/k0s/k0s.yaml",
 		"K0sJoinTokenPath":   "/etc/k0s/k0stoken",
 		"DataDirDefaultPath": "/var/lib/k0s",
+		"BackupScriptPath":   "/usr/local/bin/cfctl-backup",
+		"BackupEnvPath":      "/etc/cfctl/backup.env",
+		"BackupStatusPath":   "/var/lib/cfctl/backup.status",
 	}
 }
 
@@ -76,6 +80,33 @@ func (l *Linux) DataDirDefaultPath() string {
 	return l.paths["DataDirDefaultPath"]
 }
 
+// BackupScriptPath returns the path to the scheduled backup script on the host
+func (l *Linux) BackupScriptPath() string {
+	l.pathMu.Lock()
+	defer l.pathMu.Unlock()
+
+	l.initPaths()
+	return l.paths["BackupScriptPath"]
+}
+
+// BackupEnvPath returns the path to the environment file of the scheduled backup script
+func (l *Linux) BackupEnvPath() string {
+	l.pathMu.Lock()
+	defer l.pathMu.Unlock()
+
+	l.initPaths()
+	return l.paths["BackupEnvPath"]
+}
+
+// BackupStatusPath returns the path to the file where the scheduled backup script records its last run
+func (l *Linux) BackupStatusPath() string {
+	l.pathMu.Lock()
+	defer l.pathMu.Unlock()
+
+	l.initPaths()
+	return l.paths["BackupStatusPath"]
+}
+
 // SetPath sets a path for a key
 func (l *Linux) SetPath(key, value string) {
 	l.pathMu.Lock()
@@ -310,3 +341,79 @@ func (l *Linux) DeleteDir(h os.Host, path string, opts ...exec.Option) error {
 func (l *Linux) MachineID(h os.Host) (string, error) {
 	return h.ExecOutput(`cat /etc/machine-id || cat /var/lib/dbus/machine-id`)
 }
+
+const backupUnit = "cfctl-backup"
+
+// InstallBackupSchedule installs a systemd timer running the backup script on the cron schedule
+func (l *Linux) InstallBackupSchedule(h os.Host, schedule cron.Schedule) error {
+	calendar, err := schedule.OnCalendar()
+	if err != nil {
+		return err
+	}
+
+	service := fmt.Sprintf(`[Unit]
+Description=k0s backup (managed by cfctl)
+After=network-online.target k0scontroller.service
+Wants=network-online.target
+
+[Service]
+Type=oneshot
+ExecStart=%s
+`, l.BackupScriptPath())
+
+	timer := fmt.Sprintf(`[Unit]
+Description=k0s backup schedule (managed by cfctl)
+
+[Timer]
+# cron: %s
+OnCalendar=%s
+Persistent=true
+RandomizedDelaySec=60
+
+[Install]
+WantedBy=timers.target
+`, schedule, calendar)
+
+	for name, content := range map[string]string{backupUnit + ".service": service, backupUnit + ".timer": timer} {
+		if err := h.Execf(`cat > "/etc/systemd/system/%s"`, name, exec.Stdin(content), exec.Sudo(h)); err != nil {
+			return fmt.Errorf("write %s: %w", name, err)
+		}
+	}
+
+	return h.Execf("systemctl daemon-reload && systemctl enable --now %s.timer", backupUnit, exec.Sudo(h))
+}
+
+// RemoveBackupSchedule removes the systemd timer of the backup script
+func (l *Linux) RemoveBackupSchedule(h os.Host) error {
+	return h.Execf(
+		`systemctl disable --now %[1]s.timer 2> /dev/null; rm -f /etc/systemd/system/%[1]s.service /etc/systemd/system/%[1]s.timer && systemctl daemon-reload`,
+		backupUnit,
+		exec.Sudo(h),
+	)
+}
+
+// BackupScheduleStatus returns the state and the next run of the backup systemd timer
+func (l *Linux) BackupScheduleStatus(h os.Host) (string, error) {
+	output, err := h.ExecOutputf(
+		`systemctl show %s.timer --property=LoadState,ActiveState,NextElapseUSecRealtime`,
+		backupUnit,
+		exec.Sudo(h),
+	)
+	if err != nil {
+		return "", err
+	}
+	props := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		if k, v, ok := strings.Cut(line, "="); ok {
+			props[k] = strings.TrimSpace(v)
+		}
+	}
+	if props["LoadState"] != "loaded" {
+		return "not installed", nil
+	}
+	status := "timer " + props["ActiveState"]
+	if next := props["NextElapseUSecRealtime"]; next != "" {
+		status += ", next run " + next
+	}
+	return status, nil
+}
@@ -1,8 +1,12 @@
 package linux
 
 import (
+	"fmt"
 	"strings"
 
+	"github.com/alessio/shellescape"
+	"github.com/deepsquare-io/cfctl/pkg/cron"
+
 	"github.com/deepsquare-io/cfctl/configurer"
 	"github.com/k0sproject/rig"
 	"github.com/k0sproject/rig/exec"
@@ -40,3 +44,49 @@ func (l *Alpine) InstallPackage(h os.Host, pkg ...string) error {
 func (l *Alpine) Prepare(h os.Host) error {
 	return l.InstallPackage(h, "findutils", "coreutils")
 }
+
+const (
+	crontabPath   = "/etc/crontabs/root"
+	backupCronTag = "# cfctl-backup"
+)
+
+// InstallBackupSchedule adds the backup script to the crontab of root and starts crond
+func (l *Alpine) InstallBackupSchedule(h os.Host, schedule cron.Schedule) error {
+	line := fmt.Sprintf("%s %s >> /var/log/cfctl-backup.log 2>&1 %s", schedule, l.BackupScriptPath(), backupCronTag)
+	if err := h.Execf(
+		`touch %[1]s && sed -i '/%[2]s$/d' %[1]s && echo %[3]s >> %[1]s`,
+		crontabPath,
+		backupCronTag,
+		shellescape.Quote(line),
+		exec.Sudo(h),
+	); err != nil {
+		return fmt.Errorf("update crontab: %w", err)
+	}
+	return h.Exec("rc-update add crond default && rc-service crond restart", exec.Sudo(h))
+}
+
+// RemoveBackupSchedule removes the backup script from the crontab of root
+func (l *Alpine) RemoveBackupSchedule(h os.Host) error {
+	return h.Execf(`sed -i '/%s$/d' %s`, backupCronTag, crontabPath, exec.Sudo(h))
+}
+
+// BackupScheduleStatus returns the schedule of the backup script and the state of crond
+func (l *Alpine) BackupScheduleStatus(h os.Host) (string, error) {
+	line, err := h.ExecOutputf(`grep '%s$' %s || true`, backupCronTag, crontabPath, exec.Sudo(h))
+	if err != nil {
+		return "", err
+	}
+	if line == "" {
+		return "not installed", nil
+	}
+	fields := strings.Fields(line)
+	schedule := fields[0]
+	if !strings.HasPrefix(schedule, "@") && len(fields) >= 5 {
+		schedule = strings.Join(fields[:5], " ")
+	}
+	state := "stopped"
+	if l.ServiceIsRunning(h, "crond") {
+		state = "running"
+	}
+	return fmt.Sprintf("cron %q, crond %s", schedule, state), nil
+}
@@ -0,0 +1,100 @@
+package github
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	k0sversion "github.com/k0sproject/version"
+)
+
+// k0sReleasesURL lists the releases of k0s, a page at a time
+var k0sReleasesURL = "https://api.github.com/repos/k0sproject/k0s/releases?per_page=100&page=%d"
+
+// k0sReleasesPages is the number of pages of releases fetched at most
+const k0sReleasesPages = 5
+
+// K0sReleases returns the versions of the stable k0s releases from github, oldest first
+func K0sReleases() (k0sversion.Collection, error) {
+	var versions k0sversion.Collection
+	for page := 1; page <= k0sReleasesPages; page++ {
+		var releases []Release
+		if err := unmarshalURLBody(fmt.Sprintf(k0sReleasesURL, page), &releases); err != nil {
+			return nil, fmt.Errorf("failed to fetch the k0s releases: %w", err)
+		}
+		if len(releases) == 0 {
+			break
+		}
+		for _, r := range releases {
+			if r.PreRelease {
+				continue
+			}
+			if v, err := k0sversion.NewVersion(r.TagName); err == nil {
+				versions = append(versions, v)
+			}
+		}
+	}
+	sort.Sort(versions)
+	return versions, nil
+}
+
+// ReadK0sIndex reads the versions of k0s from a local file or an http(s) url
+// of a mirror, listing a version per line, oldest first
+func ReadK0sIndex(location string) (k0sversion.Collection, error) {
+	var r io.ReadCloser
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		client := &http.Client{Timeout: timeOut}
+		resp, err := client.Get(location)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != 200 {
+			resp.Body.Close()
+			return nil, fmt.Errorf("backend returned http %d for %s", resp.StatusCode, location)
+		}
+		r = resp.Body
+	} else {
+		f, err := os.Open(location)
+		if err != nil {
+			return nil, err
+		}
+		r = f
+	}
+	defer r.Close()
+
+	versions, err := ParseK0sIndex(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", location, err)
+	}
+	return versions, nil
+}
+
+// ParseK0sIndex parses a list of k0s versions, one per line, ignoring empty
+// lines, comments starting with # and pre-releases
+func ParseK0sIndex(r io.Reader) (k0sversion.Collection, error) {
+	var versions k0sversion.Collection
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		s := strings.TrimSpace(scanner.Text())
+		if s == "" || strings.HasPrefix(s, "#") {
+			continue
+		}
+		v, err := k0sversion.NewVersion(s)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid k0s version %q: %w", line, s, err)
+		}
+		if v.Prerelease() != "" {
+			continue
+		}
+		versions = append(versions, v)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.Sort(versions)
+	return versions, nil
+}
@@ -0,0 +1,55 @@
+package github_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/deepsquare-io/cfctl/integration/github"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseK0sIndex(t *testing.T) {
+	versions, err := github.ParseK0sIndex(strings.NewReader(`
+# k0s mirror
+v1.28.4+k0s.0
+v1.27.8+k0s.0
+
+v1.29.0-rc.1+k0s.0
+`))
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	require.Equal(t, "v1.27.8+k0s.0", versions[0].String())
+
+	_, err = github.ParseK0sIndex(strings.NewReader("v1.28.4+k0s.0\nlatest\n"))
+	require.ErrorContains(t, err, "line 2")
+}
+
+func TestReadK0sIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index")
+	require.NoError(t, os.WriteFile(path, []byte("v1.28.4+k0s.0\n"), 0o644))
+	versions, err := github.ReadK0sIndex(path)
+	require.NoError(t, err)
+	require.Len(t, versions, 1)
+}
+
+func TestReadK0sIndexURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/k0s/index" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("v1.28.4+k0s.0\nv1.29.1+k0s.0\n"))
+	}))
+	defer srv.Close()
+
+	versions, err := github.ReadK0sIndex(srv.URL + "/k0s/index")
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+
+	_, err = github.ReadK0sIndex(srv.URL + "/missing")
+	require.ErrorContains(t, err, "http 404")
+}
@@ -1,14 +1,17 @@
 package phase
 
 import (
+	"bytes"
+	"context"
 	"fmt"
-	"os"
+	"io"
 	"path"
-	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1"
 	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1/cluster"
+	"github.com/deepsquare-io/cfctl/pkg/backup"
 	"github.com/k0sproject/rig/exec"
 	"github.com/k0sproject/version"
 	log "github.com/sirupsen/logrus"
@@ -22,6 +25,13 @@ var backupSinceVersion = version.MustConstraint(">= v1.21.0-rc.1+k0s.0")
 type Backup struct {
 	GenericPhase
 
+	// Destination stores the archive, defaults to the current directory
+	Destination backup.Destination
+	// Retention prunes the old archives of the destination
+	Retention backup.Retention
+	// Encrypter encrypts the archive when set
+	Encrypter backup.Encrypter
+
 	leader *cluster.Host
 }
 
@@ -45,6 +55,10 @@ func (p *Backup) Prepare(config *v1beta1.Cluster) error {
 
 	p.leader = leader
 	p.leader.Metadata.IsK0sLeader = true
+
+	if p.Destination == nil {
+		p.Destination = backup.NewLocal(".")
+	}
 	return nil
 }
 
@@ -109,26 +123,149 @@ func (p *Backup) Run() error {
 		}
 	}()
 
-	localFile, err := filepath.Abs(fmt.Sprintf("k0s_backup_%d.tar.gz", time.Now().Unix()))
+	createdAt := time.Now()
+	name := backup.ArchiveName(createdAt)
+	if p.Encrypter != nil {
+		name += "." + p.Encrypter.Encryption()
+	}
+
+	if !p.IsWet() {
+		if p.Encrypter != nil {
+			p.DryMsgf(nil, "encrypt the backup file with %s for %s", p.Encrypter.Encryption(), strings.Join(p.Encrypter.Recipients(), ", "))
+		}
+		p.DryMsgf(nil, "stream the backup file to %s as %s", p.Destination, name)
+		p.DryMsgf(nil, "write the manifest %s", backup.ManifestName(name))
+		if !p.Retention.IsZero() {
+			p.DryMsgf(nil, "prune the backups of %s to %s", p.Destination, p.Retention)
+		}
+		return nil
+	}
+
+	digest, contents, err := p.download(h, remotePath, name)
 	if err != nil {
 		return err
 	}
+	log.Infof("backup file written to %s/%s", strings.TrimSuffix(p.Destination.String(), "/"), name)
 
-	if p.IsWet() {
-		// Download the file
-		f, err := os.OpenFile(localFile, os.O_RDWR|os.O_CREATE|os.O_SYNC, 0600)
+	manifest := &backup.Manifest{
+		Archive:    name,
+		CreatedAt:  createdAt.UTC(),
+		Size:       digest.Size(),
+		SHA256:     digest.SHA256(),
+		K0sVersion: h.Metadata.K0sRunningVersion.String(),
+		ClusterID:  p.Config.Spec.K0s.Metadata.ClusterID,
+		Controller: h.Metadata.Hostname,
+	}
+	if contents != nil {
+		manifest.Components = contents.Components
+	}
+	if p.Encrypter != nil {
+		manifest.Encryption = p.Encrypter.Encryption()
+		manifest.Recipients = p.Encrypter.Recipients()
+	}
+	if err := p.writeManifest(manifest); err != nil {
+		return err
+	}
+
+	if !p.Retention.IsZero() {
+		pruned, err := p.Retention.Prune(context.Background(), p.Destination, time.Now())
+		for _, a := range pruned {
+			log.Infof("pruned backup file %s", a.Name)
+		}
 		if err != nil {
-			return err
+			log.Warnf("failed to prune the backups of %s: %s", p.Destination, err)
 		}
-		defer f.Close()
+	}
 
-		if err := h.Execf(`cat "%s"`, remotePath, exec.Writer(f)); err != nil {
-			return err
-		}
+	return nil
+}
 
-		log.Infof("backup file written to %s", localFile)
+// download streams the remote backup file to the destination without a local
+// copy, adding the backup.VersionFile to it and encrypting it on the way when
+// there is an encrypter. It returns the digest of the archive as stored and
+// its contents.
+func (p *Backup) download(h *cluster.Host, remotePath, name string) (*backup.Digest, *backup.Contents, error) {
+	pr, pw := io.Pipe()
+	catErr := make(chan error, 1)
+	go func() {
+		err := h.Execf(`cat "%s"`, remotePath, exec.Writer(pw))
+		_ = pw.CloseWithError(err)
+		catErr <- err
+	}()
+
+	// record the version of k0s in the archive while it is streamed
+	spr, spw := io.Pipe()
+	var contents *backup.Contents
+	stampErr := make(chan error, 1)
+	go func() {
+		c, err := backup.AddVersion(spw, pr, h.Metadata.K0sRunningVersion.String())
+		contents = c
+		_ = spw.CloseWithError(err)
+		// stop the transfer if the archive could not be read
+		_ = pr.CloseWithError(io.ErrClosedPipe)
+		stampErr <- err
+	}()
+	var src io.Reader = spr
+
+	encErr := make(chan error, 1)
+	if p.Encrypter == nil {
+		encErr <- nil
 	} else {
-		p.DryMsgf(nil, "download the backup file to local host as %s", localFile)
+		plain := src
+		epr, epw := io.Pipe()
+		go func() {
+			err := p.encrypt(epw, plain)
+			_ = epw.CloseWithError(err)
+			// stop the transfer if the encryption failed
+			_ = spr.CloseWithError(io.ErrClosedPipe)
+			encErr <- err
+		}()
+		src = epr
+	}
+
+	digest := backup.NewDigest()
+	err := p.Destination.Put(context.Background(), name, io.TeeReader(src, digest))
+	// stop the transfer if the destination failed before reading everything
+	if rc, ok := src.(*io.PipeReader); ok {
+		_ = rc.CloseWithError(io.ErrClosedPipe)
+	}
+	_ = spr.CloseWithError(io.ErrClosedPipe)
+	if eerr := <-encErr; err == nil && eerr != nil {
+		err = fmt.Errorf("encrypt: %w", eerr)
+	}
+	if serr := <-stampErr; err == nil && serr != nil {
+		err = fmt.Errorf("add the k0s version: %w", serr)
+	}
+	if cerr := <-catErr; err == nil && cerr != nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to write the backup to %s: %w", p.Destination, err)
+	}
+	return digest, contents, nil
+}
+
+func (p *Backup) encrypt(dst io.Writer, src io.Reader) error {
+	w, err := p.Encrypter.Encrypt(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, src); err != nil {
+		_ = w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// writeManifest stores the manifest next to the archive
+func (p *Backup) writeManifest(m *backup.Manifest) error {
+	data, err := m.Marshal()
+	if err != nil {
+		return err
+	}
+	if err := p.Destination.Put(context.Background(), backup.ManifestName(m.Archive), bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("failed to write the backup manifest to %s: %w", p.Destination, err)
 	}
+	log.Debugf("backup manifest written to %s/%s", strings.TrimSuffix(p.Destination.String(), "/"), backup.ManifestName(m.Archive))
 	return nil
 }
@@ -0,0 +1,334 @@
+package phase
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1"
+	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1/cluster"
+	"github.com/deepsquare-io/cfctl/pkg/backup"
+	"github.com/deepsquare-io/cfctl/pkg/cron"
+	"github.com/k0sproject/rig/exec"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	_ phase = &InstallBackupSchedule{}
+	_ phase = &BackupScheduleStatus{}
+	_ phase = &RemoveBackupSchedule{}
+)
+
+// backupIdentityFile is where the private key of sftp destinations is stored on the controllers
+const backupIdentityFile = "/etc/cfctl/backup_id"
+
+// backupKnownHostsFile pins the key of the sftp server on the controllers
+const backupKnownHostsFile = "/etc/cfctl/backup_known_hosts"
+
+// backupKeyDir holds the public keys of the gpg recipients of the scheduled backups
+const backupKeyDir = "/etc/cfctl/backup_keys"
+
+// InstallBackupSchedule installs the backup script and its timer on the
+// controllers. On every run, the controller getting the lease of the run takes
+// the backup and the others skip it, so that the backups go on when a
+// controller is lost.
+type InstallBackupSchedule struct {
+	GenericPhase
+
+	// Schedule is the cron schedule of the backups
+	Schedule cron.Schedule
+	// Destination receives the archives
+	Destination backup.Destination
+	// Retention prunes the old archives of the destination
+	Retention backup.Retention
+	// Encrypter encrypts the archives when set
+	Encrypter backup.Encrypter
+	// UploadIdentity allows copying the private key of a sftp destination to
+	// the controllers
+	UploadIdentity bool
+
+	leader      *cluster.Host
+	controllers cluster.Hosts
+	identity    []byte
+	knownHosts  string
+}
+
+// Title for the phase
+func (p *InstallBackupSchedule) Title() string {
+	return "Install backup schedule"
+}
+
+// Prepare the phase
+func (p *InstallBackupSchedule) Prepare(config *v1beta1.Cluster) error {
+	p.Config = config
+
+	if !backupSinceVersion.Check(p.Config.Spec.K0s.Version) {
+		return fmt.Errorf("the version of k0s on the host does not support taking backups")
+	}
+
+	p.leader = p.Config.Spec.K0sLeader()
+	if p.leader == nil || p.leader.Metadata.K0sRunningVersion == nil {
+		return fmt.Errorf("failed to find a running controller")
+	}
+
+	p.controllers = p.Config.Spec.Hosts.Controllers()
+
+	if d, ok := p.Destination.(*backup.SFTP); ok && d.IdentityFile != "" && !p.UploadIdentity {
+		return fmt.Errorf("the scheduled sftp backups copy the private key %s to the controllers, use --upload-identity to allow it, preferably with a key dedicated to the backups", d.IdentityFile)
+	}
+
+	return nil
+}
+
+// ShouldRun is true when there is a leader to install the schedule on
+func (p *InstallBackupSchedule) ShouldRun() bool {
+	return p.leader != nil
+}
+
+// Run the phase
+func (p *InstallBackupSchedule) Run() error {
+	if d, ok := p.Destination.(*backup.SFTP); ok && d.IdentityFile != "" {
+		data, err := os.ReadFile(d.IdentityFile)
+		if err != nil {
+			return fmt.Errorf("read the sftp identity file: %w", err)
+		}
+		p.identity = data
+
+		// the key of the server is verified here and pinned on the controllers
+		line, err := d.KnownHostsLine(context.Background())
+		if err != nil {
+			return fmt.Errorf("verify the key of the sftp server: %w", err)
+		}
+		p.knownHosts = line + "\n"
+		log.Warnf("the sftp private key %s is copied to %s on the controllers", d.IdentityFile, backupIdentityFile)
+	}
+
+	return p.parallelDo(p.controllers, p.install)
+}
+
+// install writes the backup script and its timer on a controller
+func (p *InstallBackupSchedule) install(h *cluster.Host) error {
+	required := []string{"sha256sum"}
+	if p.Encrypter != nil {
+		required = append(required, p.Encrypter.Encryption())
+	}
+	for _, cmd := range required {
+		if !h.Configurer.CommandExist(h, cmd) {
+			return fmt.Errorf("%s: the scheduled backups need the %s command on the controller", h, cmd)
+		}
+	}
+
+	var keyFiles []string
+	if p.Encrypter != nil {
+		keys, err := backup.PublicKeys(p.Encrypter)
+		if err != nil {
+			return err
+		}
+		for i, key := range keys {
+			f := path.Join(backupKeyDir, fmt.Sprintf("%d.asc", i))
+			err := p.Wet(h, fmt.Sprintf("upload the public key of %s to %s", p.Encrypter.Recipients()[i], f), func() error {
+				return h.Configurer.WriteFile(h, f, key, "0600")
+			})
+			if err != nil {
+				return err
+			}
+			keyFiles = append(keyFiles, f)
+		}
+	}
+
+	script, env, err := backup.Script{
+		BackupCommand:  h.Configurer.K0sCmdf(`backup --save-path "$BACKUP_DIR" --data-dir %s`, h.K0sDataDir()),
+		VersionCommand: h.Configurer.K0sCmdf("version"),
+		KubectlCommand: h.Configurer.KubectlCmdf(h, h.K0sDataDir(), `"$@"`),
+		Destination:    p.Destination,
+		Retention:      p.Retention,
+		Encrypter:      p.Encrypter,
+		GPGKeyFiles:    keyFiles,
+		ClusterID:      p.Config.Spec.K0s.Metadata.ClusterID,
+		Controller:     h.Metadata.Hostname,
+		EnvFile:        h.Configurer.BackupEnvPath(),
+		StatusFile:     h.Configurer.BackupStatusPath(),
+		IdentityFile:   backupIdentityFile,
+		KnownHostsFile: backupKnownHostsFile,
+	}.Render()
+	if err != nil {
+		return err
+	}
+
+	if p.identity != nil {
+		err := p.Wet(h, fmt.Sprintf("upload the sftp identity to %s and the key of the server to %s", backupIdentityFile, backupKnownHostsFile), func() error {
+			if err := h.Configurer.WriteFile(h, backupKnownHostsFile, p.knownHosts, "0600"); err != nil {
+				return err
+			}
+			return h.Configurer.WriteFile(h, backupIdentityFile, string(p.identity), "0600")
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	err = p.Wet(h, fmt.Sprintf("write the backup script to %s", h.Configurer.BackupScriptPath()), func() error {
+		if env != "" {
+			if err := h.Configurer.WriteFile(h, h.Configurer.BackupEnvPath(), env, "0600"); err != nil {
+				return err
+			}
+		} else if h.Configurer.FileExist(h, h.Configurer.BackupEnvPath()) {
+			if err := h.Configurer.DeleteFile(h, h.Configurer.BackupEnvPath()); err != nil {
+				return err
+			}
+		}
+		return h.Configurer.WriteFile(h, h.Configurer.BackupScriptPath(), script, "0700")
+	})
+	if err != nil {
+		return err
+	}
+
+	return p.Wet(h, fmt.Sprintf("schedule the backups at %q to %s, %s", p.Schedule, p.Destination, p.Retention), func() error {
+		if err := h.Configurer.InstallBackupSchedule(h, p.Schedule); err != nil {
+			return fmt.Errorf("failed to install the backup schedule: %w", err)
+		}
+		log.Infof("%s: backups scheduled at %q to %s", h, p.Schedule, p.Destination)
+		return nil
+	})
+}
+
+// removeBackupSchedule removes the timer, the script and its files from a controller
+func removeBackupSchedule(h *cluster.Host) error {
+	if err := h.Configurer.RemoveBackupSchedule(h); err != nil {
+		return fmt.Errorf("failed to remove the backup schedule: %w", err)
+	}
+	for _, f := range []string{h.Configurer.BackupScriptPath(), h.Configurer.BackupEnvPath(), backupIdentityFile, backupKnownHostsFile} {
+		if !h.Configurer.FileExist(h, f) {
+			continue
+		}
+		if err := h.Configurer.DeleteFile(h, f); err != nil {
+			log.Warnf("%s: failed to delete %s: %s", h, f, err)
+		}
+	}
+	if err := h.Exec(fmt.Sprintf("rm -rf -- %s", backupKeyDir), exec.Sudo(h)); err != nil {
+		log.Warnf("%s: failed to delete %s: %s", h, backupKeyDir, err)
+	}
+	log.Infof("%s: backup schedule removed", h)
+	return nil
+}
+
+// BackupScheduleStatus prints the state of the backup schedule of the controllers
+type BackupScheduleStatus struct {
+	GenericPhase
+
+	// Writer receives the status table
+	Writer io.Writer
+
+	hosts cluster.Hosts
+}
+
+// Title for the phase
+func (p *BackupScheduleStatus) Title() string {
+	return "Backup schedule status"
+}
+
+// Prepare the phase
+func (p *BackupScheduleStatus) Prepare(config *v1beta1.Cluster) error {
+	p.Config = config
+	p.hosts = p.Config.Spec.Hosts.Controllers()
+	return nil
+}
+
+// ShouldRun is true when there are controllers
+func (p *BackupScheduleStatus) ShouldRun() bool {
+	return len(p.hosts) > 0
+}
+
+// Run the phase
+func (p *BackupScheduleStatus) Run() error {
+	var mu sync.Mutex
+	rows := make(map[*cluster.Host][3]string, len(p.hosts))
+
+	err := p.parallelDo(p.hosts, func(h *cluster.Host) error {
+		schedule, err := h.Configurer.BackupScheduleStatus(h)
+		if err != nil {
+			return fmt.Errorf("failed to get the backup schedule status: %w", err)
+		}
+
+		last := "never"
+		if h.Configurer.FileExist(h, h.Configurer.BackupStatusPath()) {
+			out, err := h.ExecOutputf(`cat %s`, h.Configurer.BackupStatusPath(), exec.Sudo(h))
+			if err != nil {
+				return fmt.Errorf("failed to read the status of the last backup: %w", err)
+			}
+			last = lastBackupStatus(out)
+		}
+
+		mu.Lock()
+		rows[h] = [3]string{h.String(), schedule, last}
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(p.Writer, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "HOST\tSCHEDULE\tLAST RUN")
+	for _, h := range p.hosts {
+		row := rows[h]
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", row[0], row[1], row[2])
+	}
+	return tw.Flush()
+}
+
+// lastBackupStatus formats the status file written by the backup script
+func lastBackupStatus(status string) string {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(status, "\n") {
+		if k, v, ok := strings.Cut(strings.TrimSpace(line), "="); ok {
+			fields[k] = v
+		}
+	}
+	if fields["result"] == "" {
+		return "unknown"
+	}
+	s := fields["time"] + " " + fields["result"]
+	if fields["result"] == "success" && fields["archive"] != "" {
+		s += " (" + fields["archive"] + ")"
+	}
+	return s
+}
+
+// RemoveBackupSchedule removes the backup script and its timer from the controllers
+type RemoveBackupSchedule struct {
+	GenericPhase
+
+	hosts cluster.Hosts
+}
+
+// Title for the phase
+func (p *RemoveBackupSchedule) Title() string {
+	return "Remove backup schedule"
+}
+
+// Prepare the phase
+func (p *RemoveBackupSchedule) Prepare(config *v1beta1.Cluster) error {
+	p.Config = config
+	p.hosts = p.Config.Spec.Hosts.Controllers()
+	return nil
+}
+
+// ShouldRun is true when there are controllers
+func (p *RemoveBackupSchedule) ShouldRun() bool {
+	return len(p.hosts) > 0
+}
+
+// Run the phase
+func (p *RemoveBackupSchedule) Run() error {
+	return p.parallelDo(p.hosts, func(h *cluster.Host) error {
+		return p.Wet(h, "remove the backup schedule and script", func() error {
+			return removeBackupSchedule(h)
+		})
+	})
+}
@@ -0,0 +1,185 @@
+package phase
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1"
+	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1/cluster"
+	"github.com/deepsquare-io/cfctl/pkg/lock"
+	"github.com/k0sproject/rig/exec"
+	log "github.com/sirupsen/logrus"
+)
+
+// ClusterLock acquires a lease in kube-system locking the whole cluster when
+// spec.clusterLock is set, so that instances of cfctl working on disjoint
+// sets of hosts do not run at the same time. The lease is renewed in the
+// background and released with the host locks when Lock is canceled, or
+// earlier by ReleaseClusterLock
+type ClusterLock struct {
+	GenericPhase
+
+	// Lock is the host lock phase, which must run first
+	Lock *Lock
+
+	leader *cluster.Host
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Title for the phase
+func (p *ClusterLock) Title() string {
+	return "Acquire exclusive cluster lock"
+}
+
+// Prepare the phase
+func (p *ClusterLock) Prepare(config *v1beta1.Cluster) error {
+	p.Config = config
+	p.leader = p.Config.Spec.K0sLeader()
+	return nil
+}
+
+// ShouldRun is true when the cluster lock is enabled and the cluster is running
+func (p *ClusterLock) ShouldRun() bool {
+	return p.Config.Spec.ClusterLock && p.leader != nil && p.leader.Metadata.K0sRunningVersion != nil
+}
+
+// Run the phase
+func (p *ClusterLock) Run() error {
+	if err := p.acquire(); err != nil {
+		return err
+	}
+	log.Infof("%s: acquired the cluster lock lease %s/%s", p.leader, lock.LeaseNamespace, lock.LeaseName)
+	p.startTicker()
+	return nil
+}
+
+// kubectl returns a kubectl command run on the leader
+func (p *ClusterLock) kubectl(format string, args ...interface{}) string {
+	return p.leader.Configurer.KubectlCmdf(p.leader, p.leader.K0sDataDir(), format, args...)
+}
+
+// get returns the lease, nil when there is none
+func (p *ClusterLock) get() (*lock.Lease, error) {
+	return getLease(p.leader)
+}
+
+// getLease returns the cluster lock lease through a controller, nil when there is none
+func getLease(h *cluster.Host) (*lock.Lease, error) {
+	out, err := h.ExecOutput(h.Configurer.KubectlCmdf(h, h.K0sDataDir(), "-n %s get lease %s -o json --ignore-not-found", lock.LeaseNamespace, lock.LeaseName), exec.Sudo(h))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the cluster lock lease: %w", err)
+	}
+	if strings.TrimSpace(out) == "" {
+		return nil, nil
+	}
+	return lock.ParseLease([]byte(out))
+}
+
+// deleteLease deletes the cluster lock lease through a controller
+func deleteLease(h *cluster.Host) error {
+	return h.Exec(h.Configurer.KubectlCmdf(h, h.K0sDataDir(), "-n %s delete lease %s --ignore-not-found", lock.LeaseNamespace, lock.LeaseName), exec.Sudo(h))
+}
+
+// acquire creates the lease, or takes it over when it expired
+func (p *ClusterLock) acquire() error {
+	current, err := p.get()
+	if err != nil {
+		return err
+	}
+
+	lease, err := lock.NewLease(p.Lock.holder, time.Now())
+	if err != nil {
+		return err
+	}
+
+	verb := "create"
+	if current != nil {
+		holder := current.Holder()
+		if holder.ID != p.Lock.instanceID && !current.Expired(time.Now()) {
+			return fmt.Errorf("another instance of cfctl is currently operating on the cluster: locked by %s", holder)
+		}
+		// replacing the lease fails when it changed since it was read
+		lease.Metadata.ResourceVersion = current.Metadata.ResourceVersion
+		verb = "replace"
+	}
+
+	manifest, err := lease.Manifest()
+	if err != nil {
+		return err
+	}
+	if err := p.leader.Exec(p.kubectl("%s -f -", verb), exec.Stdin(manifest), exec.Sudo(p.leader)); err != nil {
+		if current, gerr := p.get(); gerr == nil && current != nil && current.Spec.HolderIdentity != p.Lock.instanceID {
+			return fmt.Errorf("another instance of cfctl is currently operating on the cluster: locked by %s", current.Holder())
+		}
+		return fmt.Errorf("failed to acquire the cluster lock lease: %w", err)
+	}
+	return nil
+}
+
+// startTicker renews the lease until the lock is canceled, then releases it
+func (p *ClusterLock) startTicker() {
+	ticker := time.NewTicker(10 * time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	p.Lock.track(cancel)
+	p.cancel = cancel
+	p.done = make(chan struct{})
+
+	go func() {
+		log.Debugf("%s: started periodic renewal of the cluster lock lease", p.leader)
+		for {
+			select {
+			case <-ticker.C:
+				patch := fmt.Sprintf(`{"spec":{"renewTime":%q}}`, lock.FormatTime(time.Now()))
+				if err := p.leader.Exec(p.kubectl("-n %s patch lease %s --type merge -p '%s'", lock.LeaseNamespace, lock.LeaseName, patch), exec.Sudo(p.leader)); err != nil {
+					log.Warnf("%s: failed to renew the cluster lock lease: %s", p.leader, err)
+				}
+			case <-ctx.Done():
+				ticker.Stop()
+				log.Debugf("%s: stopped cluster lock renewal, removing the lease", p.leader)
+				if err := p.release(); err != nil {
+					log.Warnf("%s: failed to release the cluster lock lease: %s", p.leader, err)
+				}
+				close(p.done)
+				p.Lock.wg.Done()
+				return
+			}
+		}
+	}()
+}
+
+// Held returns true when the lease was acquired and is renewed
+func (p *ClusterLock) Held() bool {
+	if p.done == nil {
+		return false
+	}
+	select {
+	case <-p.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// Release stops renewing the lease and deletes it
+func (p *ClusterLock) Release() {
+	if p.cancel == nil {
+		return
+	}
+	p.cancel()
+	<-p.done
+}
+
+// release deletes the lease unless another instance took it over
+func (p *ClusterLock) release() error {
+	current, err := p.get()
+	if err != nil {
+		return err
+	}
+	if current == nil || current.Spec.HolderIdentity != p.Lock.instanceID {
+		return nil
+	}
+	return deleteLease(p.leader)
+}
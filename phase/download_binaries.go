@@ -18,6 +18,9 @@ import (
 // DownloadBinaries downloads k0s binaries to localohost temp files
 type DownloadBinaries struct {
 	GenericPhase
+	// OnlyUpgrades limits the phase to the hosts that need an upgrade
+	OnlyUpgrades bool
+
 	hosts []*cluster.Host
 }
 
@@ -30,7 +33,7 @@ func (p *DownloadBinaries) Title() string {
 func (p *DownloadBinaries) Prepare(config *v1beta1.Cluster) error {
 	p.Config = config
 	p.hosts = p.Config.Spec.Hosts.Filter(func(h *cluster.Host) bool {
-		return !h.Reset && h.UploadBinary &&
+		return !h.Reset && h.UploadBinary && (!p.OnlyUpgrades || h.Metadata.NeedsUpgrade) &&
 			!h.Metadata.K0sBinaryVersion.Equal(config.Spec.K0s.Version)
 	})
 	return nil
@@ -13,6 +13,9 @@ import (
 // DownloadK0s performs k0s online download on the hosts
 type DownloadK0s struct {
 	GenericPhase
+	// OnlyUpgrades limits the phase to the hosts that need an upgrade
+	OnlyUpgrades bool
+
 	hosts cluster.Hosts
 }
 
@@ -31,6 +34,10 @@ func (p *DownloadK0s) Prepare(config *v1beta1.Cluster) error {
 			return false
 		}
 
+		if p.OnlyUpgrades && !h.Metadata.NeedsUpgrade {
+			return false
+		}
+
 		// No need to download, host is going to be reset
 		if h.Reset {
 			return false
@@ -73,6 +73,10 @@ func (p *InitializeK0s) Run() error {
 		h.InstallFlags.AddOrReplace("--force=true")
 	}
 
+	if err := p.runHooks(h, "install", "beforeJoin"); err != nil {
+		return err
+	}
+
 	log.Infof("%s: installing k0s controller", h)
 	cmd, err := h.K0sInstallCommand()
 	if err != nil {
@@ -158,5 +162,5 @@ func (p *InitializeK0s) Run() error {
 		}
 	}
 
-	return nil
+	return p.runHooks(h, "install", "afterJoin")
 }
@@ -131,6 +131,10 @@ func (p *InstallControllers) Run() error {
 		var token string
 		var tokenID string
 
+		if err := p.runHooks(h, "install", "beforeJoin"); err != nil {
+			return err
+		}
+
 		if p.IsWet() {
 			log.Infof("%s: generating token", p.leader)
 			token, err = p.Config.Spec.K0s.GenerateToken(
@@ -210,6 +214,10 @@ func (p *InstallControllers) Run() error {
 			}
 		}
 		h.Metadata.Ready = true
+
+		if err := p.runHooks(h, "install", "afterJoin"); err != nil {
+			return err
+		}
 	}
 
 	return nil
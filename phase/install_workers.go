@@ -175,6 +175,10 @@ func (p *InstallWorkers) Run() error {
 	}
 
 	return p.parallelDo(p.hosts, func(h *cluster.Host) error {
+		if err := p.runHooks(h, "install", "beforeJoin"); err != nil {
+			return err
+		}
+
 		err := p.Wet(
 			h,
 			fmt.Sprintf("write k0s join token to %s", h.K0sJoinTokenPath()),
@@ -271,6 +275,6 @@ func (p *InstallWorkers) Run() error {
 
 		h.Metadata.K0sRunningVersion = p.Config.Spec.K0s.Version
 
-		return nil
+		return p.runHooks(h, "install", "afterJoin")
 	})
 }
@@ -10,7 +10,9 @@ import (
 	"github.com/deepsquare-io/cfctl/analytics"
 	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1"
 	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1/cluster"
+	"github.com/deepsquare-io/cfctl/pkg/lock"
 	"github.com/deepsquare-io/cfctl/pkg/retry"
+	"github.com/deepsquare-io/cfctl/version"
 	"github.com/k0sproject/rig/exec"
 	log "github.com/sirupsen/logrus"
 )
@@ -20,6 +22,8 @@ type Lock struct {
 	GenericPhase
 	cfs        []func()
 	instanceID string
+	holder     *lock.Info
+	info       string
 	m          sync.Mutex
 	wg         sync.WaitGroup
 }
@@ -29,6 +33,12 @@ func (p *Lock) Prepare(c *v1beta1.Cluster) error {
 	p.Config = c
 	mid, _ := analytics.MachineID()
 	p.instanceID = fmt.Sprintf("%s-%d", mid, gos.Getpid())
+	p.holder = lock.New(p.instanceID, version.Version)
+	info, err := p.holder.Marshal()
+	if err != nil {
+		return err
+	}
+	p.info = info
 	return nil
 }
 
@@ -47,6 +57,14 @@ func (p *Lock) Cancel() {
 	p.wg.Wait()
 }
 
+// track registers a lock renewed in the background, released by Cancel
+func (p *Lock) track(cancel func()) {
+	p.m.Lock()
+	defer p.m.Unlock()
+	p.cfs = append(p.cfs, cancel)
+	p.wg.Add(1)
+}
+
 // CleanUp calls Cancel to release the lock
 func (p *Lock) CleanUp() {
 	p.Cancel()
@@ -100,7 +118,7 @@ func (p *Lock) startLock(h *cluster.Host) error {
 func (p *Lock) tryLock(h *cluster.Host) error {
 	lfp := h.Configurer.CfctlLockFilePath(h)
 
-	if err := h.Configurer.UpsertFile(h, lfp, p.instanceID); err != nil {
+	if err := h.Configurer.UpsertFile(h, lfp, p.info); err != nil {
 		stat, err := h.Configurer.Stat(h, lfp, exec.Sudo(h))
 		if err != nil {
 			return fmt.Errorf("lock file disappeared: %w", err)
@@ -109,9 +127,9 @@ func (p *Lock) tryLock(h *cluster.Host) error {
 		if err != nil {
 			return fmt.Errorf("failed to read lock file:  %w", err)
 		}
-		if content != p.instanceID {
-			if time.Since(stat.ModTime()) < 30*time.Second {
-				return fmt.Errorf("another instance of cfctl is currently operating on the host")
+		if info := lock.Parse(content); info.ID != p.instanceID {
+			if !lock.Expired(stat.ModTime()) {
+				return fmt.Errorf("another instance of cfctl is currently operating on the host: locked by %s, see cfctl lock status", info)
 			}
 			_ = h.Configurer.DeleteFile(h, lfp)
 			return fmt.Errorf("removed existing expired lock file")
@@ -0,0 +1,226 @@
+package phase
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1/cluster"
+	"github.com/deepsquare-io/cfctl/pkg/lock"
+	"github.com/k0sproject/rig/exec"
+	log "github.com/sirupsen/logrus"
+)
+
+// hostLock is the lock file of a host
+type hostLock struct {
+	path    string
+	info    *lock.Info
+	refresh time.Time
+}
+
+// expired returns true when the instance holding the lock stopped refreshing it
+func (l *hostLock) expired() bool {
+	return lock.Expired(l.refresh)
+}
+
+// readLock returns the lock file of a host, nil when the host is not locked
+func readLock(h *cluster.Host) (*hostLock, error) {
+	lfp := h.Configurer.CfctlLockFilePath(h)
+	if !h.Configurer.FileExist(h, lfp) {
+		return nil, nil
+	}
+	stat, err := h.Configurer.Stat(h, lfp, exec.Sudo(h))
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat lock file: %w", err)
+	}
+	content, err := h.Configurer.ReadFile(h, lfp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lock file: %w", err)
+	}
+	return &hostLock{path: lfp, info: lock.Parse(content), refresh: stat.ModTime()}, nil
+}
+
+// LockStatus prints the holders of the lock files of the hosts
+type LockStatus struct {
+	GenericPhase
+
+	// Writer receives the status table
+	Writer io.Writer
+}
+
+// Title for the phase
+func (p *LockStatus) Title() string {
+	return "Lock status"
+}
+
+// Run the phase
+func (p *LockStatus) Run() error {
+	var mu sync.Mutex
+	locks := make(map[*cluster.Host]*hostLock, len(p.Config.Spec.Hosts))
+
+	err := p.parallelDo(p.Config.Spec.Hosts, func(h *cluster.Host) error {
+		l, err := readLock(h)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		locks[h] = l
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var lease *lock.Lease
+	clusterLock := p.Config.Spec.ClusterLock
+	if clusterLock {
+		leader := p.Config.Spec.K0sLeader()
+		if lease, err = getLease(leader); err != nil {
+			log.Warnf("%s: %s", leader, err)
+			clusterLock = false
+		}
+	}
+
+	tw := tabwriter.NewWriter(p.Writer, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "HOST\tSTATE\tHOLDER\tCOMMAND\tSTARTED\tREFRESHED\tVERSION")
+	for _, h := range p.Config.Spec.Hosts {
+		l := locks[h]
+		if l == nil {
+			fmt.Fprintf(tw, "%s\tunlocked\t-\t-\t-\t-\t-\n", h)
+			continue
+		}
+		state := "locked"
+		if l.expired() {
+			state = "expired"
+		}
+		started := "-"
+		if !l.info.Started.IsZero() {
+			started = l.info.Started.Local().Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s ago\t%s\n",
+			h, state, l.info.Holder(), orDash(l.info.Command), started,
+			time.Since(l.refresh).Truncate(time.Second), orDash(l.info.Version),
+		)
+	}
+	if clusterLock {
+		writeLease(tw, lease)
+	}
+	return tw.Flush()
+}
+
+// writeLease writes the row of the cluster lock lease
+func writeLease(w io.Writer, lease *lock.Lease) {
+	if lease == nil || lease.Spec.HolderIdentity == "" {
+		fmt.Fprintln(w, "cluster\tunlocked\t-\t-\t-\t-\t-")
+		return
+	}
+	state := "locked"
+	if lease.Expired(time.Now()) {
+		state = "expired"
+	}
+	holder := lease.Holder()
+	started := "-"
+	if !holder.Started.IsZero() {
+		started = holder.Started.Local().Format(time.RFC3339)
+	}
+	refreshed := "-"
+	if renew, err := time.Parse(time.RFC3339, lease.Spec.RenewTime); err == nil {
+		refreshed = time.Since(renew).Truncate(time.Second).String() + " ago"
+	}
+	fmt.Fprintf(w, "cluster\t%s\t%s\t%s\t%s\t%s\t%s\n",
+		state, holder.Holder(), orDash(holder.Command), started, refreshed, orDash(holder.Version),
+	)
+}
+
+// ReleaseLock removes the lock files of the hosts left by the instances of
+// cfctl that were killed
+type ReleaseLock struct {
+	GenericPhase
+
+	// Force removes the locks still refreshed by a running instance
+	Force bool
+}
+
+// Title for the phase
+func (p *ReleaseLock) Title() string {
+	return "Release host lock"
+}
+
+// Run the phase
+func (p *ReleaseLock) Run() error {
+	var mu sync.Mutex
+	var held []string
+
+	err := p.parallelDo(p.Config.Spec.Hosts, func(h *cluster.Host) error {
+		l, err := readLock(h)
+		if err != nil {
+			return err
+		}
+		if l == nil {
+			log.Infof("%s: not locked", h)
+			return nil
+		}
+		if !l.expired() && !p.Force {
+			mu.Lock()
+			held = append(held, fmt.Sprintf("%s (locked by %s)", h, l.info))
+			mu.Unlock()
+			return nil
+		}
+		if !l.expired() {
+			log.Warnf("%s: releasing the lock held by %s", h, l.info)
+		}
+		return p.Wet(h, fmt.Sprintf("remove the lock file %s", l.path), func() error {
+			if err := h.Configurer.DeleteFile(h, l.path); err != nil {
+				return fmt.Errorf("failed to remove lock file: %w", err)
+			}
+			log.Infof("%s: lock released", h)
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	if p.Config.Spec.ClusterLock {
+		leader := p.Config.Spec.K0sLeader()
+		lease, err := getLease(leader)
+		if err != nil {
+			return err
+		}
+		switch {
+		case lease == nil:
+			log.Infof("%s: cluster not locked", leader)
+		case !lease.Expired(time.Now()) && !p.Force:
+			held = append(held, fmt.Sprintf("cluster (locked by %s)", lease.Holder()))
+		default:
+			err := p.Wet(leader, fmt.Sprintf("delete the cluster lock lease %s/%s", lock.LeaseNamespace, lock.LeaseName), func() error {
+				if err := deleteLease(leader); err != nil {
+					return fmt.Errorf("failed to delete the cluster lock lease: %w", err)
+				}
+				log.Infof("%s: cluster lock released", leader)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(held) > 0 {
+		sort.Strings(held)
+		return fmt.Errorf("hosts still locked by a running instance of cfctl, use --force to release them: %s", strings.Join(held, ", "))
+	}
+	return nil
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -84,6 +84,21 @@ func (m *Manager) AddPhase(p ...phase) {
 	m.phases = append(m.phases, p...)
 }
 
+// insertBefore queues phases to run before the first phase matching, for
+// phases adding phases while running
+func (m *Manager) insertBefore(match func(phase) bool, p ...phase) error {
+	for i, existing := range m.phases {
+		if match(existing) {
+			phases := make([]phase, 0, len(m.phases)+len(p))
+			phases = append(phases, m.phases[:i]...)
+			phases = append(phases, p...)
+			m.phases = append(phases, m.phases[i:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("no phase to insert %d phases before", len(p))
+}
+
 type errorfunc func() error
 
 // DryMsg prints a message in dry-run mode
@@ -162,7 +177,8 @@ func (m *Manager) Run() error {
 		}
 	}()
 
-	for _, p := range m.phases {
+	for i := 0; i < len(m.phases); i++ {
+		p := m.phases[i]
 		title := p.Title()
 
 		if p, ok := p.(withmanager); ok {
@@ -0,0 +1,84 @@
+package phase
+
+import (
+	"context"
+	"time"
+
+	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1"
+	"github.com/deepsquare-io/cfctl/pkg/notify"
+	"github.com/deepsquare-io/cfctl/version"
+	log "github.com/sirupsen/logrus"
+)
+
+var _ phase = &Notify{}
+
+// Notify sends the start event of an action to the notification webhooks.
+// It runs once the facts of the cluster are gathered, for the event to hold
+// the id of the cluster.
+type Notify struct {
+	GenericPhase
+
+	// Action is the operation such as "apply"
+	Action string
+}
+
+// Title for the phase
+func (p *Notify) Title() string {
+	return "Send notifications"
+}
+
+// ShouldRun is true when there are notification webhooks
+func (p *Notify) ShouldRun() bool {
+	return len(p.Config.Spec.Notifications) > 0
+}
+
+// DryRun reports the event without sending it
+func (p *Notify) DryRun() error {
+	p.DryMsgf(nil, "send the %s-%s event to the notification webhooks", p.Action, notify.StatusStart)
+	return nil
+}
+
+// Run the phase
+func (p *Notify) Run() error {
+	SendNotifications(p.Config, p.Action, notify.StatusStart, 0, nil)
+	return nil
+}
+
+// SendNotifications sends an event of an action to the notification webhooks
+// of the cluster, the failures are logged as warnings
+func SendNotifications(config *v1beta1.Cluster, action, status string, duration time.Duration, result error) {
+	if config == nil || config.Spec == nil || len(config.Spec.Notifications) == 0 {
+		return
+	}
+
+	event := &notify.Event{
+		Action:   action,
+		Status:   status,
+		Operator: notify.Operator(),
+		Version:  version.Version,
+		Time:     time.Now().UTC(),
+		Duration: duration.Seconds(),
+	}
+	if config.Metadata != nil {
+		event.Cluster = config.Metadata.Name
+	}
+	if config.Spec.K0s != nil {
+		event.ClusterID = config.Spec.K0s.Metadata.ClusterID
+	}
+	if result != nil {
+		event.Error = result.Error()
+	}
+
+	for _, n := range config.Spec.Notifications {
+		if !n.Wants(event.Name()) {
+			continue
+		}
+		webhook, err := n.Webhook()
+		if err == nil {
+			err = webhook.Send(context.Background(), event)
+		}
+		if err != nil {
+			log.Warnf("notification failed: %s", err)
+		}
+	}
+}
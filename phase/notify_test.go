@@ -0,0 +1,66 @@
+package phase
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1"
+	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1/cluster"
+	"github.com/deepsquare-io/cfctl/pkg/notify"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotify(t *testing.T) {
+	events := make(chan notify.Event, 4)
+	auth := make(chan string, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e notify.Event
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		auth <- r.Header.Get("Authorization")
+		events <- e
+	}))
+	defer srv.Close()
+	t.Setenv("CFCTL_TEST_WEBHOOK_TOKEN", "Bearer from-env")
+
+	cfg := &v1beta1.Cluster{
+		Metadata: &v1beta1.ClusterMetadata{Name: "hpc"},
+		Spec: &cluster.Spec{
+			K0s: &cluster.K0s{},
+			Notifications: []*cluster.Notification{
+				{URL: srv.URL, Headers: map[string]string{"Authorization": "env:CFCTL_TEST_WEBHOOK_TOKEN"}},
+				{URL: srv.URL, Events: []string{"apply-failure"}},
+			},
+		},
+	}
+
+	p := &Notify{Action: "apply"}
+	require.NoError(t, p.Prepare(cfg))
+	require.True(t, p.ShouldRun())
+
+	// the cluster id is gathered before the phase runs
+	cfg.Spec.K0s.Metadata.ClusterID = "kube-system:1234"
+	require.NoError(t, p.Run())
+	e := <-events
+	require.Equal(t, "Bearer from-env", <-auth)
+	require.Equal(t, "apply-start", e.Name())
+	require.Equal(t, "hpc", e.Cluster)
+	require.Equal(t, "kube-system:1234", e.ClusterID)
+	require.Zero(t, e.Duration)
+	require.Empty(t, events, "the second webhook only wants the failures")
+
+	cfg.Spec.Notifications[1].Events = nil
+	SendNotifications(cfg, "apply", notify.StatusFailure, 90*time.Second, errors.New("boom"))
+	for i := 0; i < 2; i++ {
+		e = <-events
+		require.Equal(t, "apply-failure", e.Name())
+		require.Equal(t, "boom", e.Error)
+		require.Equal(t, 90.0, e.Duration)
+	}
+}
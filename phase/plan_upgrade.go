@@ -0,0 +1,250 @@
+package phase
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/deepsquare-io/cfctl/integration/github"
+	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1"
+	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1/cluster"
+	"github.com/deepsquare-io/cfctl/pkg/node"
+	"github.com/deepsquare-io/cfctl/pkg/retry"
+	"github.com/k0sproject/version"
+	log "github.com/sirupsen/logrus"
+)
+
+// PlanUpgrade computes the path of an upgrade skipping k0s minor versions
+// through the latest release of every minor version in between, as the
+// kubernetes version skew policy requires, and queues an upgrade step for
+// every intermediate version before the binaries of the target version are
+// downloaded, or before the autopilot upgrade to the target version
+type PlanUpgrade struct {
+	GenericPhase
+
+	// AllowSkip upgrades to the target version directly
+	AllowSkip bool
+	// Index is a local file or an url listing the k0s versions, the github
+	// releases of k0s are used when empty
+	Index string
+	// NoDrain, Canary and PauseAfterCanary configure the worker upgrades of
+	// the intermediate steps, see UpgradeWorkers
+	NoDrain          bool
+	Canary           int
+	PauseAfterCanary func(canaries cluster.Hosts, remaining int) error
+
+	// Path holds the intermediate versions and the target version once planned
+	Path []*version.Version
+
+	from     *version.Version
+	releases func() (version.Collection, error)
+}
+
+// Title for the phase
+func (p *PlanUpgrade) Title() string {
+	return "Plan upgrade"
+}
+
+// Prepare the phase
+func (p *PlanUpgrade) Prepare(config *v1beta1.Cluster) error {
+	p.Config = config
+	p.from = nil
+	for _, h := range p.Config.Spec.Hosts {
+		if h.Reset || h.Metadata.K0sRunningVersion == nil {
+			continue
+		}
+		if p.from == nil || h.Metadata.K0sRunningVersion.LessThan(p.from) {
+			p.from = h.Metadata.K0sRunningVersion
+		}
+	}
+	if p.releases == nil {
+		p.releases = p.fetchReleases
+	}
+	return nil
+}
+
+// ShouldRun is true when the upgrade skips minor versions
+func (p *PlanUpgrade) ShouldRun() bool {
+	return p.from != nil && p.Config.Spec.K0s.Version != nil && skipsMinor(p.from, p.Config.Spec.K0s.Version)
+}
+
+// Run the phase
+func (p *PlanUpgrade) Run() error {
+	target := p.Config.Spec.K0s.Version
+	if p.AllowSkip {
+		log.Warnf("upgrading from k0s %s to %s directly, skipping minor versions, because --allow-skip given", p.from, target)
+		return nil
+	}
+
+	releases, err := p.releases()
+	if err != nil {
+		return fmt.Errorf("can't plan the upgrade from k0s %s to %s, use --allow-skip to upgrade directly: %w", p.from, target, err)
+	}
+	path, err := upgradePath(p.from, target, releases)
+	if err != nil {
+		return fmt.Errorf("%w, use --allow-skip to upgrade directly", err)
+	}
+	p.Path = path
+
+	steps := make([]string, 0, len(path)+1)
+	steps = append(steps, p.from.String())
+	for _, v := range path {
+		steps = append(steps, v.String())
+	}
+	log.Infof("upgrade path: %s", strings.Join(steps, " -> "))
+	if !p.IsWet() {
+		p.DryMsgf(nil, "upgrade k0s in %d steps: %s", len(path), strings.Join(steps, " -> "))
+	}
+
+	needsUpgrade := make(map[*cluster.Host]bool)
+	for _, h := range p.Config.Spec.Hosts {
+		needsUpgrade[h] = h.Metadata.NeedsUpgrade
+	}
+
+	var phases []phase
+	for i, v := range path[:len(path)-1] {
+		if p.Config.Spec.K0s.IsAutopilot() {
+			phases = append(phases, &UpgradeStep{Version: v, Wait: i > 0}, &UpgradeAutopilot{})
+			continue
+		}
+		phases = append(phases,
+			&UpgradeStep{Version: v, Wait: i > 0},
+			&DownloadBinaries{OnlyUpgrades: true},
+			&UploadK0s{OnlyUpgrades: true},
+			&DownloadK0s{OnlyUpgrades: true},
+			&UpgradeControllers{},
+			&UpgradeWorkers{NoDrain: p.NoDrain, Canary: p.Canary, PauseAfterCanary: p.PauseAfterCanary},
+		)
+	}
+	phases = append(phases, &UpgradeStep{Version: target, Wait: true, needsUpgrade: needsUpgrade})
+
+	return p.manager.insertBefore(func(next phase) bool {
+		switch next.(type) {
+		case *UpgradeAutopilot, *DownloadBinaries:
+			return true
+		}
+		return false
+	}, phases...)
+}
+
+// fetchReleases returns the k0s versions of the index or of github
+func (p *PlanUpgrade) fetchReleases() (version.Collection, error) {
+	if p.Index != "" {
+		return github.ReadK0sIndex(p.Index)
+	}
+	return github.K0sReleases()
+}
+
+// skipsMinor returns true when an upgrade from a version to another skips a minor version
+func skipsMinor(from, to *version.Version) bool {
+	fs, ts := from.Segments(), to.Segments()
+	return ts[0] > fs[0] || ts[1]-fs[1] > 1
+}
+
+// upgradePath returns the latest release of every minor version between two
+// versions followed by the target version
+func upgradePath(from, to *version.Version, releases version.Collection) ([]*version.Version, error) {
+	fs, ts := from.Segments(), to.Segments()
+	if fs[0] != ts[0] {
+		return nil, fmt.Errorf("can't plan an upgrade from k0s %s to %s across major versions", from, to)
+	}
+
+	var path []*version.Version
+	for minor := fs[1] + 1; minor < ts[1]; minor++ {
+		var latest *version.Version
+		for _, r := range releases {
+			rs := r.Segments()
+			if rs[0] == fs[0] && rs[1] == minor && (latest == nil || r.GreaterThan(latest)) {
+				latest = r
+			}
+		}
+		if latest == nil {
+			return nil, fmt.Errorf("can't plan the upgrade from k0s %s to %s: no release of k0s v%d.%d found", from, to, fs[0], minor)
+		}
+		path = append(path, latest)
+	}
+	return append(path, to), nil
+}
+
+// UpgradeStep sets the k0s version of an upgrade step, once the previous
+// step is complete and the cluster is ready
+type UpgradeStep struct {
+	GenericPhase
+
+	Version *version.Version
+	// Wait waits for the cluster to be ready after the previous step
+	Wait bool
+
+	// needsUpgrade restores the hosts to upgrade on the last step
+	needsUpgrade map[*cluster.Host]bool
+	leader       *cluster.Host
+}
+
+// Title for the phase
+func (p *UpgradeStep) Title() string {
+	return fmt.Sprintf("Upgrade to k0s %s", p.Version)
+}
+
+// Prepare the phase
+func (p *UpgradeStep) Prepare(config *v1beta1.Cluster) error {
+	p.Config = config
+	p.leader = p.Config.Spec.K0sLeader()
+	return nil
+}
+
+// DryRun sets the version without waiting for the cluster
+func (p *UpgradeStep) DryRun() error {
+	p.DryMsgf(nil, "upgrade to k0s %s", p.Version)
+	p.setVersion()
+	return nil
+}
+
+// Run the phase
+func (p *UpgradeStep) Run() error {
+	if p.Wait {
+		if err := p.waitReady(); err != nil {
+			return err
+		}
+	}
+	p.setVersion()
+	return nil
+}
+
+// setVersion records the versions the hosts run after the previous step and
+// marks the hosts to upgrade in this one
+func (p *UpgradeStep) setVersion() {
+	for _, h := range p.Config.Spec.Hosts {
+		if h.Reset || h.Metadata.K0sRunningVersion == nil {
+			continue
+		}
+		if h.Metadata.NeedsUpgrade && h.Metadata.K0sBinaryVersion != nil {
+			h.Metadata.K0sRunningVersion = h.Metadata.K0sBinaryVersion
+		}
+		h.Metadata.K0sBinaryTempFile = ""
+		if p.needsUpgrade != nil {
+			h.Metadata.NeedsUpgrade = p.needsUpgrade[h]
+		} else {
+			h.Metadata.NeedsUpgrade = p.Version.GreaterThan(h.Metadata.K0sRunningVersion)
+		}
+	}
+	p.Config.Spec.K0s.Version = p.Version
+}
+
+// waitReady waits for the system pods and the upgraded nodes to be ready,
+// even with --no-wait
+func (p *UpgradeStep) waitReady() error {
+	log.Infof("%s: waiting for system pods to become ready", p.leader)
+	if err := retry.Timeout(context.TODO(), retry.DefaultTimeout, node.SystemPodsRunningFunc(p.leader)); err != nil {
+		return fmt.Errorf("system pods not running after the upgrade step: %w", err)
+	}
+	for _, h := range p.Config.Spec.Hosts {
+		if h.Reset || h.Role == "controller" || !h.Metadata.NeedsUpgrade {
+			continue
+		}
+		log.Infof("%s: waiting for the node to become ready", h)
+		if err := retry.Timeout(context.TODO(), retry.DefaultTimeout, node.KubeNodeReadyFunc(h)); err != nil {
+			return fmt.Errorf("node %s not ready after the upgrade step: %w", h, err)
+		}
+	}
+	return nil
+}
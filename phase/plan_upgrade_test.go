@@ -0,0 +1,122 @@
+package phase
+
+import (
+	"testing"
+
+	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1"
+	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1/cluster"
+	"github.com/k0sproject/version"
+	"github.com/stretchr/testify/require"
+)
+
+func testReleases(t *testing.T) version.Collection {
+	releases, err := version.NewCollection(
+		"v1.26.9+k0s.0", "v1.26.10+k0s.0",
+		"v1.27.3+k0s.0", "v1.27.8+k0s.0",
+		"v1.28.4+k0s.0",
+		"v1.29.1+k0s.0",
+	)
+	require.NoError(t, err)
+	return releases
+}
+
+func TestUpgradePath(t *testing.T) {
+	from := version.MustParse("v1.26.9+k0s.0")
+	require.False(t, skipsMinor(from, version.MustParse("v1.27.3+k0s.0")))
+	require.True(t, skipsMinor(from, version.MustParse("v1.28.4+k0s.0")))
+
+	path, err := upgradePath(from, version.MustParse("v1.29.1+k0s.0"), testReleases(t))
+	require.NoError(t, err)
+	require.Equal(t, []string{"v1.27.8+k0s.0", "v1.28.4+k0s.0", "v1.29.1+k0s.0"}, versionStrings(path))
+
+	_, err = upgradePath(from, version.MustParse("v1.30.0+k0s.0"), testReleases(t)[:4])
+	require.ErrorContains(t, err, "no release of k0s v1.28 found")
+
+	_, err = upgradePath(from, version.MustParse("v2.0.0+k0s.0"), testReleases(t))
+	require.ErrorContains(t, err, "across major versions")
+}
+
+func versionStrings(versions []*version.Version) []string {
+	s := make([]string, len(versions))
+	for i, v := range versions {
+		s[i] = v.String()
+	}
+	return s
+}
+
+func TestPlanUpgrade(t *testing.T) {
+	controller := &cluster.Host{Role: "controller", Metadata: cluster.HostMetadata{
+		K0sRunningVersion: version.MustParse("v1.26.9+k0s.0"),
+		K0sBinaryVersion:  version.MustParse("v1.26.9+k0s.0"),
+		NeedsUpgrade:      true,
+	}}
+	worker := &cluster.Host{Role: "worker", Metadata: cluster.HostMetadata{
+		K0sRunningVersion: version.MustParse("v1.27.3+k0s.0"),
+		K0sBinaryVersion:  version.MustParse("v1.27.3+k0s.0"),
+		NeedsUpgrade:      true,
+	}}
+	target := version.MustParse("v1.29.1+k0s.0")
+	config := &v1beta1.Cluster{Spec: &cluster.Spec{
+		Hosts: cluster.Hosts{controller, worker},
+		K0s:   &cluster.K0s{Version: target},
+	}}
+
+	download := &DownloadBinaries{}
+	p := &PlanUpgrade{releases: func() (version.Collection, error) { return testReleases(t), nil }}
+	m := &Manager{Config: config}
+	m.AddPhase(p, download)
+	p.SetManager(m)
+	require.NoError(t, p.Prepare(config))
+	require.True(t, p.ShouldRun())
+	require.NoError(t, p.Run())
+	require.Equal(t, []string{"v1.27.8+k0s.0", "v1.28.4+k0s.0", "v1.29.1+k0s.0"}, versionStrings(p.Path))
+
+	// plan, 2 intermediate steps of 6 phases, the last step, download
+	require.Len(t, m.phases, 1+2*6+1+1)
+	require.Same(t, download, m.phases[len(m.phases)-1])
+	first := m.phases[1].(*UpgradeStep)
+	require.Equal(t, "v1.27.8+k0s.0", first.Version.String())
+	require.False(t, first.Wait)
+	last := m.phases[len(m.phases)-2].(*UpgradeStep)
+	require.Equal(t, target, last.Version)
+
+	first.Config = config
+	first.setVersion()
+	require.Equal(t, "v1.27.8+k0s.0", config.Spec.K0s.Version.String())
+	require.True(t, controller.Metadata.NeedsUpgrade)
+	require.True(t, worker.Metadata.NeedsUpgrade)
+
+	// the controller was upgraded to the first step, the worker was not
+	controller.Metadata.K0sBinaryVersion = version.MustParse("v1.27.8+k0s.0")
+	worker.Metadata.NeedsUpgrade = false
+	second := m.phases[7].(*UpgradeStep)
+	second.Config = config
+	second.setVersion()
+	require.Equal(t, "v1.27.8+k0s.0", controller.Metadata.K0sRunningVersion.String())
+	require.Equal(t, "v1.28.4+k0s.0", config.Spec.K0s.Version.String())
+	require.True(t, worker.Metadata.NeedsUpgrade)
+
+	last.Config = config
+	last.setVersion()
+	require.Equal(t, target, config.Spec.K0s.Version)
+	require.True(t, controller.Metadata.NeedsUpgrade)
+	require.True(t, worker.Metadata.NeedsUpgrade)
+}
+
+func TestPlanUpgradeAllowSkip(t *testing.T) {
+	config := &v1beta1.Cluster{Spec: &cluster.Spec{
+		Hosts: cluster.Hosts{{Role: "controller", Metadata: cluster.HostMetadata{K0sRunningVersion: version.MustParse("v1.26.9+k0s.0")}}},
+		K0s:   &cluster.K0s{Version: version.MustParse("v1.29.1+k0s.0")},
+	}}
+	p := &PlanUpgrade{AllowSkip: true, releases: func() (version.Collection, error) { return nil, nil }}
+	m := &Manager{Config: config}
+	m.AddPhase(p)
+	p.SetManager(m)
+	require.NoError(t, p.Prepare(config))
+	require.True(t, p.ShouldRun())
+	require.NoError(t, p.Run())
+	require.Len(t, m.phases, 1)
+
+	p.AllowSkip = false
+	require.ErrorContains(t, p.Run(), "use --allow-skip")
+}
@@ -0,0 +1,32 @@
+package phase
+
+import (
+	log "github.com/sirupsen/logrus"
+)
+
+// ReleaseClusterLock releases the cluster lock lease before the cluster
+// holding it is reset, the lease can neither be renewed nor deleted once the
+// leader is reset. The host locks are still held until Unlock.
+type ReleaseClusterLock struct {
+	GenericPhase
+
+	// ClusterLock is the phase that acquired the lease
+	ClusterLock *ClusterLock
+}
+
+// Title for the phase
+func (p *ReleaseClusterLock) Title() string {
+	return "Release exclusive cluster lock"
+}
+
+// ShouldRun is true when the cluster lock lease is held
+func (p *ReleaseClusterLock) ShouldRun() bool {
+	return p.ClusterLock != nil && p.ClusterLock.Held()
+}
+
+// Run the phase
+func (p *ReleaseClusterLock) Run() error {
+	log.Infof("%s: releasing the cluster lock lease before the reset", p.ClusterLock.leader)
+	p.ClusterLock.Release()
+	return nil
+}
@@ -48,16 +48,24 @@ func (p *ResetControllers) ShouldRun() bool {
 	return len(p.hosts) > 0
 }
 
+// DryRun reports what would happen if Run is called.
+func (p *ResetControllers) DryRun() error {
+	for _, h := range p.hosts {
+		p.DryMsg(h, "reset k0s and remove its configuration")
+	}
+	return nil
+}
+
 // Run the phase
 func (p *ResetControllers) Run() error {
 	for _, h := range p.hosts {
 		log.Debugf("%s: draining node", h)
-		if !p.NoDrain && h.Role != "controller" {
+		if !p.NoDrain && h.ShouldDrain() && h.Role != "controller" {
 			if err := p.leader.DrainNode(&cluster.Host{
 				Metadata: cluster.HostMetadata{
 					Hostname: h.Metadata.Hostname,
 				},
-			}); err != nil {
+			}, nil); err != nil {
 				log.Warnf("%s: failed to drain node: %s", h, err.Error())
 			}
 		}
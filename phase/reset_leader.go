@@ -29,6 +29,17 @@ func (p *ResetLeader) Prepare(config *v1beta1.Cluster) error {
 	return nil
 }
 
+// ShouldRun is true when the leader is marked for reset
+func (p *ResetLeader) ShouldRun() bool {
+	return p.leader != nil && p.leader.Reset
+}
+
+// DryRun reports what would happen if Run is called.
+func (p *ResetLeader) DryRun() error {
+	p.DryMsg(p.leader, "reset k0s and remove its configuration")
+	return nil
+}
+
 // Run the phase
 func (p *ResetLeader) Run() error {
 	if p.leader.Configurer.ServiceIsRunning(p.leader, p.leader.K0sServiceName()) {
@@ -47,16 +47,24 @@ func (p *ResetWorkers) ShouldRun() bool {
 	return len(p.hosts) > 0
 }
 
+// DryRun reports what would happen if Run is called.
+func (p *ResetWorkers) DryRun() error {
+	for _, h := range p.hosts {
+		p.DryMsg(h, "reset k0s and remove its configuration")
+	}
+	return nil
+}
+
 // Run the phase
 func (p *ResetWorkers) Run() error {
 	return p.parallelDo(p.hosts, func(h *cluster.Host) error {
 		log.Debugf("%s: draining node", h)
-		if !p.NoDrain {
+		if !p.NoDrain && h.ShouldDrain() {
 			if err := p.leader.DrainNode(&cluster.Host{
 				Metadata: cluster.HostMetadata{
 					Hostname: h.Metadata.Hostname,
 				},
-			}); err != nil {
+			}, nil); err != nil {
 				log.Warnf("%s: failed to drain node: %s", h, err.Error())
 			}
 		}
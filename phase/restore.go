@@ -2,10 +2,13 @@ package phase
 
 import (
 	"fmt"
+	"os"
 	"path"
 
+	"filippo.io/age"
 	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1"
 	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1/cluster"
+	"github.com/deepsquare-io/cfctl/pkg/backup"
 	"github.com/k0sproject/rig/exec"
 	log "github.com/sirupsen/logrus"
 )
@@ -14,7 +17,10 @@ type Restore struct {
 	GenericPhase
 
 	RestoreFrom string
-	leader      *cluster.Host
+	// AgeIdentities decrypt the age encrypted archives
+	AgeIdentities []age.Identity
+
+	leader *cluster.Host
 }
 
 // Title for the phase
@@ -47,8 +53,20 @@ func (p *Restore) Prepare(config *v1beta1.Cluster) error {
 	return nil
 }
 
+// DryRun reports what would happen if Run is called.
+func (p *Restore) DryRun() error {
+	p.DryMsgf(p.leader, "restore the cluster state from %s", p.RestoreFrom)
+	return nil
+}
+
 // Run the phase
 func (p *Restore) Run() error {
+	archive, cleanup, err := p.plainArchive()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
 	// Push the backup file to controller
 	h := p.leader
 	tmpDir, err := h.Configurer.TempDir(h)
@@ -56,7 +74,7 @@ func (p *Restore) Run() error {
 		return err
 	}
 	dstFile := path.Join(tmpDir, "k0s_backup.tar.gz")
-	if err := h.Upload(p.RestoreFrom, dstFile); err != nil {
+	if err := h.Upload(archive, dstFile); err != nil {
 		return err
 	}
 
@@ -78,3 +96,22 @@ func (p *Restore) Run() error {
 
 	return nil
 }
+
+// plainArchive returns the path of the archive to upload, decrypted into a
+// temporary file when encrypted. The archive was verified by ValidateRestore.
+func (p *Restore) plainArchive() (string, func(), error) {
+	if backup.EncryptionOf(p.RestoreFrom) == "" {
+		return p.RestoreFrom, func() {}, nil
+	}
+
+	log.Infof("decrypting %s", p.RestoreFrom)
+	plain, err := backup.DecryptFile(p.RestoreFrom, p.AgeIdentities)
+	if err != nil {
+		return "", nil, err
+	}
+	return plain, func() {
+		if err := os.Remove(plain); err != nil {
+			log.Warnf("failed to remove the decrypted backup file %s: %s", plain, err)
+		}
+	}, nil
+}
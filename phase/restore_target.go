@@ -0,0 +1,101 @@
+package phase
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1"
+	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1/cluster"
+	log "github.com/sirupsen/logrus"
+)
+
+// ValidateRestoreTarget makes sure that the hosts a cluster is restored onto
+// do not run k0s or hold the state of a previous cluster. With Reset, such
+// hosts are marked for reset instead.
+type ValidateRestoreTarget struct {
+	GenericPhase
+
+	Reset bool
+}
+
+// Title for the phase
+func (p *ValidateRestoreTarget) Title() string {
+	return "Validate restore target hosts"
+}
+
+// Run the phase
+func (p *ValidateRestoreTarget) Run() error {
+	var dirty []string
+	for _, h := range p.Config.Spec.Hosts {
+		reason := p.dirty(h)
+		if reason == "" {
+			continue
+		}
+		if p.Reset {
+			log.Warnf("%s: %s, it will be reset", h, reason)
+			h.Reset = true
+			continue
+		}
+		log.Errorf("%s: %s", h, reason)
+		dirty = append(dirty, h.String())
+	}
+
+	if len(dirty) > 0 {
+		return fmt.Errorf("can't restore onto hosts with an existing k0s state (%s), use --reset to wipe them first", strings.Join(dirty, ", "))
+	}
+	return nil
+}
+
+// dirty returns why a host can't be restored onto, empty when it can
+func (p *ValidateRestoreTarget) dirty(h *cluster.Host) string {
+	if h.Metadata.K0sRunningVersion != nil {
+		return fmt.Sprintf("k0s %s is running", h.Metadata.K0sRunningVersion)
+	}
+	if h.IsController() && h.Configurer.FileExist(h, path.Join(h.K0sDataDir(), "pki", "ca.crt")) {
+		return fmt.Sprintf("the data directory %s holds the state of a previous cluster", h.K0sDataDir())
+	}
+	return ""
+}
+
+// RejoinResetHosts forgets the k0s state of the hosts reset by the reset
+// phases so that the install phases set them up again, joining the restored
+// cluster with fresh tokens
+type RejoinResetHosts struct {
+	GenericPhase
+
+	hosts cluster.Hosts
+}
+
+// Title for the phase
+func (p *RejoinResetHosts) Title() string {
+	return "Prepare reset hosts for rejoining"
+}
+
+// Prepare the phase
+func (p *RejoinResetHosts) Prepare(config *v1beta1.Cluster) error {
+	p.Config = config
+	p.hosts = p.Config.Spec.Hosts.Filter(func(h *cluster.Host) bool {
+		return h.Reset
+	})
+	return nil
+}
+
+// ShouldRun is true when hosts were reset
+func (p *RejoinResetHosts) ShouldRun() bool {
+	return len(p.hosts) > 0
+}
+
+// Run the phase
+func (p *RejoinResetHosts) Run() error {
+	for _, h := range p.hosts {
+		h.Reset = false
+		h.Metadata.K0sRunningVersion = nil
+		h.Metadata.K0sInstalled = false
+		h.Metadata.K0sExistingConfig = ""
+		h.Metadata.NeedsUpgrade = false
+		h.Metadata.Ready = false
+		log.Debugf("%s: will be set up again", h)
+	}
+	return nil
+}
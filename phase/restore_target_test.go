@@ -0,0 +1,41 @@
+package phase
+
+import (
+	"testing"
+
+	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1"
+	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1/cluster"
+	"github.com/k0sproject/version"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateRestoreTarget(t *testing.T) {
+	running := &cluster.Host{
+		Role: "worker",
+		Metadata: cluster.HostMetadata{
+			K0sRunningVersion: version.MustParse("1.28.4+k0s.0"),
+			K0sInstalled:      true,
+			Ready:             true,
+		},
+	}
+	fresh := &cluster.Host{Role: "worker"}
+	cfg := &v1beta1.Cluster{Spec: &cluster.Spec{Hosts: cluster.Hosts{running, fresh}}}
+
+	p := &ValidateRestoreTarget{GenericPhase: GenericPhase{Config: cfg}}
+	require.ErrorContains(t, p.Run(), "use --reset")
+	require.False(t, running.Reset)
+
+	p.Reset = true
+	require.NoError(t, p.Run())
+	require.True(t, running.Reset)
+	require.False(t, fresh.Reset)
+
+	rejoin := &RejoinResetHosts{}
+	require.NoError(t, rejoin.Prepare(cfg))
+	require.True(t, rejoin.ShouldRun())
+	require.NoError(t, rejoin.Run())
+	require.False(t, running.Reset)
+	require.Nil(t, running.Metadata.K0sRunningVersion)
+	require.False(t, running.Metadata.K0sInstalled)
+	require.False(t, running.Metadata.Ready)
+}
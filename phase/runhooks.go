@@ -1,13 +1,26 @@
 package phase
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
+	osexec "os/exec"
+	"path"
+	"sort"
+	"strings"
+	"time"
 
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
 
+	"github.com/adrg/xdg"
+	"github.com/alessio/shellescape"
 	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1"
 	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1/cluster"
+	"github.com/k0sproject/rig/exec"
+	"github.com/sergi/go-diff/diffmatchpatch"
+	log "github.com/sirupsen/logrus"
 )
 
 var _ phase = &RunHooks{}
@@ -28,6 +41,7 @@ func (p *RunHooks) Title() string {
 
 // Prepare digs out the hosts with steps from the config
 func (p *RunHooks) Prepare(config *v1beta1.Cluster) error {
+	p.Config = config
 	p.hosts = config.Spec.Hosts.Filter(func(h *cluster.Host) bool {
 		return len(h.Hooks.ForActionAndStage(p.Action, p.Stage)) > 0
 	})
@@ -42,18 +56,213 @@ func (p *RunHooks) ShouldRun() bool {
 
 // Run does all the prep work on the hosts in parallel
 func (p *RunHooks) Run() error {
-	return p.hosts.ParallelEach(p.runHooksForHost)
+	return p.hosts.ParallelEach(func(h *cluster.Host) error {
+		return p.runHooks(h, p.Action, p.Stage)
+	})
 }
 
-func (p *RunHooks) runHooksForHost(h *cluster.Host) error {
-	steps := h.Hooks.ForActionAndStage(p.Action, p.Stage)
-	for _, s := range steps {
-		err := p.Wet(h, fmt.Sprintf("run hook: `%s`", s), func() error {
-			return h.Exec(s)
+// runHooks runs the hooks of a host for an action and a stage, in order,
+// applying their failure policies
+func (p *GenericPhase) runHooks(h *cluster.Host, action, stage string) error {
+	for _, hook := range h.Hooks.ForActionAndStage(action, stage) {
+		err := p.Wet(h, fmt.Sprintf("run %s.%s hook: `%s`", action, stage, hook), func() error {
+			return p.runHook(h, hook, action+"."+stage)
+		}, func() error {
+			if hook.IsScript() {
+				return p.diffScripts(h, hook, action+"."+stage)
+			}
+			return nil
 		})
+		if err == nil {
+			continue
+		}
+		switch hook.Policy() {
+		case cluster.HookWarn:
+			log.Warnf("%s: %s.%s hook `%s` failed: %s", h, action, stage, hook, err)
+		case cluster.HookIgnore:
+			log.Debugf("%s: ignoring failure of %s.%s hook `%s`: %s", h, action, stage, hook, err)
+		default:
+			return fmt.Errorf("%s.%s hook `%s` failed: %w", action, stage, hook, err)
+		}
+	}
+	return nil
+}
+
+// runHook runs a hook once
+func (p *GenericPhase) runHook(h *cluster.Host, hook *cluster.Hook, stage string) error {
+	env := p.hookEnv(h, stage)
+
+	if hook.Local != "" {
+		ctx := context.Background()
+		if hook.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, hook.Timeout)
+			defer cancel()
+		}
+		cmd := osexec.CommandContext(ctx, "sh", "-c", hook.Local)
+		// the children of the shell may keep the output open after it is killed
+		cmd.WaitDelay = time.Second
+		cmd.Env = os.Environ()
+		for _, k := range sortedKeys(env) {
+			cmd.Env = append(cmd.Env, k+"="+env[k])
+		}
+		out, err := cmd.CombinedOutput()
+		if output := strings.TrimSpace(string(out)); output != "" {
+			log.Infof("%s: %s: %s", h, hook, output)
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("timed out after %s", hook.Timeout)
+		}
+		return err
+	}
+
+	if hook.IsScript() {
+		return p.runScripts(h, hook, stage, env)
+	}
+
+	exports := make([]string, 0, len(env))
+	for _, k := range sortedKeys(env) {
+		exports = append(exports, k+"="+shellescape.Quote(env[k]))
+	}
+	script := "export " + strings.Join(exports, " ") + "; " + hook.Remote
+	if hook.Timeout > 0 {
+		script = fmt.Sprintf("timeout %d sh -c %s", hook.TimeoutSeconds(), shellescape.Quote(script))
+	}
+	return h.Exec(script)
+}
+
+// runScripts uploads the scripts of a hook to a temporary directory of the
+// host, runs them in order and removes them
+func (p *GenericPhase) runScripts(h *cluster.Host, hook *cluster.Hook, stage string, env map[string]string) error {
+	scripts, err := hook.LoadScripts()
+	if err != nil {
+		return err
+	}
+
+	dir, err := h.Configurer.TempDir(h)
+	if err != nil {
+		return fmt.Errorf("failed to create a temporary directory: %w", err)
+	}
+	var uploaded []string
+	defer func() {
+		for _, f := range uploaded {
+			if err := h.Configurer.DeleteFile(h, f); err != nil {
+				log.Warnf("%s: failed to delete hook script %s: %s", h, f, err)
+			}
+		}
+		if err := h.Configurer.DeleteDir(h, dir, exec.Sudo(h)); err != nil {
+			log.Warnf("%s: failed to delete hook script directory %s: %s", h, dir, err)
+		}
+	}()
+
+	for _, script := range scripts {
+		remotePath := path.Join(dir, script.Name)
+		if err := h.Configurer.WriteFile(h, remotePath, script.Content, "0755"); err != nil {
+			return fmt.Errorf("failed to upload %s: %w", script.Name, err)
+		}
+		uploaded = append(uploaded, remotePath)
+
+		var opts []exec.Option
+		if hook.Sudo {
+			opts = append(opts, exec.Sudo(h))
+		}
+		log.Debugf("%s: running hook script %s", h, script.Name)
+		out, err := h.ExecOutput(scriptCmd(hook, remotePath, env), opts...)
+		if output := strings.TrimSpace(out); output != "" {
+			log.Infof("%s: %s: %s", h, script.Name, output)
+		}
 		if err != nil {
-			return err
+			return fmt.Errorf("script %s: %w", script.Name, err)
+		}
+		p.saveScript(h, stage, script)
+	}
+	return nil
+}
+
+// scriptCmd returns the command running a script uploaded to the host
+func scriptCmd(hook *cluster.Hook, remotePath string, env map[string]string) string {
+	args := []string{"env"}
+	for _, k := range sortedKeys(env) {
+		args = append(args, k+"="+shellescape.Quote(env[k]))
+	}
+	args = append(args, hook.InterpreterOrDefault(), shellescape.Quote(remotePath))
+	if hook.Timeout > 0 {
+		args = append([]string{"timeout", fmt.Sprintf("%d", hook.TimeoutSeconds())}, args...)
+	}
+	return strings.Join(args, " ")
+}
+
+// scriptCachePath returns the path of the local copy of the last run of a
+// hook script on a host
+func (p *GenericPhase) scriptCachePath(h *cluster.Host, stage, name string) string {
+	clusterName := "cfctl"
+	if p.Config != nil && p.Config.Metadata != nil && p.Config.Metadata.Name != "" {
+		clusterName = p.Config.Metadata.Name
+	}
+	return path.Join("cfctl", "hooks", clusterName, h.Address(), stage, name)
+}
+
+// saveScript keeps a local copy of a script run on a host to show the
+// changes in the next dry runs
+func (p *GenericPhase) saveScript(h *cluster.Host, stage string, script *cluster.HookScript) {
+	fn, err := xdg.CacheFile(p.scriptCachePath(h, stage, script.Name))
+	if err == nil {
+		err = os.WriteFile(fn, []byte(script.Content), 0o600)
+	}
+	if err != nil {
+		log.Debugf("%s: failed to save a copy of hook script %s: %s", h, script.Name, err)
+	}
+}
+
+// diffScripts prints the changes of the scripts of a hook since their last
+// run on the host
+func (p *GenericPhase) diffScripts(h *cluster.Host, hook *cluster.Hook, stage string) error {
+	scripts, err := hook.LoadScripts()
+	if err != nil {
+		return err
+	}
+	dmp := diffmatchpatch.New()
+	for _, script := range scripts {
+		var previous string
+		if fn, err := xdg.SearchCacheFile(p.scriptCachePath(h, stage, script.Name)); err == nil {
+			if content, err := os.ReadFile(fn); err == nil {
+				previous = string(content)
+			}
 		}
+		if previous == script.Content {
+			p.DryMsgf(h, "hook script %s is unchanged since its last run", script.Name)
+			continue
+		}
+		diffs := dmp.DiffMain(previous, script.Content, false)
+		p.DryMsgf(h, "hook script %s changes:\n%s", script.Name, dmp.DiffPrettyText(diffs))
 	}
 	return nil
 }
+
+// hookEnv returns the environment of the hooks of a host
+func (p *GenericPhase) hookEnv(h *cluster.Host, stage string) map[string]string {
+	env := map[string]string{
+		"CFCTL_HOST":     h.Address(),
+		"CFCTL_ROLE":     h.Role,
+		"CFCTL_HOSTNAME": h.Metadata.Hostname,
+		"CFCTL_PHASE":    stage,
+	}
+	if p.Config != nil {
+		if p.Config.Metadata != nil {
+			env["CFCTL_CLUSTER"] = p.Config.Metadata.Name
+		}
+		if p.Config.Spec.K0s.Version != nil {
+			env["CFCTL_K0S_VERSION"] = p.Config.Spec.K0s.Version.String()
+		}
+	}
+	return env
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,87 @@
+package phase
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1"
+	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1/cluster"
+	"github.com/k0sproject/version"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunLocalHooks(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "env")
+	h := &cluster.Host{Role: "worker", Metadata: cluster.HostMetadata{Hostname: "worker-0"}}
+	config := &v1beta1.Cluster{
+		Metadata: &v1beta1.ClusterMetadata{Name: "prod"},
+		Spec: &cluster.Spec{
+			Hosts: cluster.Hosts{h},
+			K0s:   &cluster.K0s{Version: version.MustParse("v1.28.4+k0s.0")},
+		},
+	}
+	p := &GenericPhase{Config: config, manager: &Manager{}}
+
+	h.Hooks = cluster.Hooks{"upgrade": {"afterReady": {
+		{Local: "env | grep ^CFCTL_ | sort > " + out},
+	}}}
+	require.NoError(t, p.runHooks(h, "upgrade", "afterReady"))
+	env, err := os.ReadFile(out)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"CFCTL_CLUSTER=prod",
+		"CFCTL_HOST=127.0.0.1",
+		"CFCTL_HOSTNAME=worker-0",
+		"CFCTL_K0S_VERSION=v1.28.4+k0s.0",
+		"CFCTL_PHASE=upgrade.afterReady",
+		"CFCTL_ROLE=worker",
+	}, strings.Fields(string(env)))
+
+	t.Run("failure policies", func(t *testing.T) {
+		h.Hooks = cluster.Hooks{"apply": {"before": {
+			{Local: "exit 1", OnFailure: cluster.HookIgnore},
+			{Local: "exit 2", OnFailure: cluster.HookWarn},
+		}}}
+		require.NoError(t, p.runHooks(h, "apply", "before"))
+
+		h.Hooks["apply"]["before"] = append(h.Hooks["apply"]["before"], &cluster.Hook{Local: "exit 3"})
+		err := p.runHooks(h, "apply", "before")
+		require.ErrorContains(t, err, "apply.before hook `local: exit 3` failed")
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		h.Hooks = cluster.Hooks{"apply": {"after": {
+			{Local: "sleep 5", Timeout: 100 * time.Millisecond},
+		}}}
+		start := time.Now()
+		err := p.runHooks(h, "apply", "after")
+		require.ErrorContains(t, err, "timed out after 100ms")
+		require.Less(t, time.Since(start), 5*time.Second)
+	})
+
+	t.Run("dry-run", func(t *testing.T) {
+		dry := &GenericPhase{Config: config, manager: &Manager{DryRun: true}}
+		h.Hooks = cluster.Hooks{"apply": {"after": {{Local: "exit 1"}}}}
+		require.NoError(t, dry.runHooks(h, "apply", "after"))
+	})
+}
+
+func TestScriptCmd(t *testing.T) {
+	env := map[string]string{"CFCTL_ROLE": "worker", "CFCTL_HOST": "10.0.0.1"}
+	require.Equal(t,
+		"env CFCTL_HOST=10.0.0.1 CFCTL_ROLE=worker sh /tmp/x/10-first.sh",
+		scriptCmd(&cluster.Hook{Script: "hooks"}, "/tmp/x/10-first.sh", env),
+	)
+	require.Equal(t,
+		"timeout 30 env CFCTL_HOST=10.0.0.1 CFCTL_ROLE=worker bash '/tmp/x/my script.sh'",
+		scriptCmd(&cluster.Hook{Script: "hooks", Interpreter: "bash", Timeout: 30 * time.Second}, "/tmp/x/my script.sh", env),
+	)
+	require.Equal(t,
+		"timeout 2 env sh /tmp/x/a.sh",
+		scriptCmd(&cluster.Hook{Script: "hooks", Timeout: 1500 * time.Millisecond}, "/tmp/x/a.sh", nil),
+		"the timeout is rounded up, timeout 1 would stop the script too early and timeout 0 never",
+	)
+}
@@ -0,0 +1,127 @@
+package phase
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1"
+	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1/cluster"
+	"github.com/deepsquare-io/cfctl/pkg/kubeconfig"
+	"github.com/deepsquare-io/cfctl/pkg/retry"
+	"github.com/k0sproject/rig/exec"
+	log "github.com/sirupsen/logrus"
+)
+
+// SignUserCertificate gets a client certificate for a user signed by the
+// cluster. The private key of the user never leaves the local host.
+type SignUserCertificate struct {
+	GenericPhase
+
+	User   string
+	Groups []string
+	// Expiry is the validity of the certificate
+	Expiry time.Duration
+	// Role is a cluster role bound to the user when set
+	Role string
+	// Namespace scopes the binding of Role, the binding is cluster wide when empty
+	Namespace string
+
+	// Certificate and Key are the PEM encoded certificate and private key, set by Run
+	Certificate []byte
+	Key         []byte
+
+	leader *cluster.Host
+}
+
+// Title for the phase
+func (p *SignUserCertificate) Title() string {
+	return "Sign user certificate"
+}
+
+// Prepare the phase
+func (p *SignUserCertificate) Prepare(config *v1beta1.Cluster) error {
+	p.Config = config
+	p.leader = p.Config.Spec.Hosts.Controllers()[0]
+	if p.Expiry < kubeconfig.MinExpiry {
+		return fmt.Errorf("the expiry of a user certificate can not be shorter than %s", kubeconfig.MinExpiry)
+	}
+	if err := kubeconfig.ValidateGroups(p.Groups); err != nil {
+		return err
+	}
+	return nil
+}
+
+// DryRun reports what would happen if Run is called.
+func (p *SignUserCertificate) DryRun() error {
+	p.DryMsgf(p.leader, "sign a client certificate for user %s valid for %s", p.User, p.Expiry)
+	if p.Role != "" {
+		p.DryMsgf(p.leader, "bind the cluster role %s to user %s", p.Role, p.User)
+	}
+	return nil
+}
+
+// Run the phase
+func (p *SignUserCertificate) Run() error {
+	h := p.leader
+
+	keyPEM, csrPEM, err := kubeconfig.UserCertificateRequest(p.User, p.Groups)
+	if err != nil {
+		return err
+	}
+
+	name := kubeconfig.ObjectName(fmt.Sprintf("cfctl-%s-%d", p.User, time.Now().Unix()))
+	csr, err := kubeconfig.CSRManifest(name, csrPEM, p.Expiry)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("%s: signing a certificate for user %s (groups: %s) valid for %s", h, p.User, strings.Join(p.Groups, ", "), p.Expiry)
+	if err := h.Exec(h.Configurer.KubectlCmdf(h, h.K0sDataDir(), "apply -f -"), exec.Stdin(csr), exec.Sudo(h)); err != nil {
+		return fmt.Errorf("create certificate signing request: %w", err)
+	}
+	defer func() {
+		if err := h.Exec(h.Configurer.KubectlCmdf(h, h.K0sDataDir(), "delete csr %s", name), exec.Sudo(h)); err != nil {
+			log.Warnf("%s: failed to delete the certificate signing request %s: %s", h, name, err)
+		}
+	}()
+
+	if err := h.Exec(h.Configurer.KubectlCmdf(h, h.K0sDataDir(), "certificate approve %s", name), exec.Sudo(h)); err != nil {
+		return fmt.Errorf("approve certificate signing request: %w", err)
+	}
+
+	var certPEM []byte
+	err = retry.Timeout(context.TODO(), retry.DefaultTimeout, func(_ context.Context) error {
+		out, err := h.ExecOutput(h.Configurer.KubectlCmdf(h, h.K0sDataDir(), "get csr %s -o 'jsonpath={.status.certificate}'", name), exec.Sudo(h))
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(out) == "" {
+			return errors.New("the certificate is not issued yet")
+		}
+		certPEM, err = base64.StdEncoding.DecodeString(strings.TrimSpace(out))
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("get signed certificate: %w", err)
+	}
+
+	if p.Role != "" {
+		binding, err := kubeconfig.RoleBindingManifest(p.Namespace, p.Role, p.User)
+		if err != nil {
+			return err
+		}
+		log.Infof("%s: binding the cluster role %s to user %s", h, p.Role, p.User)
+		if err := h.Exec(h.Configurer.KubectlCmdf(h, h.K0sDataDir(), "apply -f -"), exec.Stdin(binding), exec.Sudo(h)); err != nil {
+			return fmt.Errorf("bind role: %w", err)
+		}
+	}
+
+	p.Certificate = certPEM
+	p.Key = keyPEM
+
+	return nil
+}
@@ -0,0 +1,235 @@
+package phase
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1"
+	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1/cluster"
+	"github.com/deepsquare-io/cfctl/pkg/autopilot"
+	"github.com/deepsquare-io/cfctl/pkg/retry"
+	"github.com/k0sproject/rig/exec"
+	log "github.com/sirupsen/logrus"
+)
+
+// UpgradeAutopilot upgrades k0s with a k0s autopilot plan instead of
+// replacing the binaries over ssh, when spec.k0s.upgradeStrategy is
+// "autopilot"
+type UpgradeAutopilot struct {
+	GenericPhase
+
+	hosts  cluster.Hosts
+	leader *cluster.Host
+	// states are the last reported states of the nodes by name
+	states map[string]string
+}
+
+// Title for the phase
+func (p *UpgradeAutopilot) Title() string {
+	return "Upgrade with autopilot"
+}
+
+// Prepare the phase
+func (p *UpgradeAutopilot) Prepare(config *v1beta1.Cluster) error {
+	p.Config = config
+	p.leader = p.Config.Spec.K0sLeader()
+	p.hosts = nil
+	if !p.Config.Spec.K0s.IsAutopilot() {
+		return nil
+	}
+	p.hosts = p.Config.Spec.Hosts.Filter(func(h *cluster.Host) bool {
+		return !h.Reset && h.Metadata.NeedsUpgrade
+	})
+	return nil
+}
+
+// ShouldRun is true when k0s is upgraded with autopilot and hosts need an upgrade
+func (p *UpgradeAutopilot) ShouldRun() bool {
+	return len(p.hosts) > 0
+}
+
+// DryRun reports the plan without applying it
+func (p *UpgradeAutopilot) DryRun() error {
+	plan, err := p.plan()
+	if err != nil {
+		return err
+	}
+	if _, err := plan.Manifest(); err != nil {
+		return err
+	}
+	p.DryMsgf(p.leader, "apply an autopilot plan upgrading %d hosts to k0s %s", len(p.hosts), p.Config.Spec.K0s.Version)
+	for _, h := range p.hosts {
+		p.DryMsgf(h, "upgrade to k0s %s by autopilot", p.Config.Spec.K0s.Version)
+	}
+	p.upgraded(p.hosts)
+	return nil
+}
+
+// Run the phase
+func (p *UpgradeAutopilot) Run() error {
+	if !cluster.SupportsAutopilot(p.leader.Metadata.K0sRunningVersion) {
+		return fmt.Errorf("%s: k0s %s does not support autopilot upgrades, set spec.k0s.upgradeStrategy to ssh", p.leader, p.leader.Metadata.K0sRunningVersion)
+	}
+
+	plan, err := p.plan()
+	if err != nil {
+		return err
+	}
+	manifest, err := plan.Manifest()
+	if err != nil {
+		return err
+	}
+
+	current, err := p.status()
+	if err != nil {
+		return err
+	}
+	if current != nil && !current.Status.Done() {
+		return fmt.Errorf("autopilot plan %s is still running (%s), wait for it to complete or delete it", current.Spec.ID, current.Status.State)
+	}
+
+	log.Infof("%s: applying autopilot plan %s upgrading %d hosts to k0s %s", p.leader, plan.Spec.ID, len(p.hosts), p.Config.Spec.K0s.Version)
+	if err := p.leader.Exec(p.kubectl("delete plan %s --ignore-not-found", autopilot.PlanName), exec.Sudo(p.leader)); err != nil {
+		return fmt.Errorf("failed to delete the previous autopilot plan: %w", err)
+	}
+	if err := p.leader.Exec(p.kubectl("apply -f -"), exec.Stdin(manifest), exec.Sudo(p.leader)); err != nil {
+		return fmt.Errorf("failed to apply the autopilot plan: %w", err)
+	}
+
+	status, err := p.wait(plan.Spec.ID)
+	if err != nil {
+		return err
+	}
+	if status.State != autopilot.StateCompleted {
+		incomplete := status.Incomplete()
+		if len(incomplete) > 0 {
+			return fmt.Errorf("autopilot plan %s ended in state %s, nodes not upgraded: %s", plan.Spec.ID, status.State, strings.Join(incomplete, ", "))
+		}
+		return fmt.Errorf("autopilot plan %s ended in state %s", plan.Spec.ID, status.State)
+	}
+
+	log.Infof("%s: autopilot plan %s completed", p.leader, plan.Spec.ID)
+	p.upgraded(p.hosts)
+	return nil
+}
+
+// plan returns the autopilot plan upgrading the hosts
+func (p *UpgradeAutopilot) plan() (*autopilot.Plan, error) {
+	config := p.Config.Spec.K0s.AutopilotConfig()
+	v := p.Config.Spec.K0s.Version
+	opts := autopilot.PlanOptions{
+		Version:        v,
+		Platforms:      make(map[string]string),
+		WorkerSelector: config.WorkerSelector,
+	}
+
+	var workers int
+	for _, h := range p.hosts {
+		arch := h.Metadata.Arch
+		if _, ok := opts.Platforms["linux-"+arch]; !ok {
+			url, err := autopilot.BinaryURL(config.BinaryURL, v, "linux", arch)
+			if err != nil {
+				return nil, err
+			}
+			opts.Platforms["linux-"+arch] = url
+		}
+		if h.IsController() {
+			opts.Controllers = append(opts.Controllers, h.NodeName())
+		} else {
+			opts.Workers = append(opts.Workers, h.NodeName())
+			workers++
+		}
+	}
+	var size cluster.BatchSize
+	if p.Config.Spec.Upgrade != nil {
+		size = p.Config.Spec.Upgrade.BatchSize
+	}
+	opts.Concurrent = size.Of(workers)
+
+	return autopilot.NewPlan(opts, time.Now()), nil
+}
+
+// kubectl returns a kubectl command run on the leader
+func (p *UpgradeAutopilot) kubectl(format string, args ...interface{}) string {
+	return p.leader.Configurer.KubectlCmdf(p.leader, p.leader.K0sDataDir(), format, args...)
+}
+
+// status returns the autopilot plan of the cluster, nil when there is none
+func (p *UpgradeAutopilot) status() (*autopilot.Plan, error) {
+	out, err := p.leader.ExecOutput(p.kubectl("get plan %s -o json --ignore-not-found", autopilot.PlanName), exec.Sudo(p.leader))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the autopilot plan: %w", err)
+	}
+	if strings.TrimSpace(out) == "" {
+		return nil, nil
+	}
+	return autopilot.ParsePlan([]byte(out))
+}
+
+// wait polls the status of the plan until it is done, logging the progress of the nodes
+func (p *UpgradeAutopilot) wait(id string) (autopilot.PlanStatus, error) {
+	timeout := p.Config.Spec.K0s.AutopilotConfig().Timeout
+	log.Infof("%s: waiting up to %s for the autopilot plan to complete", p.leader, timeout)
+
+	p.states = make(map[string]string)
+	var status autopilot.PlanStatus
+	err := retry.Timeout(context.TODO(), timeout, func(_ context.Context) error {
+		plan, err := p.status()
+		if err != nil {
+			return err
+		}
+		if plan == nil || plan.Spec.ID != id {
+			return fmt.Errorf("autopilot plan %s not found", id)
+		}
+		status = plan.Status
+		p.report(status)
+		if !status.Done() {
+			return fmt.Errorf("autopilot plan %s is %s", id, status.State)
+		}
+		return nil
+	})
+	if err != nil {
+		if incomplete := status.Incomplete(); len(incomplete) > 0 {
+			return status, fmt.Errorf("autopilot plan %s did not complete, nodes not upgraded: %s: %w", id, strings.Join(incomplete, ", "), err)
+		}
+		return status, fmt.Errorf("autopilot plan %s did not complete: %w", id, err)
+	}
+	return status, nil
+}
+
+// report logs the nodes whose state changed
+func (p *UpgradeAutopilot) report(status autopilot.PlanStatus) {
+	for name, state := range status.Nodes() {
+		if p.states[name] == state {
+			continue
+		}
+		p.states[name] = state
+		if h := p.host(name); h != nil {
+			log.Infof("%s: autopilot: %s", h, state)
+		} else {
+			log.Infof("%s: autopilot: %s", name, state)
+		}
+	}
+}
+
+// host returns the host of a node
+func (p *UpgradeAutopilot) host(name string) *cluster.Host {
+	for _, h := range p.Config.Spec.Hosts {
+		if h.NodeName() == name {
+			return h
+		}
+	}
+	return nil
+}
+
+// upgraded records the hosts as running the target version, so they are not
+// upgraded over ssh
+func (p *UpgradeAutopilot) upgraded(hosts cluster.Hosts) {
+	for _, h := range hosts {
+		h.Metadata.K0sBinaryVersion = p.Config.Spec.K0s.Version
+		h.Metadata.K0sRunningVersion = p.Config.Spec.K0s.Version
+		h.Metadata.NeedsUpgrade = false
+	}
+}
@@ -0,0 +1,47 @@
+package phase
+
+import (
+	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1"
+	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1/cluster"
+	log "github.com/sirupsen/logrus"
+)
+
+// UpgradeBackup takes a backup before the first controller is upgraded
+type UpgradeBackup struct {
+	Backup
+
+	skip bool
+}
+
+// Title returns the title for the phase
+func (p *UpgradeBackup) Title() string {
+	return "Take pre-upgrade backup"
+}
+
+// Prepare the phase
+func (p *UpgradeBackup) Prepare(config *v1beta1.Cluster) error {
+	p.Config = config
+
+	var controllers cluster.Hosts = p.Config.Spec.Hosts.Controllers()
+	upgrading := controllers.Filter(func(h *cluster.Host) bool {
+		return !h.Reset && h.Metadata.NeedsUpgrade
+	})
+	if len(upgrading) == 0 {
+		p.skip = true
+		return nil
+	}
+
+	leader := p.Config.Spec.K0sLeader()
+	if leader.Metadata.K0sRunningVersion == nil || !backupSinceVersion.Check(leader.Metadata.K0sRunningVersion) {
+		log.Warnf("%s: k0s %s can not take backups, skipping the pre-upgrade backup", leader, leader.Metadata.K0sRunningVersion)
+		p.skip = true
+		return nil
+	}
+
+	return p.Backup.Prepare(config)
+}
+
+// ShouldRun is true when controllers are going to be upgraded
+func (p *UpgradeBackup) ShouldRun() bool {
+	return !p.skip && p.Backup.ShouldRun()
+}
@@ -0,0 +1,38 @@
+package phase
+
+import (
+	"testing"
+
+	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1"
+	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1/cluster"
+	"github.com/k0sproject/version"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpgradeBackupShouldRun(t *testing.T) {
+	leader := &cluster.Host{
+		Role: "controller",
+		Metadata: cluster.HostMetadata{
+			K0sBinaryVersion:  version.MustParse("1.27.4+k0s.0"),
+			K0sRunningVersion: version.MustParse("1.27.4+k0s.0"),
+		},
+	}
+	cfg := &v1beta1.Cluster{Spec: &cluster.Spec{
+		Hosts: cluster.Hosts{leader},
+		K0s:   &cluster.K0s{Version: version.MustParse("1.28.4+k0s.0")},
+	}}
+
+	p := &UpgradeBackup{}
+	require.NoError(t, p.Prepare(cfg))
+	require.False(t, p.ShouldRun(), "no controller needs an upgrade")
+
+	leader.Metadata.NeedsUpgrade = true
+	p = &UpgradeBackup{}
+	require.NoError(t, p.Prepare(cfg))
+	require.True(t, p.ShouldRun())
+
+	leader.Metadata.K0sRunningVersion = version.MustParse("1.20.6+k0s.0")
+	p = &UpgradeBackup{}
+	require.NoError(t, p.Prepare(cfg))
+	require.False(t, p.ShouldRun(), "k0s can not take backups")
+}
@@ -2,7 +2,9 @@ package phase
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1"
@@ -58,67 +60,31 @@ func (p *UpgradeControllers) CleanUp() {
 
 // Run the phase
 func (p *UpgradeControllers) Run() error {
+	var upgraded []string
 	for _, h := range p.hosts {
 		if !h.Configurer.FileExist(h, h.Metadata.K0sBinaryTempFile) {
 			return fmt.Errorf("k0s binary tempfile not found on host")
 		}
 		log.Infof("%s: starting upgrade", h)
-		log.Debugf("%s: stop service", h)
-		err := p.Wet(h, "stop k0s service", func() error {
-			if err := h.Configurer.StopService(h, h.K0sServiceName()); err != nil {
-				return err
-			}
-			if err := retry.Timeout(context.TODO(), retry.DefaultTimeout, node.ServiceStoppedFunc(h, h.K0sServiceName())); err != nil {
-				return fmt.Errorf("wait for k0s service stop: %w", err)
-			}
-			return nil
-		})
-		if err != nil {
+
+		if err := p.runHooks(h, "upgrade", "before"); err != nil {
 			return err
 		}
 
-		log.Debugf("%s: update binary", h)
-		err = p.Wet(h, "replace k0s binary", func() error {
-			return h.UpdateK0sBinary(h.Metadata.K0sBinaryTempFile, p.Config.Spec.K0s.Version)
-		})
+		log.Debugf("%s: keep the current binary", h)
+		err := p.Wet(h, fmt.Sprintf("keep the current k0s binary as %s", h.K0sPreviousBinaryPath()), h.KeepK0sBinary)
 		if err != nil {
 			return err
 		}
 
-		if len(h.Environment) > 0 {
-			log.Infof("%s: updating service environment", h)
-			err := p.Wet(h, "update service environment", func() error {
-				return h.Configurer.UpdateServiceEnvironment(h, h.K0sServiceName(), h.Environment)
-			})
-			if err != nil {
-				return err
-			}
+		if err := p.upgrade(h); err != nil {
+			return p.rollback(h, upgraded, err)
 		}
+		upgraded = append(upgraded, h.String())
 
-		log.Debugf("%s: restart service", h)
-		err = p.Wet(h, "start k0s service with the new binary", func() error {
-			if err := h.Configurer.StartService(h, h.K0sServiceName()); err != nil {
-				return err
-			}
-			log.Infof("%s: waiting for the k0s service to start", h)
-			if err := retry.Timeout(context.TODO(), retry.DefaultTimeout, node.ServiceRunningFunc(h, h.K0sServiceName())); err != nil {
-				return fmt.Errorf("k0s service start: %w", err)
-			}
-			return nil
-		})
-		if err != nil {
+		if err := p.runHooks(h, "upgrade", "afterReady"); err != nil {
 			return err
 		}
-		port := 6443
-		if p, ok := p.Config.Spec.K0s.Config.Dig("spec", "api", "port").(int); ok {
-			port = p
-		}
-
-		if p.IsWet() {
-			if err := retry.Timeout(context.TODO(), retry.DefaultTimeout, node.KubeAPIReadyFunc(h, port)); err != nil {
-				return fmt.Errorf("kube api did not become ready: %w", err)
-			}
-		}
 	}
 
 	leader := p.Config.Spec.K0sLeader()
@@ -151,3 +117,124 @@ func (p *UpgradeControllers) Run() error {
 
 	return nil
 }
+
+// upgrade replaces the binary of a controller and waits for it to come back
+func (p *UpgradeControllers) upgrade(h *cluster.Host) error {
+	log.Debugf("%s: stop service", h)
+	err := p.Wet(h, "stop k0s service", func() error {
+		if err := h.Configurer.StopService(h, h.K0sServiceName()); err != nil {
+			return err
+		}
+		if err := retry.Timeout(context.TODO(), retry.DefaultTimeout, node.ServiceStoppedFunc(h, h.K0sServiceName())); err != nil {
+			return fmt.Errorf("wait for k0s service stop: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("%s: update binary", h)
+	err = p.Wet(h, "replace k0s binary", func() error {
+		return h.UpdateK0sBinary(h.Metadata.K0sBinaryTempFile, p.Config.Spec.K0s.Version)
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(h.Environment) > 0 {
+		log.Infof("%s: updating service environment", h)
+		err := p.Wet(h, "update service environment", func() error {
+			return h.Configurer.UpdateServiceEnvironment(h, h.K0sServiceName(), h.Environment)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Debugf("%s: restart service", h)
+	err = p.Wet(h, "start k0s service with the new binary", func() error {
+		return p.start(h)
+	})
+	if err != nil {
+		return err
+	}
+
+	if p.IsWet() {
+		return p.waitReady(h)
+	}
+	return nil
+}
+
+// start starts the k0s service and waits for it to run
+func (p *UpgradeControllers) start(h *cluster.Host) error {
+	if err := h.Configurer.StartService(h, h.K0sServiceName()); err != nil {
+		return err
+	}
+	log.Infof("%s: waiting for the k0s service to start", h)
+	if err := retry.Timeout(context.TODO(), retry.DefaultTimeout, node.ServiceRunningFunc(h, h.K0sServiceName())); err != nil {
+		return fmt.Errorf("k0s service start: %w", err)
+	}
+	return nil
+}
+
+// waitReady waits for the kube api of the controller and, when it runs
+// workloads, for its node to become ready
+func (p *UpgradeControllers) waitReady(h *cluster.Host) error {
+	port := 6443
+	if p, ok := p.Config.Spec.K0s.Config.Dig("spec", "api", "port").(int); ok {
+		port = p
+	}
+
+	if err := retry.Timeout(context.TODO(), retry.DefaultTimeout, node.KubeAPIReadyFunc(h, port)); err != nil {
+		return fmt.Errorf("kube api did not become ready: %w", err)
+	}
+
+	if h.Role != "controller" && !NoWait {
+		log.Infof("%s: waiting for the node to become ready", h)
+		if err := retry.Timeout(context.TODO(), retry.DefaultTimeout, node.KubeNodeReadyFunc(h)); err != nil {
+			return fmt.Errorf("node did not become ready: %w", err)
+		}
+	}
+	return nil
+}
+
+// rollback reinstalls the previous binary of a controller whose upgrade
+// failed, restarts it and returns an error reporting the state of the
+// controllers
+func (p *UpgradeControllers) rollback(h *cluster.Host, upgraded []string, cause error) error {
+	log.Errorf("%s: upgrade failed: %s", h, cause)
+
+	report := fmt.Sprintf("upgrade of controller %s failed: %s", h, cause)
+	if len(upgraded) > 0 {
+		report += fmt.Sprintf(" - controllers already upgraded to %s: %s", p.Config.Spec.K0s.Version, strings.Join(upgraded, ", "))
+	}
+
+	if !p.IsWet() {
+		return errors.New(report)
+	}
+
+	log.Warnf("%s: rolling back to k0s %s", h, h.Metadata.K0sRunningVersion)
+	err := func() error {
+		if err := h.Configurer.StopService(h, h.K0sServiceName()); err != nil {
+			log.Debugf("%s: failed to stop k0s: %s", h, err)
+		}
+		if err := retry.Timeout(context.TODO(), retry.DefaultTimeout, node.ServiceStoppedFunc(h, h.K0sServiceName())); err != nil {
+			return fmt.Errorf("wait for k0s service stop: %w", err)
+		}
+		if err := h.RollbackK0sBinary(); err != nil {
+			return err
+		}
+		if err := p.start(h); err != nil {
+			return err
+		}
+		return p.waitReady(h)
+	}()
+	if err != nil {
+		log.Errorf("%s: rollback failed: %s", h, err)
+		return fmt.Errorf("%s - rolling back controller %s to k0s %s failed too: %w", report, h, h.Metadata.K0sRunningVersion, err)
+	}
+
+	log.Infof("%s: rolled back to k0s %s", h, h.Metadata.K0sRunningVersion)
+	return fmt.Errorf("%s - controller %s was rolled back to k0s %s", report, h, h.Metadata.K0sRunningVersion)
+}
@@ -3,13 +3,15 @@ package phase
 import (
 	"context"
 	"fmt"
-	"math"
+	"os"
+	osexec "os/exec"
+	"strings"
 
 	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1"
 	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1/cluster"
 	"github.com/deepsquare-io/cfctl/pkg/node"
 	"github.com/deepsquare-io/cfctl/pkg/retry"
-	"github.com/gammazero/workerpool"
+	"github.com/k0sproject/rig/exec"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -18,6 +20,11 @@ type UpgradeWorkers struct {
 	GenericPhase
 
 	NoDrain bool
+	// Canary is the number of workers upgraded and checked first
+	Canary int
+	// PauseAfterCanary is called after the upgrade of the canaries, the
+	// upgrade stops when it returns an error
+	PauseAfterCanary func(canaries cluster.Hosts, remaining int) error
 
 	hosts  cluster.Hosts
 	leader *cluster.Host
@@ -63,43 +70,164 @@ func (p *UpgradeWorkers) CleanUp() {
 
 // Run the phase
 func (p *UpgradeWorkers) Run() error {
-	// Upgrade worker hosts parallelly in 10% chunks
-	concurrentUpgrades := int(math.Floor(float64(len(p.hosts)) * 0.10))
-	if concurrentUpgrades == 0 {
-		concurrentUpgrades = 1
-	}
-	log.Infof("Upgrading max %d workers in parallel", concurrentUpgrades)
-	wp := workerpool.New(concurrentUpgrades)
-	errors := make(map[string]error)
-	for _, w := range p.hosts {
-		h := w
-		wp.Submit(func() {
-			err := p.upgradeWorker(h)
-			if err != nil {
-				errors[h.String()] = err
-				log.Errorf("%s: upgrade failed: %s", h, err.Error())
+	batches := p.Config.Spec.Upgrade.Batches(p.hosts)
+	remaining := len(p.hosts)
+
+	if p.Canary > 0 {
+		var canaries []*cluster.UpgradeBatch
+		canaries, batches = splitCanary(batches, p.Canary)
+		var hosts cluster.Hosts
+		for _, c := range canaries {
+			hosts = append(hosts, c.Hosts...)
+		}
+		log.Infof("Upgrading %d canary workers", len(hosts))
+		for _, c := range canaries {
+			if err := p.upgradeHosts(c.Hosts, c.Drain, remaining); err != nil {
+				return err
 			}
-		})
+			remaining -= len(c.Hosts)
+		}
+		if err := p.healthCheck(hosts, remaining); err != nil {
+			return err
+		}
+		if p.PauseAfterCanary != nil && remaining > 0 {
+			if !p.IsWet() {
+				p.DryMsgf(nil, "pause before upgrading the remaining %d workers", remaining)
+			} else if err := p.PauseAfterCanary(hosts, remaining); err != nil {
+				return fmt.Errorf("upgrade stopped after the canary, %d workers were not upgraded: %w", remaining, err)
+			}
+		}
 	}
-	wp.StopWait()
 
-	if len(errors) > 0 {
-		return fmt.Errorf("upgrading %d workers failed", len(errors))
+	for _, batch := range batches {
+		if batch.Name != "" {
+			log.Infof("Upgrading the %d workers of pool %s, %d at a time", len(batch.Hosts), batch.Name, batch.Size)
+		} else {
+			log.Infof("Upgrading %d workers, %d at a time", len(batch.Hosts), batch.Size)
+		}
+		for i := 0; i < len(batch.Hosts); i += batch.Size {
+			end := i + batch.Size
+			if end > len(batch.Hosts) {
+				end = len(batch.Hosts)
+			}
+			hosts := batch.Hosts[i:end]
+			if err := p.upgradeHosts(hosts, batch.Drain, remaining); err != nil {
+				return err
+			}
+			remaining -= len(hosts)
+			if err := p.healthCheck(hosts, remaining); err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
 
-func (p *UpgradeWorkers) upgradeWorker(h *cluster.Host) error {
+// splitCanary takes the n first hosts of the batches as canaries, keeping
+// the drain configuration of their pools
+func splitCanary(batches []*cluster.UpgradeBatch, n int) ([]*cluster.UpgradeBatch, []*cluster.UpgradeBatch) {
+	var canaries, rest []*cluster.UpgradeBatch
+	for _, b := range batches {
+		if n <= 0 {
+			rest = append(rest, b)
+			continue
+		}
+		take := n
+		if take > len(b.Hosts) {
+			take = len(b.Hosts)
+		}
+		n -= take
+		canaries = append(canaries, &cluster.UpgradeBatch{Name: b.Name, Hosts: b.Hosts[:take], Size: take, Drain: b.Drain})
+		if take < len(b.Hosts) {
+			rest = append(rest, &cluster.UpgradeBatch{Name: b.Name, Hosts: b.Hosts[take:], Size: b.Size, Drain: b.Drain})
+		}
+	}
+	return canaries, rest
+}
+
+// upgradeHosts upgrades the hosts in parallel, remaining is the number of
+// workers left to upgrade including them
+func (p *UpgradeWorkers) upgradeHosts(hosts cluster.Hosts, drain *cluster.Drain, remaining int) error {
+	err := hosts.ParallelEach(func(h *cluster.Host) error {
+		if err := p.upgradeWorker(h, drain); err != nil {
+			log.Errorf("%s: upgrade failed: %s", h, err.Error())
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("upgrading workers failed, %d workers were not upgraded: %w", remaining-len(hosts), err)
+	}
+	return nil
+}
+
+// healthCheck runs the health checks after the upgrade of the hosts,
+// remaining is the number of workers left to upgrade
+func (p *UpgradeWorkers) healthCheck(hosts cluster.Hosts, remaining int) error {
+	for _, c := range p.Config.Spec.Upgrade.Checks() {
+		if !p.IsWet() {
+			p.DryMsgf(nil, "run health check %s", c)
+			continue
+		}
+		log.Infof("running health check %s", c)
+		err := retry.Timeout(context.TODO(), c.Timeout, func(ctx context.Context) error {
+			return p.runCheck(ctx, c, hosts)
+		})
+		if err != nil {
+			return fmt.Errorf("health check %s failed, %d workers were not upgraded: %w", c, remaining, err)
+		}
+	}
+	return nil
+}
+
+// runCheck runs a health check once
+func (p *UpgradeWorkers) runCheck(ctx context.Context, c *cluster.HealthCheck, hosts cluster.Hosts) error {
+	switch {
+	case c.Local != "":
+		names := make([]string, len(hosts))
+		for i, h := range hosts {
+			names[i] = h.Metadata.Hostname
+		}
+		cmd := osexec.CommandContext(ctx, "sh", "-c", c.Local)
+		cmd.Env = append(os.Environ(), "CFCTL_UPGRADED_HOSTS="+strings.Join(names, " "))
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+		}
+		return c.Check(string(out))
+	case c.Remote != "":
+		return hosts.ParallelEach(func(h *cluster.Host) error {
+			out, err := h.ExecOutput(c.Remote)
+			if err != nil {
+				return err
+			}
+			return c.Check(out)
+		})
+	default:
+		out, err := p.leader.ExecOutput(p.leader.Configurer.KubectlCmdf(p.leader, p.leader.K0sDataDir(), "%s", c.Kubectl), exec.Sudo(p.leader))
+		if err != nil {
+			return err
+		}
+		return c.Check(out)
+	}
+}
+
+func (p *UpgradeWorkers) upgradeWorker(h *cluster.Host, drain *cluster.Drain) error {
 	if !h.Configurer.FileExist(h, h.Metadata.K0sBinaryTempFile) {
 		return fmt.Errorf("k0s binary tempfile not found on host")
 	}
 
 	log.Infof("%s: starting upgrade", h)
 
-	if !p.NoDrain {
+	if err := p.runHooks(h, "upgrade", "beforeDrain"); err != nil {
+		return err
+	}
+
+	shouldDrain := !p.NoDrain && h.ShouldDrain()
+	if shouldDrain {
 		log.Debugf("%s: draining...", h)
 		err := p.Wet(h, "drain node", func() error {
-			return p.leader.DrainNode(h)
+			return p.leader.DrainNode(h, drain)
 		})
 		if err != nil {
 			return err
@@ -107,6 +235,10 @@ func (p *UpgradeWorkers) upgradeWorker(h *cluster.Host) error {
 		log.Debugf("%s: draining complete", h)
 	}
 
+	if err := p.runHooks(h, "upgrade", "before"); err != nil {
+		return err
+	}
+
 	log.Debugf("%s: stop service", h)
 	err := p.Wet(h, "stop k0s service", func() error {
 		if err := h.Configurer.StopService(h, h.K0sServiceName()); err != nil {
@@ -160,7 +292,7 @@ func (p *UpgradeWorkers) upgradeWorker(h *cluster.Host) error {
 		return err
 	}
 
-	if !p.NoDrain {
+	if shouldDrain {
 		log.Debugf("%s: marking node schedulable again", h)
 		err := p.Wet(h, "uncordon node", func() error {
 			return p.leader.UncordonNode(h)
@@ -171,5 +303,5 @@ func (p *UpgradeWorkers) upgradeWorker(h *cluster.Host) error {
 	}
 	h.Metadata.Ready = true
 	log.Infof("%s: upgrade successful", h)
-	return nil
+	return p.runHooks(h, "upgrade", "afterReady")
 }
@@ -0,0 +1,41 @@
+package phase
+
+import (
+	"testing"
+
+	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1/cluster"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitCanary(t *testing.T) {
+	hosts := make(cluster.Hosts, 5)
+	for i := range hosts {
+		hosts[i] = &cluster.Host{Role: "worker"}
+	}
+	gpuDrain := &cluster.Drain{}
+	batches := []*cluster.UpgradeBatch{
+		{Name: "gpu", Hosts: hosts[:2], Size: 1, Drain: gpuDrain},
+		{Hosts: hosts[2:], Size: 2},
+	}
+
+	canaries, rest := splitCanary(batches, 1)
+	require.Len(t, canaries, 1)
+	require.Equal(t, cluster.Hosts{hosts[0]}, canaries[0].Hosts)
+	require.Same(t, gpuDrain, canaries[0].Drain)
+	require.Len(t, rest, 2)
+	require.Equal(t, cluster.Hosts{hosts[1]}, rest[0].Hosts)
+	require.Equal(t, 1, rest[0].Size)
+	require.Equal(t, cluster.Hosts(hosts[2:]), rest[1].Hosts)
+
+	canaries, rest = splitCanary(batches, 3)
+	require.Len(t, canaries, 2)
+	require.Equal(t, cluster.Hosts(hosts[:2]), canaries[0].Hosts)
+	require.Equal(t, cluster.Hosts{hosts[2]}, canaries[1].Hosts)
+	require.Nil(t, canaries[1].Drain)
+	require.Len(t, rest, 1)
+	require.Equal(t, cluster.Hosts(hosts[3:]), rest[0].Hosts)
+
+	canaries, rest = splitCanary(batches, 10)
+	require.Len(t, canaries, 2)
+	require.Empty(t, rest)
+}
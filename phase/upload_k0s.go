@@ -13,6 +13,9 @@ import (
 // UploadK0s uploads k0s binaries from localhost to target
 type UploadK0s struct {
 	GenericPhase
+	// OnlyUpgrades limits the phase to the hosts that need an upgrade
+	OnlyUpgrades bool
+
 	hosts cluster.Hosts
 }
 
@@ -30,6 +33,10 @@ func (p *UploadK0s) Prepare(config *v1beta1.Cluster) error {
 			return false
 		}
 
+		if p.OnlyUpgrades && !h.Metadata.NeedsUpgrade {
+			return false
+		}
+
 		// No need to upload, host is going to be reset
 		if h.Reset {
 			return false
@@ -0,0 +1,80 @@
+package phase
+
+import (
+	"fmt"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1"
+	"github.com/deepsquare-io/cfctl/pkg/apis/cfctl.clusterfactory.io/v1beta1/cluster"
+	"github.com/deepsquare-io/cfctl/pkg/backup"
+	log "github.com/sirupsen/logrus"
+)
+
+// ValidateRestore reads the archive to restore before anything is changed on
+// the hosts and refuses archives that are corrupted, hold no datastore or were
+// taken with an incompatible version of k0s. Archives without a manifest or
+// a known k0s version, such as the ones of k0s backup, are restored with a
+// warning.
+type ValidateRestore struct {
+	GenericPhase
+
+	RestoreFrom string
+	// AgeIdentities decrypt the age encrypted archives
+	AgeIdentities []age.Identity
+	// AllowVersionMismatch restores archives taken with an incompatible
+	// version of k0s with a warning
+	AllowVersionMismatch bool
+
+	leader *cluster.Host
+}
+
+// Title for the phase
+func (p *ValidateRestore) Title() string {
+	return "Validate backup archive"
+}
+
+// Prepare the phase
+func (p *ValidateRestore) Prepare(config *v1beta1.Cluster) error {
+	p.Config = config
+	p.leader = p.Config.Spec.K0sLeader()
+	return nil
+}
+
+// ShouldRun is true when the cluster state will be restored, including onto a
+// leader that is going to be reset by a restore
+func (p *ValidateRestore) ShouldRun() bool {
+	return p.RestoreFrom != "" && (p.leader.Metadata.K0sRunningVersion == nil || p.leader.Reset)
+}
+
+// Run the phase
+func (p *ValidateRestore) Run() error {
+	info, err := backup.InspectFile(p.RestoreFrom, p.AgeIdentities)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", p.RestoreFrom, err)
+	}
+
+	if info.Manifest == nil {
+		log.Warnf("no manifest found for %s, the integrity of the archive can not be verified", p.RestoreFrom)
+	} else {
+		log.Infof("verified the checksum of %s taken on %s with k0s %s", p.RestoreFrom, info.Manifest.Controller, info.Manifest.K0sVersion)
+	}
+	log.Debugf("%s contains %s", p.RestoreFrom, strings.Join(info.Contents.Components, ", "))
+
+	if !info.Contents.HasDatastore() {
+		return fmt.Errorf("%s is not a k0s backup: it holds neither an etcd snapshot nor a kine database", p.RestoreFrom)
+	}
+
+	if info.K0sVersion() == "" {
+		log.Warnf("the k0s version of %s is unknown, it can not be checked against k0s %s", p.RestoreFrom, p.Config.Spec.K0s.Version)
+		return nil
+	}
+	if err := backup.CheckVersion(info.K0sVersion(), p.Config.Spec.K0s.Version); err != nil {
+		if p.AllowVersionMismatch {
+			log.Warnf("--allow-version-mismatch given, restoring anyway: %s", err)
+			return nil
+		}
+		return fmt.Errorf("%w (use --allow-version-mismatch to restore anyway)", err)
+	}
+	return nil
+}
@@ -1,12 +1,296 @@
 package cluster
 
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jellydator/validation"
+)
+
+// Failure policies of the hooks
+const (
+	// HookFail stops the operation when the hook fails
+	HookFail = "fail"
+	// HookWarn logs a warning when the hook fails
+	HookWarn = "warn"
+	// HookIgnore only logs the failures of the hook in the debug log
+	HookIgnore = "ignore"
+)
+
+// HookStages are the stages of the hooks by action
+var HookStages = map[string][]string{
+	"apply":   {"before", "after"},
+	"backup":  {"before", "after"},
+	"restore": {"before", "after"},
+	"reset":   {"before", "after"},
+	"install": {"beforeJoin", "afterJoin"},
+	"upgrade": {"beforeDrain", "before", "afterReady"},
+}
+
+// checksumPattern matches the checksums of the scripts of the hooks
+var checksumPattern = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+// hookScriptTimeout is the timeout of the downloads of the scripts of the hooks
+const hookScriptTimeout = 30 * time.Second
+
+// Hook is a command or a script run on the host or, when local, a command
+// run on the machine running cfctl
+type Hook struct {
+	// Remote is a command run on the host
+	Remote string `yaml:"remote,omitempty"`
+	// Local is a command run with sh on the machine running cfctl
+	Local string `yaml:"local,omitempty"`
+	// Script is a local script file, or a directory of scripts run in the
+	// order of their names, uploaded to the host and run there
+	Script string `yaml:"script,omitempty"`
+	// URL is the url of a script uploaded to the host and run there
+	URL string `yaml:"url,omitempty"`
+	// Checksum is the checksum of the script of URL, such as "sha256:<hex>"
+	Checksum string `yaml:"checksum,omitempty"`
+	// Interpreter runs the scripts, "sh" by default
+	Interpreter string `yaml:"interpreter,omitempty"`
+	// Sudo runs the scripts with sudo
+	Sudo bool `yaml:"sudo,omitempty"`
+	// Timeout stops the command, or every script, after a while, there is
+	// no timeout when 0. It is at least 1s, the remote hooks are stopped
+	// after a whole number of seconds.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// OnFailure is "fail", "warn" or "ignore", "fail" by default
+	OnFailure string `yaml:"onFailure,omitempty"`
+}
+
+// HookScript is a script of a hook
+type HookScript struct {
+	Name    string
+	Content string
+}
+
+// UnmarshalYAML reads a remote command or a hook mapping
+func (h *Hook) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var cmd string
+	if err := unmarshal(&cmd); err == nil {
+		*h = Hook{Remote: cmd}
+		return nil
+	}
+	type hook Hook
+	return unmarshal((*hook)(h))
+}
+
+// MarshalYAML writes the remote commands without settings as strings
+func (h Hook) MarshalYAML() (interface{}, error) {
+	if h == (Hook{Remote: h.Remote}) {
+		return h.Remote, nil
+	}
+	type hook Hook
+	return hook(h), nil
+}
+
+// String returns the command or the script of the hook
+func (h *Hook) String() string {
+	switch {
+	case h.Local != "":
+		return "local: " + h.Local
+	case h.Script != "":
+		return "script: " + h.Script
+	case h.URL != "":
+		return "url: " + h.URL
+	default:
+		return h.Remote
+	}
+}
+
+// IsScript returns true when the hook uploads scripts to the host
+func (h *Hook) IsScript() bool {
+	return h.Script != "" || h.URL != ""
+}
+
+// InterpreterOrDefault returns the interpreter of the scripts
+func (h *Hook) InterpreterOrDefault() string {
+	if h.Interpreter == "" {
+		return "sh"
+	}
+	return h.Interpreter
+}
+
+// Policy returns the failure policy of the hook
+func (h *Hook) Policy() string {
+	if h.OnFailure == "" {
+		return HookFail
+	}
+	return h.OnFailure
+}
+
+// Validate the hook
+func (h *Hook) Validate() error {
+	commands := 0
+	for _, cmd := range []string{h.Remote, h.Local, h.Script, h.URL} {
+		if cmd != "" {
+			commands++
+		}
+	}
+	if commands != 1 {
+		return fmt.Errorf("hook %q: exactly one of remote, local, script or url required", h)
+	}
+	return validation.ValidateStruct(h,
+		validation.Field(&h.URL, validation.When(h.URL != "", validation.By(validateScriptURL))),
+		validation.Field(&h.Checksum,
+			validation.Required.When(h.URL != "").Error("required with url"),
+			validation.Empty.When(h.URL == "").Error("only allowed with url"),
+			validation.Match(checksumPattern).Error("must be sha256:<hex>"),
+		),
+		validation.Field(&h.Interpreter, validation.Empty.When(!h.IsScript()).Error("only allowed with script or url")),
+		validation.Field(&h.Sudo, validation.Empty.When(!h.IsScript()).Error("only allowed with script or url")),
+		validation.Field(&h.Timeout, validation.When(h.Timeout != 0, validation.Min(time.Second).Error("must be 0 or at least 1s"))),
+		validation.Field(&h.OnFailure, validation.In(HookFail, HookWarn, HookIgnore)),
+	)
+}
+
+// TimeoutSeconds returns the timeout in whole seconds, rounded up, for the
+// timeout command of the remote hooks
+func (h *Hook) TimeoutSeconds() int {
+	return int((h.Timeout + time.Second - 1) / time.Second)
+}
+
+func validateScriptURL(value interface{}) error {
+	s, _ := value.(string)
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("must be an http or https url")
+	}
+	return nil
+}
+
+// LoadScripts reads the script file, the scripts of the directory in the
+// order of their names or downloads the script of the url, verifying its
+// checksum
+func (h *Hook) LoadScripts() ([]*HookScript, error) {
+	switch {
+	case h.URL != "":
+		content, err := downloadScript(h.URL)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(content)
+		if actual := "sha256:" + hex.EncodeToString(sum[:]); actual != h.Checksum {
+			return nil, fmt.Errorf("checksum mismatch for %s: expected %s, got %s", h.URL, h.Checksum, actual)
+		}
+		u, _ := url.Parse(h.URL)
+		name := path.Base(u.Path)
+		if name == "/" || name == "." {
+			name = "script"
+		}
+		return []*HookScript{{Name: name, Content: string(content)}}, nil
+	case h.Script != "":
+		stat, err := os.Stat(h.Script)
+		if err != nil {
+			return nil, err
+		}
+		if !stat.IsDir() {
+			content, err := os.ReadFile(h.Script)
+			if err != nil {
+				return nil, err
+			}
+			return []*HookScript{{Name: filepath.Base(h.Script), Content: string(content)}}, nil
+		}
+		entries, err := os.ReadDir(h.Script)
+		if err != nil {
+			return nil, err
+		}
+		var scripts []*HookScript
+		for _, e := range entries {
+			if !e.Type().IsRegular() || strings.HasPrefix(e.Name(), ".") {
+				continue
+			}
+			content, err := os.ReadFile(filepath.Join(h.Script, e.Name()))
+			if err != nil {
+				return nil, err
+			}
+			scripts = append(scripts, &HookScript{Name: e.Name(), Content: string(content)})
+		}
+		if len(scripts) == 0 {
+			return nil, fmt.Errorf("no scripts found in %s", h.Script)
+		}
+		return scripts, nil
+	default:
+		return nil, fmt.Errorf("hook %q has no scripts", h)
+	}
+}
+
+// downloadScript downloads the script of an url
+func downloadScript(location string) ([]byte, error) {
+	client := &http.Client{Timeout: hookScriptTimeout}
+	resp, err := client.Get(location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", location, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: http %d", location, resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
 // Hooks define a list of hooks such as hooks["apply"]["before"] = ["ls -al", "rm foo.txt"]
-type Hooks map[string]map[string][]string
+type Hooks map[string]map[string][]*Hook
 
 // ForActionAndStage return hooks for given action and stage
-func (h Hooks) ForActionAndStage(action, stage string) []string {
+func (h Hooks) ForActionAndStage(action, stage string) []*Hook {
 	if len(h[action]) > 0 {
 		return h[action][stage]
 	}
 	return nil
 }
+
+// Validate the actions, the stages and the hooks
+func (h Hooks) Validate() error {
+	for action, stages := range h {
+		known, ok := HookStages[action]
+		if !ok {
+			return fmt.Errorf("unknown hook action %q, must be one of %s", action, strings.Join(hookActions(), ", "))
+		}
+		for stage, hooks := range stages {
+			if !contains(known, stage) {
+				return fmt.Errorf("unknown hook stage %s.%s, must be one of %s", action, stage, strings.Join(known, ", "))
+			}
+			for _, hook := range hooks {
+				if err := hook.Validate(); err != nil {
+					return fmt.Errorf("%s.%s: %w", action, stage, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// hookActions returns the actions of the hooks, sorted
+func hookActions() []string {
+	actions := make([]string, 0, len(HookStages))
+	for action := range HookStages {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+	return actions
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
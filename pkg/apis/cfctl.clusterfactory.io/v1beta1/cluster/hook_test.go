@@ -0,0 +1,124 @@
+package cluster
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestHooksUnmarshal(t *testing.T) {
+	data := `
+apply:
+  before:
+    - date >> cfctl-apply.log
+    - local: ./notify.sh
+      timeout: 30s
+      onFailure: warn
+upgrade:
+  beforeDrain:
+    - remote: systemctl stop slurmd
+      onFailure: ignore
+`
+	hooks := Hooks{}
+	require.NoError(t, yaml.Unmarshal([]byte(data), &hooks))
+	require.NoError(t, hooks.Validate())
+
+	before := hooks.ForActionAndStage("apply", "before")
+	require.Len(t, before, 2)
+	require.Equal(t, &Hook{Remote: "date >> cfctl-apply.log"}, before[0])
+	require.Equal(t, HookFail, before[0].Policy())
+	require.Equal(t, &Hook{Local: "./notify.sh", Timeout: 30 * time.Second, OnFailure: HookWarn}, before[1])
+	require.Equal(t, "local: ./notify.sh", before[1].String())
+	require.Equal(t, HookIgnore, hooks.ForActionAndStage("upgrade", "beforeDrain")[0].Policy())
+	require.Nil(t, hooks.ForActionAndStage("reset", "before"))
+
+	out, err := yaml.Marshal(hooks)
+	require.NoError(t, err)
+	roundtrip := Hooks{}
+	require.NoError(t, yaml.Unmarshal(out, &roundtrip))
+	require.Equal(t, hooks, roundtrip)
+	require.Contains(t, string(out), "- date >> cfctl-apply.log\n")
+}
+
+func TestHooksValidate(t *testing.T) {
+	for name, hooks := range map[string]Hooks{
+		"unknown action":         {"deploy": {"before": {{Remote: "true"}}}},
+		"unknown stage":          {"upgrade": {"afterDrain": {{Remote: "true"}}}},
+		"no command":             {"apply": {"before": {{OnFailure: HookWarn}}}},
+		"two commands":           {"apply": {"before": {{Remote: "true", Local: "true"}}}},
+		"unknown policy":         {"apply": {"before": {{Remote: "true", OnFailure: "retry"}}}},
+		"negative timeout":       {"apply": {"before": {{Remote: "true", Timeout: -time.Second}}}},
+		"sub-second timeout":     {"apply": {"before": {{Remote: "true", Timeout: 500 * time.Millisecond}}}},
+		"script and url":         {"apply": {"before": {{Script: "a.sh", URL: "https://example.com/a.sh"}}}},
+		"no checksum":            {"apply": {"before": {{URL: "https://example.com/a.sh"}}}},
+		"bad checksum":           {"apply": {"before": {{URL: "https://example.com/a.sh", Checksum: "md5:abc"}}}},
+		"url scheme":             {"apply": {"before": {{URL: "file:///a.sh", Checksum: "sha256:" + hex.EncodeToString(make([]byte, 32))}}}},
+		"checksum alone":         {"apply": {"before": {{Script: "a.sh", Checksum: "sha256:" + hex.EncodeToString(make([]byte, 32))}}}},
+		"remote with sudo":       {"apply": {"before": {{Remote: "true", Sudo: true}}}},
+		"local with interpreter": {"apply": {"before": {{Local: "true", Interpreter: "bash"}}}},
+	} {
+		require.Error(t, hooks.Validate(), name)
+	}
+}
+
+func TestHookLoadScripts(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"20-second.sh": "echo second",
+		"10-first.sh":  "echo first",
+		".hidden":      "echo hidden",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "30-dir"), 0o755))
+
+	scripts, err := (&Hook{Script: dir}).LoadScripts()
+	require.NoError(t, err)
+	require.Equal(t, []*HookScript{
+		{Name: "10-first.sh", Content: "echo first"},
+		{Name: "20-second.sh", Content: "echo second"},
+	}, scripts)
+
+	scripts, err = (&Hook{Script: filepath.Join(dir, "20-second.sh")}).LoadScripts()
+	require.NoError(t, err)
+	require.Equal(t, []*HookScript{{Name: "20-second.sh", Content: "echo second"}}, scripts)
+
+	_, err = (&Hook{Script: filepath.Join(dir, "30-dir")}).LoadScripts()
+	require.ErrorContains(t, err, "no scripts found")
+
+	t.Run("url", func(t *testing.T) {
+		content := "#!/bin/sh\necho remote\n"
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/scripts/prepare.sh" {
+				http.NotFound(w, r)
+				return
+			}
+			_, _ = w.Write([]byte(content))
+		}))
+		defer srv.Close()
+		sum := sha256.Sum256([]byte(content))
+		checksum := "sha256:" + hex.EncodeToString(sum[:])
+
+		hook := &Hook{URL: srv.URL + "/scripts/prepare.sh", Checksum: checksum}
+		require.NoError(t, hook.Validate())
+		scripts, err := hook.LoadScripts()
+		require.NoError(t, err)
+		require.Equal(t, []*HookScript{{Name: "prepare.sh", Content: content}}, scripts)
+
+		hook.Checksum = "sha256:" + hex.EncodeToString(make([]byte, 32))
+		_, err = hook.LoadScripts()
+		require.ErrorContains(t, err, "checksum mismatch")
+
+		hook.URL = srv.URL + "/missing.sh"
+		_, err = hook.LoadScripts()
+		require.ErrorContains(t, err, "http 404")
+	})
+}
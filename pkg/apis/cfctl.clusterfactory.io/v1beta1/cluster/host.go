@@ -11,6 +11,7 @@ import (
 
 	"github.com/alessio/shellescape"
 	"github.com/creasty/defaults"
+	"github.com/deepsquare-io/cfctl/pkg/cron"
 	"github.com/go-playground/validator/v10"
 	"github.com/jellydator/validation"
 	"github.com/jellydator/validation/is"
@@ -41,6 +42,7 @@ type Host struct {
 	OSIDOverride     string            `yaml:"os,omitempty"`
 	HostnameOverride string            `yaml:"hostname,omitempty"`
 	NoTaints         bool              `yaml:"noTaints,omitempty"`
+	Drain            *bool             `yaml:"drain,omitempty"`
 	Hooks            Hooks             `yaml:"hooks,omitempty"`
 
 	UploadBinaryPath string       `yaml:"-"`
@@ -115,6 +117,7 @@ func (h *Host) Validate() error {
 		validation.Field(&h.Role, validation.In("controller", "worker", "controller+worker", "single").Error("unknown role "+h.Role)),
 		validation.Field(&h.PrivateAddress, is.IP),
 		validation.Field(&h.Files),
+		validation.Field(&h.Hooks),
 		validation.Field(&h.NoTaints, validation.When(h.Role != "controller+worker", validation.NotIn(true).Error("noTaints can only be true for controller+worker role"))),
 		validation.Field(&h.InstallFlags, validation.Each(validation.By(validateBalancedQuotes))),
 	)
@@ -169,6 +172,12 @@ type configurer interface {
 	UpsertFile(os.Host, string, string) error
 	MachineID(os.Host) (string, error)
 	SetPath(string, string)
+	BackupScriptPath() string
+	BackupEnvPath() string
+	BackupStatusPath() string
+	InstallBackupSchedule(os.Host, cron.Schedule) error
+	RemoveBackupSchedule(os.Host) error
+	BackupScheduleStatus(os.Host) (string, error)
 }
 
 // HostMetadata resolved metadata for host
@@ -413,6 +422,34 @@ func (h *Host) UpdateK0sBinary(path string, version *version.Version) error {
 	return nil
 }
 
+// K0sPreviousBinaryPath returns the path where the k0s binary replaced by an upgrade is kept
+func (h *Host) K0sPreviousBinaryPath() string {
+	return h.Configurer.K0sBinaryPath() + ".previous"
+}
+
+// KeepK0sBinary copies the installed k0s binary to K0sPreviousBinaryPath
+func (h *Host) KeepK0sBinary() error {
+	if err := h.Execf(`install -m 0750 -o root -g root "%s" "%s"`, h.Configurer.K0sBinaryPath(), h.K0sPreviousBinaryPath(), exec.Sudo(h)); err != nil {
+		return fmt.Errorf("keep the previous k0s binary: %w", err)
+	}
+	return nil
+}
+
+// RollbackK0sBinary reinstalls the k0s binary kept by KeepK0sBinary
+func (h *Host) RollbackK0sBinary() error {
+	if err := h.InstallK0sBinary(h.K0sPreviousBinaryPath()); err != nil {
+		return fmt.Errorf("roll back the k0s binary: %w", err)
+	}
+
+	version, err := h.Configurer.K0sBinaryVersion(h)
+	if err != nil {
+		return fmt.Errorf("failed to get the rolled back k0s binary version: %w", err)
+	}
+	h.Metadata.K0sBinaryVersion = version
+
+	return nil
+}
+
 // K0sDataDir returns the data dir for the host either from host.DataDir or the default from configurer's DataDirDefaultPath
 func (h *Host) K0sDataDir() string {
 	if h.DataDir == "" {
@@ -421,19 +458,44 @@ func (h *Host) K0sDataDir() string {
 	return h.DataDir
 }
 
-// DrainNode drains the given node
-func (h *Host) DrainNode(node *Host) error {
-	return h.Exec(h.Configurer.KubectlCmdf(h, h.K0sDataDir(), "drain --grace-period=120 --force --timeout=5m --ignore-daemonsets --delete-emptydir-data %s", node.Metadata.Hostname), exec.Sudo(h))
+// ShouldDrain returns false when the node is configured with "drain: false"
+func (h *Host) ShouldDrain() bool {
+	return h.Drain == nil || *h.Drain
+}
+
+// Labels returns the node labels set with the --labels install flag
+func (h *Host) Labels() map[string]string {
+	labels := make(map[string]string)
+	for _, l := range strings.Split(h.InstallFlags.GetValue("--labels"), ",") {
+		if k, v, ok := strings.Cut(strings.TrimSpace(l), "="); ok && k != "" {
+			labels[k] = v
+		}
+	}
+	return labels
+}
+
+// NodeName returns the name of the kubernetes node of the host, its
+// hostname-override or its hostname lowercased like kubelet does
+func (h *Host) NodeName() string {
+	if h.HostnameOverride != "" {
+		return strings.ToLower(h.HostnameOverride)
+	}
+	return strings.ToLower(h.Metadata.Hostname)
+}
+
+// DrainNode drains the given node, with the default settings when drain is nil
+func (h *Host) DrainNode(node *Host, drain *Drain) error {
+	return h.Exec(h.Configurer.KubectlCmdf(h, h.K0sDataDir(), "drain %s %s", drain.Args(), node.NodeName()), exec.Sudo(h))
 }
 
 // UncordonNode marks the node schedulable again
 func (h *Host) UncordonNode(node *Host) error {
-	return h.Exec(h.Configurer.KubectlCmdf(h, h.K0sDataDir(), "uncordon %s", node.Metadata.Hostname), exec.Sudo(h))
+	return h.Exec(h.Configurer.KubectlCmdf(h, h.K0sDataDir(), "uncordon %s", node.NodeName()), exec.Sudo(h))
 }
 
 // DeleteNode deletes the given node from kubernetes
 func (h *Host) DeleteNode(node *Host) error {
-	return h.Exec(h.Configurer.KubectlCmdf(h, h.K0sDataDir(), "delete node %s", node.Metadata.Hostname), exec.Sudo(h))
+	return h.Exec(h.Configurer.KubectlCmdf(h, h.K0sDataDir(), "delete node %s", node.NodeName()), exec.Sudo(h))
 }
 
 // CheckHTTPStatus will perform a web request to the url and return an error if the http status is not the expected
@@ -20,6 +20,13 @@ func TestHostK0sServiceName(t *testing.T) {
 	require.Equal(t, "k0scontroller", h.K0sServiceName())
 }
 
+func TestHostNodeName(t *testing.T) {
+	h := Host{Metadata: HostMetadata{Hostname: "Worker-0"}}
+	require.Equal(t, "worker-0", h.NodeName())
+	h.HostnameOverride = "Node-0.example.com"
+	require.Equal(t, "node-0.example.com", h.NodeName())
+}
+
 type mockconfigurer struct {
 	cfg.Linux
 	linux.Ubuntu
@@ -27,6 +27,15 @@ var (
 	k0sSupportedVersion           = version.MustConstraint(">= " + K0sMinVersion)
 	k0sDynamicConfigSince         = version.MustConstraint(">= 1.22.2+k0s.2")
 	k0sTokenCreateConfigFlagUntil = version.MustConstraint("< v1.23.4-rc.1+k0s.0")
+	k0sAutopilotSince             = version.MustConstraint(">= v1.25.0+k0s.0")
+)
+
+// Upgrade strategies of k0s
+const (
+	// UpgradeStrategySSH upgrades the hosts one by one over ssh
+	UpgradeStrategySSH = "ssh"
+	// UpgradeStrategyAutopilot upgrades the hosts with a k0s autopilot plan
+	UpgradeStrategyAutopilot = "autopilot"
 )
 
 // K0s holds configuration for bootstraping a k0s cluster
@@ -35,7 +44,56 @@ type K0s struct {
 	VersionChannel string           `yaml:"versionChannel" default:"stable"`
 	DynamicConfig  bool             `yaml:"dynamicConfig"`
 	Config         dig.Mapping      `yaml:"config"`
-	Metadata       K0sMetadata      `yaml:"-"`
+	// UpgradeStrategy is "ssh" or "autopilot"
+	UpgradeStrategy string      `yaml:"upgradeStrategy,omitempty" default:"ssh"`
+	Autopilot       *Autopilot  `yaml:"autopilot,omitempty"`
+	Metadata        K0sMetadata `yaml:"-"`
+}
+
+// Autopilot configures the upgrades with k0s autopilot
+type Autopilot struct {
+	// BinaryURL is a template of the url of the k0s binaries, such as
+	// "https://mirror.example.com/k0s-{{.Version}}-{{.Arch}}", with
+	// {{.Version}}, {{.OS}} and {{.Arch}}. The k0s github releases are used
+	// when empty
+	BinaryURL string `yaml:"binaryURL,omitempty"`
+	// WorkerSelector is a label selector of the workers to upgrade, the
+	// workers of the configuration are listed by name when empty
+	WorkerSelector string `yaml:"workerSelector,omitempty"`
+	// Timeout is how long to wait for the plan to complete
+	Timeout time.Duration `yaml:"timeout" default:"1h"`
+}
+
+// UnmarshalYAML sets in some sane defaults when unmarshaling the data from yaml
+func (a *Autopilot) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type autopilot Autopilot
+	ya := (*autopilot)(a)
+	if err := defaults.Set(ya); err != nil {
+		return err
+	}
+	return unmarshal(ya)
+}
+
+// Validate the autopilot configuration
+func (a *Autopilot) Validate() error {
+	return validation.ValidateStruct(a,
+		validation.Field(&a.Timeout, validation.Min(time.Minute)),
+	)
+}
+
+// IsAutopilot returns true when k0s is upgraded with autopilot
+func (k *K0s) IsAutopilot() bool {
+	return k.UpgradeStrategy == UpgradeStrategyAutopilot
+}
+
+// AutopilotConfig returns the autopilot configuration or the defaults
+func (k *K0s) AutopilotConfig() *Autopilot {
+	if k.Autopilot != nil {
+		return k.Autopilot
+	}
+	a := &Autopilot{}
+	_ = defaults.Set(a)
+	return a
 }
 
 // K0sMetadata contains gathered information about k0s cluster
@@ -89,9 +147,16 @@ func (k *K0s) Validate() error {
 		validation.Field(&k.Version, validation.By(validateVersion)),
 		validation.Field(&k.DynamicConfig, validation.By(k.validateMinDynamic())),
 		validation.Field(&k.VersionChannel, validation.In("stable", "latest")),
+		validation.Field(&k.UpgradeStrategy, validation.In(UpgradeStrategySSH, UpgradeStrategyAutopilot)),
+		validation.Field(&k.Autopilot),
 	)
 }
 
+// SupportsAutopilot returns true when the k0s version can be upgraded by autopilot
+func SupportsAutopilot(v *version.Version) bool {
+	return v != nil && k0sAutopilotSince.Check(v)
+}
+
 func (k *K0s) validateMinDynamic() func(interface{}) error {
 	return func(value interface{}) error {
 		dc, ok := value.(bool)
@@ -2,6 +2,7 @@ package cluster
 
 import (
 	"testing"
+	"time"
 
 	"github.com/creasty/defaults"
 	"github.com/k0sproject/version"
@@ -41,3 +42,47 @@ func TestVersionDefaulting(t *testing.T) {
 		require.NoError(t, k0s.Validate())
 	})
 }
+
+func TestUpgradeStrategy(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		k0s := &K0s{}
+		require.NoError(t, yaml.Unmarshal([]byte("version: 1.28.4+k0s.0\n"), k0s))
+		require.Equal(t, UpgradeStrategySSH, k0s.UpgradeStrategy)
+		require.False(t, k0s.IsAutopilot())
+		require.Equal(t, time.Hour, k0s.AutopilotConfig().Timeout)
+		require.NoError(t, k0s.Validate())
+	})
+
+	t.Run("autopilot", func(t *testing.T) {
+		k0s := &K0s{}
+		require.NoError(t, yaml.Unmarshal([]byte("version: 1.28.4+k0s.0\nupgradeStrategy: autopilot\nautopilot:\n  workerSelector: pool=gpu\n"), k0s))
+		require.True(t, k0s.IsAutopilot())
+		require.Equal(t, "pool=gpu", k0s.AutopilotConfig().WorkerSelector)
+		require.Equal(t, time.Hour, k0s.AutopilotConfig().Timeout)
+		require.NoError(t, k0s.Validate())
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		k0s := &K0s{}
+		require.NoError(t, yaml.Unmarshal([]byte("upgradeStrategy: rsync\n"), k0s))
+		require.Error(t, k0s.Validate())
+	})
+}
+
+func TestSupportsAutopilot(t *testing.T) {
+	require.False(t, SupportsAutopilot(nil))
+	require.False(t, SupportsAutopilot(version.MustParse("v1.24.9+k0s.0")))
+	require.True(t, SupportsAutopilot(version.MustParse("v1.25.0+k0s.0")))
+}
+
+func TestAutopilotUnsupportedSettings(t *testing.T) {
+	require.NoError(t, validateAutopilotUpgrade((*Upgrade)(nil)))
+	require.NoError(t, validateAutopilotUpgrade(&Upgrade{BatchSize: BatchSize{value: 5}}))
+	require.ErrorContains(t, validateAutopilotUpgrade(&Upgrade{Pools: []*UpgradePool{{Role: "worker"}}}), "pools are not supported")
+	require.ErrorContains(t, validateAutopilotUpgrade(&Upgrade{Drain: &Drain{}}), "drain is not supported")
+	require.ErrorContains(t, validateAutopilotUpgrade(&Upgrade{HealthChecks: []*HealthCheck{{Local: "true"}}}), "healthChecks are not supported")
+
+	no := false
+	require.NoError(t, validateAutopilotHosts(Hosts{{}}))
+	require.ErrorContains(t, validateAutopilotHosts(Hosts{{}, {Drain: &no}}), "drain: false is not supported")
+}
@@ -0,0 +1,90 @@
+package cluster
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/deepsquare-io/cfctl/pkg/notify"
+	"github.com/deepsquare-io/cfctl/pkg/secret"
+	"github.com/jellydator/validation"
+)
+
+// NotificationEvents are the events sent to the notification targets
+var NotificationEvents = []string{
+	"apply-start", "apply-success", "apply-failure",
+	"reset-start", "reset-success", "reset-failure",
+	"backup-start", "backup-success", "backup-failure",
+}
+
+// Notification is a webhook receiving the events of the cfctl operations
+type Notification struct {
+	// URL of the webhook
+	URL string `yaml:"url"`
+	// Format is "json", "slack" or "mattermost", "json" by default
+	Format string `yaml:"format,omitempty"`
+	// Secret signs the payloads with HMAC-SHA256 in the X-Cfctl-Signature
+	// header, "env:NAME" and "file:PATH" read it from an environment variable
+	// or a file and "literal:VALUE" escapes a value starting with a prefix
+	Secret string `yaml:"secret,omitempty"`
+	// Headers are added to the requests, their values are resolved like Secret
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// Events filters the events sent to the webhook, all of them when empty
+	Events []string `yaml:"events,omitempty"`
+	// Timeout of the requests, 10s by default
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+}
+
+// Validate the notification
+func (n *Notification) Validate() error {
+	return validation.ValidateStruct(n,
+		validation.Field(&n.URL, validation.Required, validation.By(validateWebhookURL)),
+		validation.Field(&n.Format, validation.In(notify.FormatJSON, notify.FormatSlack, notify.FormatMattermost)),
+		validation.Field(&n.Events, validation.Each(validation.In(toInterfaces(NotificationEvents)...))),
+		validation.Field(&n.Timeout, validation.Min(time.Duration(0))),
+	)
+}
+
+func validateWebhookURL(value interface{}) error {
+	if err := validateScriptURL(value); err != nil {
+		return fmt.Errorf("webhook url %w", err)
+	}
+	return nil
+}
+
+// Wants returns true when the event is sent to the webhook
+func (n *Notification) Wants(event string) bool {
+	return len(n.Events) == 0 || contains(n.Events, event)
+}
+
+// Webhook returns the webhook of the notification, with its secret and the
+// values of its headers resolved
+func (n *Notification) Webhook() (*notify.Webhook, error) {
+	key, err := secret.Resolve(n.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("notification %s: secret: %w", notify.Endpoint(n.URL), err)
+	}
+	var headers map[string]string
+	if len(n.Headers) > 0 {
+		headers = make(map[string]string, len(n.Headers))
+		for k, v := range n.Headers {
+			if headers[k], err = secret.Resolve(v); err != nil {
+				return nil, fmt.Errorf("notification %s: header %s: %w", notify.Endpoint(n.URL), k, err)
+			}
+		}
+	}
+	return &notify.Webhook{
+		URL:     n.URL,
+		Format:  n.Format,
+		Secret:  key,
+		Headers: headers,
+		Timeout: n.Timeout,
+	}, nil
+}
+
+func toInterfaces(list []string) []interface{} {
+	values := make([]interface{}, len(list))
+	for i, v := range list {
+		values[i] = v
+	}
+	return values
+}
@@ -0,0 +1,73 @@
+package cluster
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestNotificationUnmarshal(t *testing.T) {
+	data := `
+- url: https://hooks.slack.com/services/T000/B000/XXXX
+  format: slack
+  events: [apply-start, apply-success, apply-failure]
+- url: https://events.example.com/cfctl
+  secret: s3cr3t
+  headers:
+    Authorization: Bearer token
+  timeout: 5s
+`
+	var notifications []*Notification
+	require.NoError(t, yaml.Unmarshal([]byte(data), &notifications))
+	require.Len(t, notifications, 2)
+	for _, n := range notifications {
+		require.NoError(t, n.Validate())
+	}
+
+	require.True(t, notifications[0].Wants("apply-failure"))
+	require.False(t, notifications[0].Wants("backup-start"))
+	require.True(t, notifications[1].Wants("backup-start"))
+
+	w, err := notifications[1].Webhook()
+	require.NoError(t, err)
+	require.Equal(t, "s3cr3t", w.Secret)
+	require.Equal(t, 5*time.Second, w.Timeout)
+	require.Equal(t, map[string]string{"Authorization": "Bearer token"}, w.Headers)
+}
+
+func TestNotificationSecrets(t *testing.T) {
+	t.Setenv("CFCTL_TEST_WEBHOOK_TOKEN", "Bearer from-env")
+	path := filepath.Join(t.TempDir(), "secret")
+	require.NoError(t, os.WriteFile(path, []byte("from-file\n"), 0600))
+
+	n := &Notification{
+		URL:     "https://events.example.com/cfctl",
+		Secret:  "file:" + path,
+		Headers: map[string]string{"Authorization": "env:CFCTL_TEST_WEBHOOK_TOKEN", "X-Team": "hpc"},
+	}
+	w, err := n.Webhook()
+	require.NoError(t, err)
+	require.Equal(t, "from-file", w.Secret)
+	require.Equal(t, map[string]string{"Authorization": "Bearer from-env", "X-Team": "hpc"}, w.Headers)
+	require.Equal(t, "env:CFCTL_TEST_WEBHOOK_TOKEN", n.Headers["Authorization"], "the configuration is not modified")
+
+	n.Headers["Authorization"] = "env:CFCTL_TEST_WEBHOOK_UNSET"
+	_, err = n.Webhook()
+	require.ErrorContains(t, err, "header Authorization")
+}
+
+func TestNotificationValidate(t *testing.T) {
+	for name, n := range map[string]*Notification{
+		"no url":           {},
+		"url scheme":       {URL: "ftp://example.com"},
+		"unknown format":   {URL: "https://example.com", Format: "teams"},
+		"unknown event":    {URL: "https://example.com", Events: []string{"restore-start"}},
+		"negative timeout": {URL: "https://example.com", Timeout: -time.Second},
+	} {
+		require.Error(t, n.Validate(), name)
+	}
+}
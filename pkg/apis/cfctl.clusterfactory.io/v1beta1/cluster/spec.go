@@ -9,8 +9,14 @@ import (
 
 // Spec defines cluster config spec section
 type Spec struct {
-	Hosts Hosts `yaml:"hosts"`
-	K0s   *K0s  `yaml:"k0s"`
+	Hosts   Hosts    `yaml:"hosts"`
+	K0s     *K0s     `yaml:"k0s"`
+	Upgrade *Upgrade `yaml:"upgrade,omitempty"`
+	// ClusterLock locks the whole cluster with a lease in kube-system in
+	// addition to the lock files of the hosts
+	ClusterLock bool `yaml:"clusterLock,omitempty"`
+	// Notifications are webhooks receiving the events of the operations
+	Notifications []*Notification `yaml:"notifications,omitempty"`
 
 	k0sLeader *Host
 }
@@ -64,9 +70,42 @@ func (s *Spec) Validate() error {
 		validation.Field(&s.Hosts, validation.Required),
 		validation.Field(&s.Hosts),
 		validation.Field(&s.K0s),
+		validation.Field(&s.Upgrade),
+		validation.Field(&s.Upgrade, validation.When(s.K0s != nil && s.K0s.IsAutopilot(), validation.By(validateAutopilotUpgrade))),
+		validation.Field(&s.Hosts, validation.When(s.K0s != nil && s.K0s.IsAutopilot(), validation.By(validateAutopilotHosts))),
+		validation.Field(&s.Notifications),
 	)
 }
 
+// validateAutopilotUpgrade refuses the upgrade settings autopilot does not
+// support, autopilot drains and upgrades the workers by itself
+func validateAutopilotUpgrade(value interface{}) error {
+	u, _ := value.(*Upgrade)
+	if u == nil {
+		return nil
+	}
+	switch {
+	case len(u.Pools) > 0:
+		return fmt.Errorf("pools are not supported with the autopilot upgrade strategy")
+	case u.Drain != nil:
+		return fmt.Errorf("drain is not supported with the autopilot upgrade strategy")
+	case len(u.HealthChecks) > 0:
+		return fmt.Errorf("healthChecks are not supported with the autopilot upgrade strategy")
+	}
+	return nil
+}
+
+// validateAutopilotHosts refuses the hosts autopilot would drain anyway
+func validateAutopilotHosts(value interface{}) error {
+	hosts, _ := value.(Hosts)
+	for _, h := range hosts {
+		if !h.ShouldDrain() {
+			return fmt.Errorf("%s: drain: false is not supported with the autopilot upgrade strategy", h)
+		}
+	}
+	return nil
+}
+
 // KubeAPIURL returns an url to the cluster's kube api
 func (s *Spec) KubeAPIURL() string {
 	var caddr string
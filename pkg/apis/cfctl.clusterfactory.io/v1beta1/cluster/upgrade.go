@@ -0,0 +1,362 @@
+package cluster
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alessio/shellescape"
+	"github.com/creasty/defaults"
+	"github.com/jellydator/validation"
+)
+
+// DefaultBatchSize is the share of the workers upgraded in parallel when not configured
+var DefaultBatchSize = BatchSize{value: 10, percent: true}
+
+// BatchSize is a number of hosts such as 2 or a percentage of the hosts such as "25%"
+type BatchSize struct {
+	value   int
+	percent bool
+}
+
+// ParseBatchSize parses a number of hosts or a percentage of the hosts
+func ParseBatchSize(s string) (BatchSize, error) {
+	s = strings.TrimSpace(s)
+	b := BatchSize{}
+	if strings.HasSuffix(s, "%") {
+		b.percent = true
+		s = strings.TrimSpace(strings.TrimSuffix(s, "%"))
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return BatchSize{}, fmt.Errorf("invalid batch size %q: not a number or a percentage", s)
+	}
+	if v < 1 || (b.percent && v > 100) {
+		return BatchSize{}, fmt.Errorf("invalid batch size %q: must be at least 1 and at most 100%%", s)
+	}
+	b.value = v
+	return b, nil
+}
+
+// IsZero returns true when the batch size is not set
+func (b BatchSize) IsZero() bool {
+	return b.value == 0
+}
+
+// Of returns the number of hosts of a batch among n hosts, at least one
+func (b BatchSize) Of(n int) int {
+	if b.IsZero() {
+		b = DefaultBatchSize
+	}
+	size := b.value
+	if b.percent {
+		size = n * b.value / 100
+	}
+	if size < 1 {
+		return 1
+	}
+	return size
+}
+
+// String returns the batch size as written in the configuration
+func (b BatchSize) String() string {
+	if b.percent {
+		return strconv.Itoa(b.value) + "%"
+	}
+	return strconv.Itoa(b.value)
+}
+
+// UnmarshalYAML reads a number or a percentage
+func (b *BatchSize) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	parsed, err := ParseBatchSize(s)
+	if err != nil {
+		return err
+	}
+	*b = parsed
+	return nil
+}
+
+// MarshalYAML writes the batch size as a number or a percentage
+func (b BatchSize) MarshalYAML() (interface{}, error) {
+	if b.IsZero() {
+		return nil, nil
+	}
+	if b.percent {
+		return b.String(), nil
+	}
+	return b.value, nil
+}
+
+// skipPodPattern matches the pod selectors of Drain.SkipPods: "key=value" or "key"
+var skipPodPattern = regexp.MustCompile(`^[A-Za-z0-9][-A-Za-z0-9_./]*(==?[-A-Za-z0-9_.]*)?$`)
+
+// Drain configures how nodes are drained
+type Drain struct {
+	// GracePeriod is given to the pods to terminate
+	GracePeriod time.Duration `yaml:"gracePeriod" default:"120s"`
+	// Timeout is how long to wait for the node to be drained
+	Timeout time.Duration `yaml:"timeout" default:"5m"`
+	// SkipPods are label selectors such as "app=slurmd" of the pods that are
+	// not evicted
+	SkipPods []string `yaml:"skipPods,omitempty"`
+}
+
+// UnmarshalYAML sets in some sane defaults when unmarshaling the data from yaml
+func (d *Drain) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type drain Drain
+	yd := (*drain)(d)
+	if err := defaults.Set(yd); err != nil {
+		return err
+	}
+	return unmarshal(yd)
+}
+
+// Validate the drain configuration
+func (d *Drain) Validate() error {
+	return validation.ValidateStruct(d,
+		validation.Field(&d.GracePeriod, validation.Min(time.Duration(0))),
+		validation.Field(&d.Timeout, validation.Min(time.Second)),
+		validation.Field(&d.SkipPods, validation.Each(validation.Match(skipPodPattern).Error("must be a label selector such as key=value or key"))),
+	)
+}
+
+// Args returns the arguments of kubectl drain
+func (d *Drain) Args() string {
+	if d == nil {
+		d = &Drain{}
+		_ = defaults.Set(d)
+	}
+	args := []string{
+		fmt.Sprintf("--grace-period=%d", int(d.GracePeriod.Seconds())),
+		"--force",
+		"--timeout=" + d.Timeout.String(),
+		"--ignore-daemonsets",
+		"--delete-emptydir-data",
+	}
+	if len(d.SkipPods) > 0 {
+		selectors := make([]string, 0, len(d.SkipPods))
+		for _, s := range d.SkipPods {
+			key, value, ok := strings.Cut(strings.Replace(s, "==", "=", 1), "=")
+			if ok {
+				selectors = append(selectors, key+"!="+value)
+			} else {
+				selectors = append(selectors, "!"+key)
+			}
+		}
+		args = append(args, "--pod-selector="+shellescape.Quote(strings.Join(selectors, ",")))
+	}
+	return strings.Join(args, " ")
+}
+
+// UpgradePool sets the batch size and the drain configuration of the hosts
+// with a role or with node labels
+type UpgradePool struct {
+	Name string `yaml:"name,omitempty"`
+	// Role matches the hosts with the role
+	Role string `yaml:"role,omitempty"`
+	// Labels matches the hosts with all the labels in their --labels install flag
+	Labels    map[string]string `yaml:"labels,omitempty"`
+	BatchSize BatchSize         `yaml:"batchSize,omitempty"`
+	// Drain overrides the drain configuration of the upgrade
+	Drain *Drain `yaml:"drain,omitempty"`
+}
+
+// String returns the name of the pool or its selector
+func (p *UpgradePool) String() string {
+	if p.Name != "" {
+		return p.Name
+	}
+	var s []string
+	if p.Role != "" {
+		s = append(s, "role="+p.Role)
+	}
+	for k, v := range p.Labels {
+		s = append(s, k+"="+v)
+	}
+	return strings.Join(s, ",")
+}
+
+// Match returns true when the host belongs to the pool
+func (p *UpgradePool) Match(h *Host) bool {
+	if p.Role != "" && h.Role != p.Role {
+		return false
+	}
+	labels := h.Labels()
+	for k, v := range p.Labels {
+		if lv, ok := labels[k]; !ok || lv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate the pool
+func (p *UpgradePool) Validate() error {
+	return validation.ValidateStruct(p,
+		validation.Field(&p.Role, validation.In("worker", "controller+worker").Error("pools can only select workers"), validation.Required.When(len(p.Labels) == 0).Error("role or labels required")),
+		validation.Field(&p.Drain),
+	)
+}
+
+// HealthCheck is a check run after the upgrade of each batch of workers,
+// either a local command, a remote command run on every upgraded worker or
+// kubectl arguments run on the leader
+type HealthCheck struct {
+	Name    string `yaml:"name,omitempty"`
+	Local   string `yaml:"local,omitempty"`
+	Remote  string `yaml:"remote,omitempty"`
+	Kubectl string `yaml:"kubectl,omitempty"`
+	// Expect is a regular expression the output of the command must match
+	Expect string `yaml:"expect,omitempty"`
+	// Timeout is how long the check is retried until it passes
+	Timeout time.Duration `yaml:"timeout" default:"1m"`
+}
+
+// UnmarshalYAML sets in some sane defaults when unmarshaling the data from yaml
+func (c *HealthCheck) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type healthCheck HealthCheck
+	yc := (*healthCheck)(c)
+	if err := defaults.Set(yc); err != nil {
+		return err
+	}
+	return unmarshal(yc)
+}
+
+// String returns the name of the check or its command
+func (c *HealthCheck) String() string {
+	switch {
+	case c.Name != "":
+		return c.Name
+	case c.Local != "":
+		return c.Local
+	case c.Remote != "":
+		return c.Remote
+	default:
+		return "kubectl " + c.Kubectl
+	}
+}
+
+// Validate the health check
+func (c *HealthCheck) Validate() error {
+	commands := 0
+	for _, cmd := range []string{c.Local, c.Remote, c.Kubectl} {
+		if cmd != "" {
+			commands++
+		}
+	}
+	if commands != 1 {
+		return fmt.Errorf("health check %s: exactly one of local, remote or kubectl required", c)
+	}
+	return validation.ValidateStruct(c,
+		validation.Field(&c.Expect, validation.By(func(interface{}) error {
+			_, err := regexp.Compile(c.Expect)
+			return err
+		})),
+		validation.Field(&c.Timeout, validation.Min(time.Duration(0))),
+	)
+}
+
+// Check returns an error unless the output of the command matches Expect
+func (c *HealthCheck) Check(output string) error {
+	if c.Expect == "" {
+		return nil
+	}
+	output = strings.TrimSpace(output)
+	matched, err := regexp.MatchString(c.Expect, output)
+	if err != nil {
+		return err
+	}
+	if !matched {
+		return fmt.Errorf("output %q does not match %q", output, c.Expect)
+	}
+	return nil
+}
+
+// Upgrade configures how the workers are upgraded
+type Upgrade struct {
+	// BatchSize is the number or the percentage of the workers upgraded in
+	// parallel, 10% by default
+	BatchSize BatchSize `yaml:"batchSize,omitempty"`
+	Drain     *Drain    `yaml:"drain,omitempty"`
+	// Pools are upgraded one after the other, in order, before the hosts
+	// of no pool
+	Pools []*UpgradePool `yaml:"pools,omitempty"`
+	// HealthChecks run after every batch, the upgrade stops when one fails
+	HealthChecks []*HealthCheck `yaml:"healthChecks,omitempty"`
+}
+
+// Validate the upgrade configuration
+func (u *Upgrade) Validate() error {
+	return validation.ValidateStruct(u,
+		validation.Field(&u.Drain),
+		validation.Field(&u.Pools),
+		validation.Field(&u.HealthChecks),
+	)
+}
+
+// Checks returns the health checks
+func (u *Upgrade) Checks() []*HealthCheck {
+	if u == nil {
+		return nil
+	}
+	return u.HealthChecks
+}
+
+// UpgradeBatch is a group of hosts upgraded with the same settings
+type UpgradeBatch struct {
+	// Name is the name of the pool, empty for the hosts of no pool
+	Name  string
+	Hosts Hosts
+	// Size is the number of hosts upgraded in parallel
+	Size  int
+	Drain *Drain
+}
+
+// Batches groups hosts by the first pool matching them, in the order of the
+// pools, the hosts of no pool last
+func (u *Upgrade) Batches(hosts Hosts) []*UpgradeBatch {
+	if u == nil {
+		u = &Upgrade{}
+	}
+	pooled := make([]Hosts, len(u.Pools))
+	var rest Hosts
+	for _, h := range hosts {
+		found := false
+		for i, p := range u.Pools {
+			if p.Match(h) {
+				pooled[i] = append(pooled[i], h)
+				found = true
+				break
+			}
+		}
+		if !found {
+			rest = append(rest, h)
+		}
+	}
+
+	var batches []*UpgradeBatch
+	for i, p := range u.Pools {
+		if len(pooled[i]) == 0 {
+			continue
+		}
+		size := p.BatchSize
+		if size.IsZero() {
+			size = u.BatchSize
+		}
+		drain := p.Drain
+		if drain == nil {
+			drain = u.Drain
+		}
+		batches = append(batches, &UpgradeBatch{Name: p.String(), Hosts: pooled[i], Size: size.Of(len(pooled[i])), Drain: drain})
+	}
+	if len(rest) > 0 {
+		batches = append(batches, &UpgradeBatch{Hosts: rest, Size: u.BatchSize.Of(len(rest)), Drain: u.Drain})
+	}
+	return batches
+}
@@ -0,0 +1,151 @@
+package cluster
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestBatchSize(t *testing.T) {
+	var u Upgrade
+	require.Equal(t, 1, u.BatchSize.Of(5))
+	require.Equal(t, 3, u.BatchSize.Of(30))
+
+	b, err := ParseBatchSize("25%")
+	require.NoError(t, err)
+	require.Equal(t, 2, b.Of(10))
+	require.Equal(t, 1, b.Of(3))
+
+	b, err = ParseBatchSize("4")
+	require.NoError(t, err)
+	require.Equal(t, 4, b.Of(100))
+
+	for _, s := range []string{"0", "-1", "101%", "a", "1.5"} {
+		_, err := ParseBatchSize(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestUpgradeUnmarshal(t *testing.T) {
+	var u Upgrade
+	require.NoError(t, yaml.Unmarshal([]byte(`
+batchSize: 20%
+drain:
+  gracePeriod: 10m
+  skipPods: [app=slurmd]
+pools:
+  - name: gpu
+    labels:
+      pool: gpu
+    batchSize: 1
+`), &u))
+	require.NoError(t, u.Validate())
+	require.Equal(t, "20%", u.BatchSize.String())
+	require.Equal(t, 10*time.Minute, u.Drain.GracePeriod)
+	require.Equal(t, 5*time.Minute, u.Drain.Timeout)
+	require.Equal(t, "1", u.Pools[0].BatchSize.String())
+
+	out, err := yaml.Marshal(&u)
+	require.NoError(t, err)
+	require.Contains(t, string(out), "batchSize: 20%")
+	require.Contains(t, string(out), "batchSize: 1\n")
+
+	u.Pools[0].Labels = nil
+	require.ErrorContains(t, u.Validate(), "role or labels required")
+	u.Pools[0].Role = "controller"
+	require.ErrorContains(t, u.Validate(), "pools can only select workers")
+}
+
+func TestDrainArgs(t *testing.T) {
+	var d *Drain
+	require.Equal(t, "--grace-period=120 --force --timeout=5m0s --ignore-daemonsets --delete-emptydir-data", d.Args())
+
+	d = &Drain{GracePeriod: time.Hour, Timeout: 2 * time.Hour, SkipPods: []string{"app=slurmd", "critical", "tier==db"}}
+	require.NoError(t, d.Validate())
+	require.Equal(t, "--grace-period=3600 --force --timeout=2h0m0s --ignore-daemonsets --delete-emptydir-data --pod-selector='app!=slurmd,!critical,tier!=db'", d.Args())
+
+	d.SkipPods = []string{"app in (a,b)"}
+	require.Error(t, d.Validate())
+}
+
+func TestUpgradeBatches(t *testing.T) {
+	gpu := []*Host{
+		{Role: "worker", InstallFlags: Flags{`--labels="pool=gpu,zone=a"`}},
+		{Role: "worker", InstallFlags: Flags{`--labels=pool=gpu`}},
+	}
+	var rest Hosts
+	for i := 0; i < 20; i++ {
+		rest = append(rest, &Host{Role: "worker"})
+	}
+	hosts := append(Hosts{rest[0], gpu[0]}, rest[1:]...)
+	hosts = append(hosts, gpu[1])
+
+	gpuDrain := &Drain{GracePeriod: time.Hour}
+	u := &Upgrade{
+		BatchSize: BatchSize{value: 50, percent: true},
+		Pools: []*UpgradePool{
+			{Name: "gpu", Labels: map[string]string{"pool": "gpu"}, BatchSize: BatchSize{value: 1}, Drain: gpuDrain},
+			{Name: "empty", Labels: map[string]string{"pool": "none"}},
+		},
+	}
+	batches := u.Batches(hosts)
+	require.Len(t, batches, 2)
+	require.Equal(t, "gpu", batches[0].Name)
+	require.Equal(t, Hosts{gpu[0], gpu[1]}, batches[0].Hosts)
+	require.Equal(t, 1, batches[0].Size)
+	require.Same(t, gpuDrain, batches[0].Drain)
+	require.Equal(t, "", batches[1].Name)
+	require.Len(t, batches[1].Hosts, 20)
+	require.Equal(t, 10, batches[1].Size)
+	require.Nil(t, batches[1].Drain)
+
+	var none *Upgrade
+	batches = none.Batches(hosts)
+	require.Len(t, batches, 1)
+	require.Equal(t, 2, batches[0].Size)
+}
+
+func TestHostDrainAndLabels(t *testing.T) {
+	h := &Host{}
+	require.True(t, h.ShouldDrain())
+	no := false
+	h.Drain = &no
+	require.False(t, h.ShouldDrain())
+
+	h.InstallFlags = Flags{`--labels="topology.kubernetes.io/zone=a,pool=gpu"`}
+	require.Equal(t, map[string]string{"topology.kubernetes.io/zone": "a", "pool": "gpu"}, h.Labels())
+}
+
+func TestHealthCheck(t *testing.T) {
+	var u Upgrade
+	require.NoError(t, yaml.Unmarshal([]byte(`
+healthChecks:
+  - name: dns
+    kubectl: get pods -n kube-system -l k8s-app=kube-dns -o jsonpath={.items[*].status.phase}
+    expect: ^(Running ?)+$
+  - remote: systemctl is-active slurmd
+    timeout: 5m
+`), &u))
+	require.NoError(t, u.Validate())
+	checks := u.Checks()
+	require.Len(t, checks, 2)
+	require.Equal(t, "dns", checks[0].String())
+	require.Equal(t, time.Minute, checks[0].Timeout)
+	require.Equal(t, "systemctl is-active slurmd", checks[1].String())
+	require.Equal(t, 5*time.Minute, checks[1].Timeout)
+
+	require.NoError(t, checks[0].Check("Running Running\n"))
+	require.ErrorContains(t, checks[0].Check("Running Pending"), "does not match")
+	require.NoError(t, checks[1].Check("anything"))
+
+	checks[1].Local = "true"
+	require.ErrorContains(t, u.Validate(), "exactly one of")
+	checks[1].Local = ""
+	checks[0].Expect = "("
+	require.Error(t, u.Validate())
+
+	var none *Upgrade
+	require.Empty(t, none.Checks())
+}
@@ -0,0 +1,260 @@
+// Package autopilot builds the k0s Autopilot plans upgrading the clusters and
+// reads their status
+package autopilot
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"text/template"
+	"time"
+
+	"github.com/k0sproject/version"
+)
+
+// PlanName is the name of the plan, autopilot only runs the plan with this name
+const PlanName = "autopilot"
+
+// APIVersion is the version of the autopilot API of the plans
+const APIVersion = "autopilot.k0sproject.io/v1beta2"
+
+// States of the plans and of their nodes
+const (
+	StateSchedulable     = "Schedulable"
+	StateSchedulableWait = "SchedulableWait"
+	StateCompleted       = "Completed"
+	// StateSignalCompleted is the state of the nodes that were upgraded
+	StateSignalCompleted = "SignalCompleted"
+)
+
+// Plan is an autopilot plan
+type Plan struct {
+	APIVersion string     `json:"apiVersion"`
+	Kind       string     `json:"kind"`
+	Metadata   Metadata   `json:"metadata"`
+	Spec       PlanSpec   `json:"spec"`
+	Status     PlanStatus `json:"status"`
+}
+
+// Metadata of a plan
+type Metadata struct {
+	Name string `json:"name"`
+}
+
+// PlanSpec holds the commands of a plan
+type PlanSpec struct {
+	ID        string    `json:"id"`
+	Timestamp string    `json:"timestamp"`
+	Commands  []Command `json:"commands"`
+}
+
+// Command is a command of a plan
+type Command struct {
+	K0sUpdate *K0sUpdate `json:"k0supdate,omitempty"`
+}
+
+// K0sUpdate updates k0s on the targets
+type K0sUpdate struct {
+	Version   string               `json:"version"`
+	Platforms map[string]*Resource `json:"platforms"`
+	Targets   Targets              `json:"targets"`
+}
+
+// Resource is the url of a binary
+type Resource struct {
+	URL string `json:"url"`
+}
+
+// Targets are the controllers and the workers to update
+type Targets struct {
+	Controllers *Target `json:"controllers,omitempty"`
+	Workers     *Target `json:"workers,omitempty"`
+}
+
+// Target selects nodes
+type Target struct {
+	Discovery Discovery `json:"discovery"`
+	Limits    *Limits   `json:"limits,omitempty"`
+}
+
+// Discovery selects nodes by name or by selector
+type Discovery struct {
+	Static   *Static   `json:"static,omitempty"`
+	Selector *Selector `json:"selector,omitempty"`
+}
+
+// Static lists nodes by name
+type Static struct {
+	Nodes []string `json:"nodes"`
+}
+
+// Selector selects nodes by labels and fields
+type Selector struct {
+	Labels string `json:"labels,omitempty"`
+	Fields string `json:"fields,omitempty"`
+}
+
+// Limits limits the number of nodes updated at once
+type Limits struct {
+	Concurrent int `json:"concurrent"`
+}
+
+// PlanStatus is the status of a plan
+type PlanStatus struct {
+	State    string          `json:"state,omitempty"`
+	Commands []CommandStatus `json:"commands,omitempty"`
+}
+
+// CommandStatus is the status of a command of a plan
+type CommandStatus struct {
+	ID        int              `json:"id"`
+	State     string           `json:"state,omitempty"`
+	K0sUpdate *K0sUpdateStatus `json:"k0supdate,omitempty"`
+}
+
+// K0sUpdateStatus is the status of the nodes of a k0s update
+type K0sUpdateStatus struct {
+	Controllers []NodeStatus `json:"controllers,omitempty"`
+	Workers     []NodeStatus `json:"workers,omitempty"`
+}
+
+// NodeStatus is the state of a node
+type NodeStatus struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+}
+
+// Done returns true when the plan is not running anymore
+func (s PlanStatus) Done() bool {
+	return s.State != "" && s.State != StateSchedulable && s.State != StateSchedulableWait
+}
+
+// Nodes returns the state of the nodes of the plan by name
+func (s PlanStatus) Nodes() map[string]string {
+	nodes := make(map[string]string)
+	for _, c := range s.Commands {
+		if c.K0sUpdate == nil {
+			continue
+		}
+		for _, n := range c.K0sUpdate.Controllers {
+			nodes[n.Name] = n.State
+		}
+		for _, n := range c.K0sUpdate.Workers {
+			nodes[n.Name] = n.State
+		}
+	}
+	return nodes
+}
+
+// Incomplete returns the names of the nodes that were not upgraded, sorted
+func (s PlanStatus) Incomplete() []string {
+	var names []string
+	for name, state := range s.Nodes() {
+		if state != StateSignalCompleted && state != StateCompleted {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParsePlan parses the JSON output of "kubectl get plan"
+func ParsePlan(data []byte) (*Plan, error) {
+	p := &Plan{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("invalid autopilot plan: %w", err)
+	}
+	return p, nil
+}
+
+// URLData is the data of the binary url templates
+type URLData struct {
+	// Version is the k0s version such as v1.28.4+k0s.0
+	Version string
+	OS      string
+	Arch    string
+}
+
+// BinaryURL returns the url of the k0s binary of a platform, from the url
+// template or from the k0s releases on github when empty
+func BinaryURL(tmpl string, v *version.Version, os, arch string) (string, error) {
+	if tmpl == "" {
+		return v.DownloadURL(os, arch), nil
+	}
+	t, err := template.New("url").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("invalid binary url template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, URLData{Version: v.String(), OS: os, Arch: arch}); err != nil {
+		return "", fmt.Errorf("invalid binary url template: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// PlanOptions are the targets of an update plan
+type PlanOptions struct {
+	Version *version.Version
+	// Platforms maps "os-arch" to the urls of the binaries
+	Platforms map[string]string
+	// Controllers are the names of the controllers to update
+	Controllers []string
+	// Workers are the names of the workers to update, unless WorkerSelector is set
+	Workers []string
+	// WorkerSelector selects the workers to update by labels
+	WorkerSelector string
+	// Concurrent is the number of workers updated at once
+	Concurrent int
+}
+
+// NewPlan returns the plan updating k0s on the targets
+func NewPlan(opts PlanOptions, now time.Time) *Plan {
+	update := &K0sUpdate{
+		Version:   opts.Version.String(),
+		Platforms: make(map[string]*Resource),
+	}
+	for platform, url := range opts.Platforms {
+		update.Platforms[platform] = &Resource{URL: url}
+	}
+	if len(opts.Controllers) > 0 {
+		update.Targets.Controllers = &Target{
+			Discovery: Discovery{Static: &Static{Nodes: opts.Controllers}},
+			Limits:    &Limits{Concurrent: 1},
+		}
+	}
+	switch {
+	case opts.WorkerSelector != "":
+		update.Targets.Workers = &Target{Discovery: Discovery{Selector: &Selector{Labels: opts.WorkerSelector}}}
+	case len(opts.Workers) > 0:
+		update.Targets.Workers = &Target{Discovery: Discovery{Static: &Static{Nodes: opts.Workers}}}
+	}
+	if update.Targets.Workers != nil && opts.Concurrent > 0 {
+		update.Targets.Workers.Limits = &Limits{Concurrent: opts.Concurrent}
+	}
+
+	return &Plan{
+		APIVersion: APIVersion,
+		Kind:       "Plan",
+		Metadata:   Metadata{Name: PlanName},
+		Spec: PlanSpec{
+			ID:        fmt.Sprintf("cfctl-%d", now.Unix()),
+			Timestamp: now.UTC().Format(time.RFC3339),
+			Commands:  []Command{{K0sUpdate: update}},
+		},
+	}
+}
+
+// Manifest returns the JSON manifest of the plan, without its status
+func (p *Plan) Manifest() (string, error) {
+	data, err := json.Marshal(struct {
+		APIVersion string   `json:"apiVersion"`
+		Kind       string   `json:"kind"`
+		Metadata   Metadata `json:"metadata"`
+		Spec       PlanSpec `json:"spec"`
+	}{p.APIVersion, p.Kind, p.Metadata, p.Spec})
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,116 @@
+package autopilot
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/k0sproject/version"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBinaryURL(t *testing.T) {
+	v := version.MustParse("v1.28.4+k0s.0")
+
+	url, err := BinaryURL("", v, "linux", "arm64")
+	require.NoError(t, err)
+	require.Equal(t, v.DownloadURL("linux", "arm64"), url)
+
+	url, err = BinaryURL("https://mirror.example.com/{{.Version}}/k0s-{{.OS}}-{{.Arch}}", v, "linux", "amd64")
+	require.NoError(t, err)
+	require.Equal(t, "https://mirror.example.com/v1.28.4+k0s.0/k0s-linux-amd64", url)
+
+	_, err = BinaryURL("https://mirror.example.com/{{.Missing}}", v, "linux", "amd64")
+	require.Error(t, err)
+}
+
+func TestNewPlan(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	opts := PlanOptions{
+		Version:     version.MustParse("v1.28.4+k0s.0"),
+		Platforms:   map[string]string{"linux-amd64": "https://example.com/k0s"},
+		Controllers: []string{"controller-0"},
+		Workers:     []string{"worker-0", "worker-1"},
+		Concurrent:  2,
+	}
+
+	t.Run("static workers", func(t *testing.T) {
+		plan := NewPlan(opts, now)
+		manifest, err := plan.Manifest()
+		require.NoError(t, err)
+
+		var m map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(manifest), &m))
+		require.Equal(t, APIVersion, m["apiVersion"])
+		require.Equal(t, "Plan", m["kind"])
+		require.NotContains(t, m, "status")
+
+		spec := m["spec"].(map[string]interface{})
+		require.Equal(t, "cfctl-1700000000", spec["id"])
+		require.Equal(t, "2023-11-14T22:13:20Z", spec["timestamp"])
+
+		update := plan.Spec.Commands[0].K0sUpdate
+		require.Equal(t, "v1.28.4+k0s.0", update.Version)
+		require.Equal(t, "https://example.com/k0s", update.Platforms["linux-amd64"].URL)
+		require.Equal(t, []string{"controller-0"}, update.Targets.Controllers.Discovery.Static.Nodes)
+		require.Equal(t, 1, update.Targets.Controllers.Limits.Concurrent)
+		require.Equal(t, []string{"worker-0", "worker-1"}, update.Targets.Workers.Discovery.Static.Nodes)
+		require.Equal(t, 2, update.Targets.Workers.Limits.Concurrent)
+	})
+
+	t.Run("worker selector", func(t *testing.T) {
+		opts := opts
+		opts.WorkerSelector = "pool=gpu"
+		opts.Controllers = nil
+		update := NewPlan(opts, now).Spec.Commands[0].K0sUpdate
+		require.Nil(t, update.Targets.Controllers)
+		require.Nil(t, update.Targets.Workers.Discovery.Static)
+		require.Equal(t, "pool=gpu", update.Targets.Workers.Discovery.Selector.Labels)
+	})
+}
+
+func TestParsePlan(t *testing.T) {
+	out := `{
+  "apiVersion": "autopilot.k0sproject.io/v1beta2",
+  "kind": "Plan",
+  "metadata": {"name": "autopilot"},
+  "spec": {"id": "cfctl-1", "timestamp": "now", "commands": []},
+  "status": {
+    "state": "IncompleteTargets",
+    "commands": [{
+      "id": 0,
+      "state": "IncompleteTargets",
+      "k0supdate": {
+        "controllers": [{"name": "controller-0", "state": "SignalCompleted"}],
+        "workers": [
+          {"name": "worker-1", "state": "SignalSent"},
+          {"name": "worker-0", "state": "SignalCompleted"},
+          {"name": "worker-2", "state": "SignalMissingNode"}
+        ]
+      }
+    }]
+  }
+}`
+	plan, err := ParsePlan([]byte(out))
+	require.NoError(t, err)
+	require.Equal(t, "cfctl-1", plan.Spec.ID)
+	require.True(t, plan.Status.Done())
+	require.Equal(t, "SignalSent", plan.Status.Nodes()["worker-1"])
+	require.Equal(t, []string{"worker-1", "worker-2"}, plan.Status.Incomplete())
+
+	_, err = ParsePlan([]byte("not json"))
+	require.Error(t, err)
+}
+
+func TestDone(t *testing.T) {
+	for state, done := range map[string]bool{
+		"":                    false,
+		StateSchedulable:      false,
+		StateSchedulableWait:  false,
+		StateCompleted:        true,
+		"InconsistentTargets": true,
+		"MissingSignalNode":   true,
+	} {
+		require.Equal(t, done, PlanStatus{State: state}.Done(), state)
+	}
+}
@@ -0,0 +1,107 @@
+// Package backup stores k0s backup archives in local directories, S3
+// compatible object stores or SFTP servers and prunes them with a retention
+// policy.
+package backup
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Destination stores backup archives
+type Destination interface {
+	// Put streams an archive to the destination
+	Put(ctx context.Context, name string, r io.Reader) error
+	// Get returns a reader of a file of the destination, the error matches
+	// os.ErrNotExist when there is no such file
+	Get(ctx context.Context, name string) (io.ReadCloser, error)
+	// List returns the names of the files of the destination
+	List(ctx context.Context) ([]string, error)
+	// Delete removes an archive from the destination
+	Delete(ctx context.Context, name string) error
+	// String returns the location of the destination
+	String() string
+}
+
+// ParseDestination returns the destination for a local directory,
+// "s3://bucket/prefix" or "sftp://user@host:port/path" location
+func ParseDestination(location string) (Destination, error) {
+	if location == "" {
+		location = "."
+	}
+	if !strings.Contains(location, "://") {
+		return NewLocal(location), nil
+	}
+
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backup destination: %w", err)
+	}
+	switch u.Scheme {
+	case "file":
+		return NewLocal(u.Path), nil
+	case "s3":
+		return NewS3(u)
+	case "sftp":
+		return NewSFTP(u)
+	default:
+		return nil, fmt.Errorf("unsupported backup destination scheme %q (s3, sftp or a local directory)", u.Scheme)
+	}
+}
+
+var archiveNameRegex = regexp.MustCompile(`^k0s_backup_(\d+)(_[^.]+)?\.tar\.gz(\.age|\.gpg)?$`)
+
+// Archive is a backup archive stored in a destination
+type Archive struct {
+	Name string
+	Time time.Time
+}
+
+// ArchiveName returns the name of an archive taken at t
+func ArchiveName(t time.Time) string {
+	return fmt.Sprintf("k0s_backup_%d.tar.gz", t.Unix())
+}
+
+// ParseArchiveName returns the archive for a file name, false when the name is
+// not the name of a backup archive
+func ParseArchiveName(name string) (Archive, bool) {
+	res := archiveNameRegex.FindStringSubmatch(name)
+	if len(res) != 4 {
+		return Archive{}, false
+	}
+	unix, err := strconv.ParseInt(res[1], 10, 64)
+	if err != nil {
+		return Archive{}, false
+	}
+	return Archive{Name: name, Time: time.Unix(unix, 0)}, true
+}
+
+// ListArchives returns the archives of a destination, newest first
+func ListArchives(ctx context.Context, d Destination) ([]Archive, error) {
+	names, err := d.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var archives []Archive
+	for _, name := range names {
+		if a, ok := ParseArchiveName(name); ok {
+			archives = append(archives, a)
+		}
+	}
+	sortArchives(archives)
+	return archives, nil
+}
+
+// sortArchives sorts the archives newest first
+func sortArchives(archives []Archive) {
+	sort.SliceStable(archives, func(i, j int) bool {
+		return archives[i].Time.After(archives[j].Time)
+	})
+}
@@ -0,0 +1,286 @@
+package backup
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+)
+
+const (
+	// EncryptionAge is the encryption of the archives encrypted for age recipients
+	EncryptionAge = "age"
+	// EncryptionGPG is the encryption of the archives encrypted for GPG recipients
+	EncryptionGPG = "gpg"
+)
+
+// Encrypter encrypts the archives for a set of recipients
+type Encrypter interface {
+	// Encrypt returns a writer encrypting to w, the archive is complete once
+	// the writer is closed
+	Encrypt(w io.Writer) (io.WriteCloser, error)
+	// Encryption returns EncryptionAge or EncryptionGPG, it is also the
+	// extension of the encrypted archives
+	Encryption() string
+	// Recipients returns the recipients the archives are encrypted for
+	Recipients() []string
+}
+
+// NewEncrypter returns an encrypter for age public keys ("age1...") or GPG
+// key IDs, fingerprints or emails. Both kinds can not be mixed.
+func NewEncrypter(recipients []string) (Encrypter, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("no recipient given")
+	}
+
+	var ageRecipients []*age.X25519Recipient
+	var gpgRecipients []string
+	for _, r := range recipients {
+		r = strings.TrimSpace(r)
+		if strings.HasPrefix(r, "age1") {
+			recipient, err := age.ParseX25519Recipient(r)
+			if err != nil {
+				return nil, fmt.Errorf("invalid age recipient %q: %w", r, err)
+			}
+			ageRecipients = append(ageRecipients, recipient)
+			continue
+		}
+		if r == "" || strings.HasPrefix(r, "-") {
+			return nil, fmt.Errorf("invalid gpg recipient %q", r)
+		}
+		gpgRecipients = append(gpgRecipients, r)
+	}
+
+	switch {
+	case len(ageRecipients) > 0 && len(gpgRecipients) > 0:
+		return nil, errors.New("age and gpg recipients can not be mixed")
+	case len(ageRecipients) > 0:
+		return &ageEncrypter{recipients: ageRecipients}, nil
+	default:
+		if _, err := exec.LookPath("gpg"); err != nil {
+			return nil, fmt.Errorf("gpg recipients need the gpg command: %w", err)
+		}
+		return &gpgEncrypter{recipients: gpgRecipients}, nil
+	}
+}
+
+type ageEncrypter struct {
+	recipients []*age.X25519Recipient
+}
+
+func (e *ageEncrypter) Encrypt(w io.Writer) (io.WriteCloser, error) {
+	recipients := make([]age.Recipient, 0, len(e.recipients))
+	for _, r := range e.recipients {
+		recipients = append(recipients, r)
+	}
+	return age.Encrypt(w, recipients...)
+}
+
+func (e *ageEncrypter) Encryption() string {
+	return EncryptionAge
+}
+
+func (e *ageEncrypter) Recipients() []string {
+	recipients := make([]string, 0, len(e.recipients))
+	for _, r := range e.recipients {
+		recipients = append(recipients, r.String())
+	}
+	return recipients
+}
+
+type gpgEncrypter struct {
+	recipients []string
+}
+
+func (e *gpgEncrypter) Encrypt(w io.Writer) (io.WriteCloser, error) {
+	// the keys of the recipients must be trusted in the keyring, gpg refuses
+	// to encrypt to unverified keys in batch mode
+	args := []string{"--batch", "--yes", "--encrypt", "--output", "-"}
+	for _, r := range e.recipients {
+		args = append(args, "--recipient", r)
+	}
+	cmd := exec.Command("gpg", args...)
+	cmd.Stdout = w
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start gpg: %w", err)
+	}
+	return &gpgWriter{WriteCloser: stdin, cmd: cmd, stderr: stderr}, nil
+}
+
+func (e *gpgEncrypter) Encryption() string {
+	return EncryptionGPG
+}
+
+func (e *gpgEncrypter) Recipients() []string {
+	return e.recipients
+}
+
+// PublicKeys returns the armored public keys of the GPG recipients of an
+// encrypter, in the order of its recipients, once gpg accepted to encrypt for
+// them. Age encrypters have no keys to export.
+func PublicKeys(e Encrypter) ([]string, error) {
+	g, ok := e.(*gpgEncrypter)
+	if !ok {
+		return nil, nil
+	}
+
+	// gpg refuses to encrypt to keys it does not trust
+	w, err := g.Encrypt(io.Discard)
+	if err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(g.recipients))
+	for _, r := range g.recipients {
+		out, err := exec.Command("gpg", "--batch", "--armor", "--export", r).Output()
+		if err != nil {
+			return nil, fmt.Errorf("export the gpg key of %s: %w", r, err)
+		}
+		if len(bytes.TrimSpace(out)) == 0 {
+			return nil, fmt.Errorf("no gpg public key found for %s", r)
+		}
+		keys = append(keys, string(out))
+	}
+	return keys, nil
+}
+
+// gpgWriter waits for gpg to write the end of the archive on Close
+type gpgWriter struct {
+	io.WriteCloser
+	cmd    *exec.Cmd
+	stderr *bytes.Buffer
+}
+
+func (w *gpgWriter) Close() error {
+	closeErr := w.WriteCloser.Close()
+	if err := w.cmd.Wait(); err != nil {
+		return fmt.Errorf("gpg: %w: %s", err, strings.TrimSpace(w.stderr.String()))
+	}
+	return closeErr
+}
+
+// EncryptionOf returns the encryption of an archive from its name, empty when
+// the archive is not encrypted
+func EncryptionOf(name string) string {
+	switch {
+	case strings.HasSuffix(name, "."+EncryptionAge):
+		return EncryptionAge
+	case strings.HasSuffix(name, "."+EncryptionGPG):
+		return EncryptionGPG
+	default:
+		return ""
+	}
+}
+
+// ReadAgeIdentities reads an age identity file
+func ReadAgeIdentities(path string) ([]age.Identity, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ids, err := age.ParseIdentities(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return ids, nil
+}
+
+// Decrypt returns the plaintext of an archive read from r, decrypted according
+// to the extension of its name. Archives that are not encrypted are returned
+// as is. Age archives are decrypted with the identities and GPG archives with
+// the keys of the gpg agent.
+func Decrypt(name string, r io.Reader, identities []age.Identity) (io.ReadCloser, error) {
+	switch EncryptionOf(name) {
+	case EncryptionAge:
+		if len(identities) == 0 {
+			return nil, fmt.Errorf("%s is encrypted with age, an identity file is needed to decrypt it", name)
+		}
+		plain, err := age.Decrypt(r, identities...)
+		if err != nil {
+			return nil, fmt.Errorf("decrypt %s: %w", name, err)
+		}
+		return io.NopCloser(plain), nil
+
+	case EncryptionGPG:
+		cmd := exec.Command("gpg", "--batch", "--quiet", "--decrypt")
+		cmd.Stdin = r
+		stderr := &bytes.Buffer{}
+		cmd.Stderr = stderr
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := cmd.Start(); err != nil {
+			return nil, fmt.Errorf("start gpg: %w", err)
+		}
+		return &gpgReader{ReadCloser: stdout, cmd: cmd, stderr: stderr}, nil
+
+	default:
+		return io.NopCloser(r), nil
+	}
+}
+
+// gpgReader reports the failures of gpg, such as a missing key, on Close
+type gpgReader struct {
+	io.ReadCloser
+	cmd    *exec.Cmd
+	stderr *bytes.Buffer
+}
+
+func (r *gpgReader) Close() error {
+	// drain so that gpg does not block on a full pipe
+	_, _ = io.Copy(io.Discard, r.ReadCloser)
+	if err := r.cmd.Wait(); err != nil {
+		return fmt.Errorf("gpg: %w: %s", err, strings.TrimSpace(r.stderr.String()))
+	}
+	return nil
+}
+
+// DecryptFile decrypts a local archive into a temporary file readable only by
+// the current user and returns its path, the caller removes it
+func DecryptFile(path string, identities []age.Identity) (string, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	plain, err := Decrypt(filepath.Base(path), in, identities)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := os.CreateTemp("", "k0s_backup_*.tar.gz")
+	if err != nil {
+		_ = plain.Close()
+		return "", err
+	}
+	_, err = io.Copy(out, plain)
+	if cerr := plain.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(out.Name())
+		return "", fmt.Errorf("decrypt %s: %w", path, err)
+	}
+	return out.Name(), nil
+}
@@ -0,0 +1,94 @@
+package backup
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewEncrypter(t *testing.T) {
+	id, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+
+	e, err := NewEncrypter([]string{id.Recipient().String()})
+	require.NoError(t, err)
+	require.Equal(t, EncryptionAge, e.Encryption())
+	require.Equal(t, []string{id.Recipient().String()}, e.Recipients())
+
+	_, err = NewEncrypter([]string{id.Recipient().String(), "ops@example.com"})
+	require.Error(t, err, "age and gpg recipients can not be mixed")
+	_, err = NewEncrypter([]string{"age1invalid"})
+	require.Error(t, err)
+	_, err = NewEncrypter([]string{"--homedir"})
+	require.Error(t, err)
+	_, err = NewEncrypter(nil)
+	require.Error(t, err)
+}
+
+func TestDecryptFile(t *testing.T) {
+	id, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	e, err := NewEncrypter([]string{id.Recipient().String()})
+	require.NoError(t, err)
+
+	encrypted := &bytes.Buffer{}
+	w, err := e.Encrypt(encrypted)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("etcd snapshot"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	path := filepath.Join(t.TempDir(), "k0s_backup_1.tar.gz.age")
+	require.NoError(t, os.WriteFile(path, encrypted.Bytes(), 0o600))
+
+	_, err = DecryptFile(path, nil)
+	require.Error(t, err, "an identity is needed")
+
+	plain, err := DecryptFile(path, []age.Identity{id})
+	require.NoError(t, err)
+	defer os.Remove(plain)
+	data, err := os.ReadFile(plain)
+	require.NoError(t, err)
+	require.Equal(t, "etcd snapshot", string(data))
+	info, err := os.Stat(plain)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	other, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	_, err = DecryptFile(path, []age.Identity{other})
+	var noMatch *age.NoIdentityMatchError
+	require.ErrorAs(t, err, &noMatch)
+}
+
+func TestEncryptedArchiveName(t *testing.T) {
+	for name, encryption := range map[string]string{
+		"k0s_backup_1700000000.tar.gz":           "",
+		"k0s_backup_1700000000.tar.gz.age":       EncryptionAge,
+		"k0s_backup_1700000000_ctrl1.tar.gz.gpg": EncryptionGPG,
+	} {
+		_, ok := ParseArchiveName(name)
+		require.True(t, ok, name)
+		require.Equal(t, encryption, EncryptionOf(name), name)
+	}
+	_, ok := ParseArchiveName("k0s_backup_1700000000.tar.gz" + ManifestSuffix)
+	require.False(t, ok, "manifests are not archives")
+}
+
+func TestDecryptAgeFixture(t *testing.T) {
+	// example.age and its key come from the testdata of the age repository,
+	// the file was encrypted by the age command
+	ids, err := ReadAgeIdentities(filepath.Join("testdata", "age-keys.txt"))
+	require.NoError(t, err)
+
+	plain, err := DecryptFile(filepath.Join("testdata", "example.age"), ids)
+	require.NoError(t, err)
+	defer os.Remove(plain)
+	data, err := os.ReadFile(plain)
+	require.NoError(t, err)
+	require.Equal(t, "Black lives matter.", string(data))
+}
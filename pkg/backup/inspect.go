@@ -0,0 +1,310 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"github.com/k0sproject/version"
+)
+
+// Components of the k0s backup archives
+const (
+	ComponentEtcd      = "etcd snapshot"
+	ComponentKine      = "kine database"
+	ComponentPKI       = "pki"
+	ComponentManifests = "manifests"
+	ComponentHelm      = "helm charts"
+	ComponentConfig    = "k0s config"
+)
+
+// VersionFile is the file cfctl adds to the k0s backup archives to record the
+// version of k0s they were taken with
+const VersionFile = "k0s-version"
+
+// component returns the component of a file of a k0s backup archive
+func component(name string) string {
+	name = strings.TrimPrefix(name, "./")
+	switch {
+	case name == "etcd-snapshot.db":
+		return ComponentEtcd
+	case strings.HasPrefix(name, "kine-state-backup"):
+		return ComponentKine
+	case strings.HasPrefix(name, "pki/"):
+		return ComponentPKI
+	case strings.HasPrefix(name, "manifests/helm/"), strings.HasPrefix(name, "helmhome/"), strings.HasPrefix(name, "charts/"):
+		return ComponentHelm
+	case strings.HasPrefix(name, "manifests/"):
+		return ComponentManifests
+	case name == "k0s.yaml":
+		return ComponentConfig
+	default:
+		return ""
+	}
+}
+
+// Contents describes the files of a k0s backup archive
+type Contents struct {
+	Components []string `json:"components"`
+	Files      int      `json:"files"`
+	// Size is the uncompressed size of the files
+	Size int64 `json:"size"`
+	// ModTime is the modification time of the newest file
+	ModTime time.Time `json:"modTime"`
+	// K0sVersion is the version recorded in the VersionFile, empty when the
+	// archive has none
+	K0sVersion string `json:"k0sVersion,omitempty"`
+
+	seen map[string]bool
+}
+
+// HasDatastore returns true when the archive holds an etcd snapshot or a kine database
+func (c *Contents) HasDatastore() bool {
+	for _, component := range c.Components {
+		if component == ComponentEtcd || component == ComponentKine {
+			return true
+		}
+	}
+	return false
+}
+
+// add records a file of the archive, reading the version from the VersionFile
+func (c *Contents) add(hdr *tar.Header, r io.Reader) error {
+	if hdr.ModTime.After(c.ModTime) {
+		c.ModTime = hdr.ModTime
+	}
+	if hdr.Typeflag != tar.TypeReg {
+		return nil
+	}
+	name := strings.TrimPrefix(hdr.Name, "./")
+	if name == VersionFile {
+		data, err := io.ReadAll(io.LimitReader(r, 128))
+		if err != nil {
+			return fmt.Errorf("read %s: %w", VersionFile, err)
+		}
+		c.K0sVersion = strings.TrimSpace(string(data))
+		return nil
+	}
+	c.Files++
+	c.Size += hdr.Size
+	if c.seen == nil {
+		c.seen = make(map[string]bool)
+	}
+	if comp := component(name); comp != "" && !c.seen[comp] {
+		c.seen[comp] = true
+		c.Components = append(c.Components, comp)
+	}
+	return nil
+}
+
+// ScanArchive reads a plain k0s backup archive to its end and returns its contents
+func ScanArchive(r io.Reader) (*Contents, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a k0s backup archive: %w", err)
+	}
+	defer gz.Close()
+
+	contents := &Contents{}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read archive: %w", err)
+		}
+		if err := contents.add(hdr, tr); err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(contents.Components)
+
+	// read the padding and the gzip trailer
+	if _, err := io.Copy(io.Discard, gz); err != nil {
+		return nil, fmt.Errorf("read archive: %w", err)
+	}
+	return contents, nil
+}
+
+// AddVersion copies a plain k0s backup archive from r to w, adding the
+// VersionFile recording the version of k0s it was taken with, and returns
+// the contents of the archive
+func AddVersion(w io.Writer, r io.Reader, k0sVersion string) (*Contents, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a k0s backup archive: %w", err)
+	}
+	defer gz.Close()
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	contents := &Contents{}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read archive: %w", err)
+		}
+		if strings.TrimPrefix(hdr.Name, "./") == VersionFile {
+			continue
+		}
+		if err := contents.add(hdr, nil); err != nil {
+			return nil, err
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, fmt.Errorf("write archive: %w", err)
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return nil, fmt.Errorf("copy %s: %w", hdr.Name, err)
+		}
+	}
+	sort.Strings(contents.Components)
+	if _, err := io.Copy(io.Discard, gz); err != nil {
+		return nil, fmt.Errorf("read archive: %w", err)
+	}
+
+	data := []byte(k0sVersion + "\n")
+	hdr := &tar.Header{Name: VersionFile, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(data)), ModTime: contents.ModTime}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return nil, fmt.Errorf("write archive: %w", err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return nil, fmt.Errorf("write archive: %w", err)
+	}
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("write archive: %w", err)
+	}
+	if err := gw.Close(); err != nil {
+		return nil, fmt.Errorf("write archive: %w", err)
+	}
+	contents.K0sVersion = k0sVersion
+	return contents, nil
+}
+
+// Info is what is known about an archive from its manifest and its contents
+type Info struct {
+	Name string `json:"name"`
+	// Size is the size of the archive as stored
+	Size int64 `json:"size"`
+	// Manifest is nil when the archive has no manifest
+	Manifest *Manifest `json:"manifest,omitempty"`
+	// Contents is nil when the archive could not be read
+	Contents *Contents `json:"contents,omitempty"`
+	// Verified is true when the checksum recorded in the manifest matches
+	Verified bool `json:"verified"`
+}
+
+// Time returns the creation time of the archive from its manifest, its name
+// or its newest file
+func (i *Info) Time() time.Time {
+	if i.Manifest != nil && !i.Manifest.CreatedAt.IsZero() {
+		return i.Manifest.CreatedAt
+	}
+	if a, ok := ParseArchiveName(i.Name); ok {
+		return a.Time
+	}
+	if i.Contents != nil {
+		return i.Contents.ModTime
+	}
+	return time.Time{}
+}
+
+// K0sVersion returns the version of k0s the archive was taken with, read from
+// the archive itself or from its manifest, empty when unknown
+func (i *Info) K0sVersion() string {
+	if i.Contents != nil && i.Contents.K0sVersion != "" {
+		return i.Contents.K0sVersion
+	}
+	if i.Manifest == nil {
+		return ""
+	}
+	return i.Manifest.K0sVersion
+}
+
+// InspectFile reads a local archive, decrypting it when encrypted, verifies it
+// against the manifest stored next to it and returns what is known about it
+func InspectFile(path string, identities []age.Identity) (*Info, error) {
+	info := &Info{Name: filepath.Base(path)}
+
+	m, err := ReadManifest(path + ManifestSuffix)
+	switch {
+	case err == nil:
+		info.Manifest = m
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	digest := NewDigest()
+	raw := io.TeeReader(f, digest)
+	plain, err := Decrypt(info.Name, raw, identities)
+	if err != nil {
+		return nil, err
+	}
+	contents, scanErr := ScanArchive(plain)
+	if scanErr == nil {
+		_, scanErr = io.Copy(io.Discard, plain)
+	}
+	if err := plain.Close(); scanErr == nil {
+		scanErr = err
+	}
+	if scanErr != nil {
+		return nil, fmt.Errorf("%s: %w", path, scanErr)
+	}
+	// hash what the decryption left unread
+	if _, err := io.Copy(io.Discard, raw); err != nil {
+		return nil, err
+	}
+
+	info.Contents = contents
+	info.Size = digest.Size()
+	if info.Manifest != nil {
+		if digest.Size() != info.Manifest.Size || digest.SHA256() != info.Manifest.SHA256 {
+			return info, fmt.Errorf("checksum mismatch for %s: the archive does not match its manifest", path)
+		}
+		info.Verified = true
+		if m := info.Manifest.K0sVersion; m != "" && contents.K0sVersion != "" && m != contents.K0sVersion {
+			return info, fmt.Errorf("%s was taken with k0s %s but its manifest records k0s %s", path, contents.K0sVersion, m)
+		}
+	}
+	return info, nil
+}
+
+// CheckVersion returns an error unless an archive taken with the k0s version
+// archived can be restored with the k0s version target: the versions must
+// share their major and minor versions and the archive can not be newer.
+func CheckVersion(archived string, target *version.Version) error {
+	if archived == "" || target == nil {
+		return nil
+	}
+	a, err := version.NewVersion(archived)
+	if err != nil {
+		return fmt.Errorf("invalid k0s version %q in the backup manifest: %w", archived, err)
+	}
+	as, ts := a.Segments(), target.Segments()
+	if as[0] != ts[0] || as[1] != ts[1] {
+		return fmt.Errorf("the backup was taken with k0s %s, it can only be restored with k0s v%d.%d", a, as[0], as[1])
+	}
+	if a.GreaterThan(target) {
+		return fmt.Errorf("the backup was taken with k0s %s, newer than k0s %s", a, target)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	"github.com/k0sproject/version"
+	"github.com/stretchr/testify/require"
+)
+
+// k0sArchive returns a k0s backup archive holding the given files
+func k0sArchive(t *testing.T, files ...string) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "pki/", Typeflag: tar.TypeDir, Mode: 0o755, ModTime: time.Unix(1700000000, 0)}))
+	for _, name := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o600, Size: 4, ModTime: time.Unix(1700000100, 0)}))
+		_, err := tw.Write([]byte("data"))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func TestScanArchive(t *testing.T) {
+	data := k0sArchive(t, "etcd-snapshot.db", "pki/ca.crt", "pki/etcd/ca.key", "manifests/calico/calico.yaml", "manifests/helm/0_helm_extension_prometheus.yaml", "k0s.yaml")
+	contents, err := ScanArchive(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, []string{ComponentEtcd, ComponentHelm, ComponentConfig, ComponentManifests, ComponentPKI}, contents.Components)
+	require.Equal(t, 6, contents.Files)
+	require.Equal(t, int64(24), contents.Size)
+	require.True(t, contents.HasDatastore())
+	require.True(t, contents.ModTime.Equal(time.Unix(1700000100, 0)))
+
+	contents, err = ScanArchive(bytes.NewReader(k0sArchive(t, "pki/ca.crt")))
+	require.NoError(t, err)
+	require.False(t, contents.HasDatastore())
+
+	_, err = ScanArchive(bytes.NewReader([]byte("not an archive")))
+	require.ErrorContains(t, err, "not a k0s backup archive")
+}
+
+func TestAddVersion(t *testing.T) {
+	stamped := &bytes.Buffer{}
+	contents, err := AddVersion(stamped, bytes.NewReader(k0sArchive(t, "etcd-snapshot.db", "pki/ca.crt", VersionFile)), "v1.28.4+k0s.0")
+	require.NoError(t, err)
+	require.Equal(t, []string{ComponentEtcd, ComponentPKI}, contents.Components)
+	require.Equal(t, 2, contents.Files, "an older version file is replaced")
+
+	scanned, err := ScanArchive(bytes.NewReader(stamped.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, "v1.28.4+k0s.0", scanned.K0sVersion)
+	require.Equal(t, contents.Components, scanned.Components)
+	require.Equal(t, 2, scanned.Files)
+
+	_, err = AddVersion(io.Discard, bytes.NewReader([]byte("not an archive")), "v1.28.4+k0s.0")
+	require.ErrorContains(t, err, "not a k0s backup archive")
+}
+
+func TestInspectFile(t *testing.T) {
+	dir := t.TempDir()
+	id, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	enc, err := NewEncrypter([]string{id.Recipient().String()})
+	require.NoError(t, err)
+
+	encrypted := &bytes.Buffer{}
+	w, err := enc.Encrypt(encrypted)
+	require.NoError(t, err)
+	_, err = w.Write(k0sArchive(t, "kine-state-backup.db", "pki/ca.crt"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	name := "k0s_backup_1700000000.tar.gz.age"
+	m := writeArchive(t, dir, name, encrypted.String())
+	path := filepath.Join(dir, name)
+
+	info, err := InspectFile(path, []age.Identity{id})
+	require.NoError(t, err)
+	require.True(t, info.Verified)
+	require.Equal(t, m.Size, info.Size)
+	require.Equal(t, "v1.28.4+k0s.0", info.K0sVersion())
+	require.Equal(t, []string{ComponentKine, ComponentPKI}, info.Components())
+	require.Equal(t, time.Unix(1700000000, 0), info.Time())
+
+	_, err = InspectFile(path, nil)
+	require.ErrorContains(t, err, "identity file is needed")
+
+	// a corrupted archive is reported with what could be read
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ManifestName(name)), []byte(`{"archive":"`+name+`","sha256":"00","size":1}`), 0o600))
+	info, err = InspectFile(path, []age.Identity{id})
+	require.ErrorContains(t, err, "checksum mismatch")
+	require.NotNil(t, info)
+	require.False(t, info.Verified)
+
+	// the version recorded in the archive must match its manifest
+	stamped := &bytes.Buffer{}
+	_, err = AddVersion(stamped, bytes.NewReader(k0sArchive(t, "kine-state-backup.db")), "v1.27.8+k0s.0")
+	require.NoError(t, err)
+	name = "k0s_backup_1700000100.tar.gz"
+	writeArchive(t, dir, name, stamped.String())
+	info, err = InspectFile(filepath.Join(dir, name), nil)
+	require.ErrorContains(t, err, "taken with k0s v1.27.8+k0s.0 but its manifest records k0s v1.28.4+k0s.0")
+	require.Equal(t, "v1.27.8+k0s.0", info.K0sVersion())
+}
+
+func TestListInfo(t *testing.T) {
+	dir := t.TempDir()
+	m := writeArchive(t, dir, "k0s_backup_1700000000.tar.gz", "snapshot")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "k0s_backup_1700000100.tar.gz"), []byte("x"), 0o600))
+
+	infos, err := ListInfo(context.Background(), &Local{Dir: dir})
+	require.NoError(t, err)
+	require.Len(t, infos, 2)
+	require.Equal(t, "k0s_backup_1700000100.tar.gz", infos[0].Name)
+	require.Nil(t, infos[0].Manifest)
+	require.Equal(t, m.SHA256, infos[1].Manifest.SHA256)
+	require.Equal(t, m.Size, infos[1].Size)
+
+	out := &bytes.Buffer{}
+	require.NoError(t, WriteTable(out, infos))
+	require.Contains(t, out.String(), "v1.28.4+k0s.0")
+	require.Contains(t, out.String(), "ctrl1")
+}
+
+func TestCheckVersion(t *testing.T) {
+	target := version.MustParse("v1.28.4+k0s.0")
+	require.NoError(t, CheckVersion("v1.28.4+k0s.0", target))
+	require.NoError(t, CheckVersion("v1.28.2+k0s.1", target))
+	require.NoError(t, CheckVersion("", target))
+	require.ErrorContains(t, CheckVersion("v1.28.5+k0s.0", target), "newer than")
+	require.ErrorContains(t, CheckVersion("v1.27.8+k0s.0", target), "can only be restored with k0s v1.27")
+	require.ErrorContains(t, CheckVersion("v1.29.0+k0s.0", target), "can only be restored with k0s v1.29")
+	require.ErrorContains(t, CheckVersion("banana", target), "invalid k0s version")
+}
@@ -0,0 +1,83 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Local stores the archives in a local directory
+type Local struct {
+	Dir string
+}
+
+// NewLocal returns a destination for a local directory
+func NewLocal(dir string) *Local {
+	return &Local{Dir: dir}
+}
+
+// String returns the path of the directory
+func (l *Local) String() string {
+	if abs, err := filepath.Abs(l.Dir); err == nil {
+		return abs
+	}
+	return l.Dir
+}
+
+// Put writes the archive to a temporary file renamed once complete so that
+// an interrupted backup never leaves a truncated archive
+func (l *Local) Put(_ context.Context, name string, r io.Reader) error {
+	if err := os.MkdirAll(l.Dir, 0o700); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(l.Dir, "."+name+".*.part")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+
+	if _, err := io.Copy(f, r); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), filepath.Join(l.Dir, name))
+}
+
+// Get opens a file of the directory
+func (l *Local) Get(_ context.Context, name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(l.Dir, name))
+}
+
+// List returns the names of the files of the directory
+func (l *Local) List(_ context.Context) ([]string, error) {
+	entries, err := os.ReadDir(l.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if e.Type().IsRegular() {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
+
+// Delete removes an archive
+func (l *Local) Delete(_ context.Context, name string) error {
+	return os.Remove(filepath.Join(l.Dir, name))
+}
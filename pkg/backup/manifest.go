@@ -0,0 +1,133 @@
+package backup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"time"
+)
+
+// ManifestSuffix is appended to the name of an archive to get the name of its manifest
+const ManifestSuffix = ".manifest.json"
+
+// Manifest describes an archive and is stored next to it
+type Manifest struct {
+	// Archive is the name of the archive
+	Archive   string    `json:"archive"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Size and SHA256 are the size and the hex encoded sha256 of the archive
+	// as stored, encrypted or not
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	// Encryption is EncryptionAge, EncryptionGPG or empty
+	Encryption string   `json:"encryption,omitempty"`
+	Recipients []string `json:"recipients,omitempty"`
+	K0sVersion string   `json:"k0sVersion"`
+	ClusterID  string   `json:"clusterID,omitempty"`
+	// Controller is the hostname of the controller the backup was taken on
+	Controller string `json:"controller"`
+	// Components are the components found in the archive
+	Components []string `json:"components,omitempty"`
+}
+
+// ManifestName returns the name of the manifest of an archive
+func ManifestName(archive string) string {
+	return archive + ManifestSuffix
+}
+
+// ReadManifest reads a manifest file
+func ReadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseManifest(data)
+}
+
+// ParseManifest parses the content of a manifest
+func ParseManifest(data []byte) (*Manifest, error) {
+	m := &Manifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("invalid backup manifest: %w", err)
+	}
+	if m.Archive == "" || m.SHA256 == "" {
+		return nil, fmt.Errorf("invalid backup manifest: missing archive name or checksum")
+	}
+	return m, nil
+}
+
+// Marshal returns the JSON encoding of the manifest
+func (m *Manifest) Marshal() ([]byte, error) {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// Verify reads r to its end and returns an error unless its size and
+// checksum match the manifest
+func (m *Manifest) Verify(r io.Reader) error {
+	d := NewDigest()
+	if _, err := io.Copy(d, r); err != nil {
+		return err
+	}
+	if d.Size() != m.Size || d.SHA256() != m.SHA256 {
+		return fmt.Errorf("checksum mismatch for %s: got %d bytes with sha256 %s, the manifest records %d bytes with sha256 %s", m.Archive, d.Size(), d.SHA256(), m.Size, m.SHA256)
+	}
+	return nil
+}
+
+// Digest computes the size and the sha256 of what is written to it
+type Digest struct {
+	hash hash.Hash
+	size int64
+}
+
+// NewDigest returns an empty digest
+func NewDigest() *Digest {
+	return &Digest{hash: sha256.New()}
+}
+
+// Write adds p to the digest
+func (d *Digest) Write(p []byte) (int, error) {
+	d.size += int64(len(p))
+	return d.hash.Write(p)
+}
+
+// Size returns the number of bytes written
+func (d *Digest) Size() int64 {
+	return d.size
+}
+
+// SHA256 returns the hex encoded sha256 of the bytes written
+func (d *Digest) SHA256() string {
+	return hex.EncodeToString(d.hash.Sum(nil))
+}
+
+// VerifyFile checks a local archive against the manifest stored next to it
+// and returns the manifest, or nil when there is none
+func VerifyFile(path string) (*Manifest, error) {
+	m, err := ReadManifest(path + ManifestSuffix)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := m.Verify(f); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,67 @@
+package backup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeArchive(t *testing.T, dir, name, content string) *Manifest {
+	t.Helper()
+	d := NewDigest()
+	_, _ = d.Write([]byte(content))
+	m := &Manifest{Archive: name, Size: d.Size(), SHA256: d.SHA256(), K0sVersion: "v1.28.4+k0s.0", Controller: "ctrl1"}
+	data, err := m.Marshal()
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ManifestName(name)), data, 0o600))
+	return m
+}
+
+func TestVerifyFile(t *testing.T) {
+	dir := t.TempDir()
+	writeArchive(t, dir, "k0s_backup_1.tar.gz", "snapshot")
+	path := filepath.Join(dir, "k0s_backup_1.tar.gz")
+
+	m, err := VerifyFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "ctrl1", m.Controller)
+
+	require.NoError(t, os.WriteFile(path, []byte("snapshoT"), 0o600))
+	_, err = VerifyFile(path)
+	require.ErrorContains(t, err, "checksum mismatch")
+
+	// archives without a manifest can not be verified
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "k0s_backup_2.tar.gz"), []byte("x"), 0o600))
+	m, err = VerifyFile(filepath.Join(dir, "k0s_backup_2.tar.gz"))
+	require.NoError(t, err)
+	require.Nil(t, m)
+
+	_, err = ParseManifest([]byte(`{"archive": "k0s_backup_1.tar.gz"}`))
+	require.Error(t, err)
+}
+
+func TestPruneManifests(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Unix(1700000000, 0)
+	for i := 0; i < 3; i++ {
+		writeArchive(t, dir, ArchiveName(now.Add(-time.Duration(i)*time.Hour)), "snapshot")
+	}
+
+	pruned, err := Retention{Keep: 1}.Prune(context.Background(), NewLocal(dir), now)
+	require.NoError(t, err)
+	require.Len(t, pruned, 2)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	require.ElementsMatch(t, []string{ArchiveName(now), ManifestName(ArchiveName(now))}, names, strings.Join(names, ", "))
+}
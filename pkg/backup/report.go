@@ -0,0 +1,156 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// ListInfo returns the archives of a destination with their manifests, newest
+// first. The archives are not read, their contents come from the manifests.
+func ListInfo(ctx context.Context, d Destination) ([]*Info, error) {
+	archives, err := ListArchives(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]*Info, 0, len(archives))
+	for _, a := range archives {
+		info := &Info{Name: a.Name}
+		m, err := getManifest(ctx, d, a.Name)
+		if err != nil {
+			return nil, err
+		}
+		if m != nil {
+			info.Manifest = m
+			info.Size = m.Size
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// getManifest reads the manifest of an archive from a destination, nil when there is none
+func getManifest(ctx context.Context, d Destination, archive string) (*Manifest, error) {
+	rc, err := d.Get(ctx, ManifestName(archive))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read the manifest of %s: %w", archive, err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("read the manifest of %s: %w", archive, err)
+	}
+	m, err := ParseManifest(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", ManifestName(archive), err)
+	}
+	return m, nil
+}
+
+// Components returns the components of the archive from its contents or its manifest
+func (i *Info) Components() []string {
+	if i.Contents != nil {
+		return i.Contents.Components
+	}
+	if i.Manifest != nil {
+		return i.Manifest.Components
+	}
+	return nil
+}
+
+// WriteJSON writes the infos as an indented JSON array
+func WriteJSON(w io.Writer, infos []*Info) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(infos)
+}
+
+// WriteTable writes the infos as a table
+func WriteTable(w io.Writer, infos []*Info) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tCREATED\tSIZE\tK0S\tCLUSTER ID\tCONTROLLER\tENCRYPTION\tCOMPONENTS")
+	for _, i := range infos {
+		size, k0s, clusterID, controller := "-", "-", "-", "-"
+		if i.Size > 0 {
+			size = FormatSize(i.Size)
+		}
+		if m := i.Manifest; m != nil {
+			k0s = orDash(m.K0sVersion)
+			clusterID = orDash(m.ClusterID)
+			controller = orDash(m.Controller)
+		}
+		created := "-"
+		if t := i.Time(); !t.IsZero() {
+			created = t.Local().Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			i.Name, created, size, k0s, clusterID, controller,
+			orDash(EncryptionOf(i.Name)), orDash(strings.Join(i.Components(), ", ")),
+		)
+	}
+	return tw.Flush()
+}
+
+// WriteDetails writes what is known about a single archive
+func WriteDetails(w io.Writer, i *Info) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	row := func(key, value string) {
+		fmt.Fprintf(tw, "%s:\t%s\n", key, orDash(value))
+	}
+	row("Name", i.Name)
+	if t := i.Time(); !t.IsZero() {
+		row("Created", t.Local().Format(time.RFC3339))
+	}
+	row("Size", FormatSize(i.Size))
+	if m := i.Manifest; m != nil {
+		row("K0s version", m.K0sVersion)
+		row("Cluster ID", m.ClusterID)
+		row("Controller", m.Controller)
+		row("SHA256", m.SHA256)
+	}
+	row("Encryption", EncryptionOf(i.Name))
+	switch {
+	case i.Manifest == nil:
+		row("Checksum", "no manifest")
+	case i.Verified:
+		row("Checksum", "verified")
+	default:
+		row("Checksum", "mismatch")
+	}
+	if c := i.Contents; c != nil {
+		row("Components", strings.Join(c.Components, ", "))
+		row("Files", fmt.Sprintf("%d (%s uncompressed)", c.Files, FormatSize(c.Size)))
+	}
+	return tw.Flush()
+}
+
+// FormatSize formats a size in bytes with a binary unit
+func FormatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,120 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Retention is a policy selecting the archives to keep. An archive is kept
+// when it is one of the Keep newest archives or when it is younger than
+// KeepWithin. A zero Retention keeps everything.
+type Retention struct {
+	Keep       int
+	KeepWithin time.Duration
+}
+
+// IsZero returns true when the policy keeps every archive
+func (r Retention) IsZero() bool {
+	return r.Keep <= 0 && r.KeepWithin <= 0
+}
+
+// String returns a human readable policy
+func (r Retention) String() string {
+	var rules []string
+	if r.Keep > 0 {
+		rules = append(rules, fmt.Sprintf("the %d newest archives", r.Keep))
+	}
+	if r.KeepWithin > 0 {
+		rules = append(rules, fmt.Sprintf("the archives younger than %s", r.KeepWithin))
+	}
+	if len(rules) == 0 {
+		return "keep everything"
+	}
+	return "keep " + strings.Join(rules, " and ")
+}
+
+// Expired returns the archives the policy does not keep at now
+func (r Retention) Expired(now time.Time, archives []Archive) []Archive {
+	if r.IsZero() {
+		return nil
+	}
+
+	sorted := make([]Archive, len(archives))
+	copy(sorted, archives)
+	sortArchives(sorted)
+
+	var expired []Archive
+	for i, a := range sorted {
+		if r.Keep > 0 && i < r.Keep {
+			continue
+		}
+		if r.KeepWithin > 0 && now.Sub(a.Time) < r.KeepWithin {
+			continue
+		}
+		expired = append(expired, a)
+	}
+	return expired
+}
+
+// Prune deletes the archives of the destination the policy does not keep and
+// returns them
+func (r Retention) Prune(ctx context.Context, d Destination, now time.Time) ([]Archive, error) {
+	if r.IsZero() {
+		return nil, nil
+	}
+	archives, err := ListArchives(ctx, d)
+	if err != nil {
+		return nil, fmt.Errorf("list archives: %w", err)
+	}
+	var pruned []Archive
+	for _, a := range r.Expired(now, archives) {
+		log.Debugf("pruning backup archive %s from %s", a.Name, d)
+		if err := d.Delete(ctx, a.Name); err != nil {
+			return pruned, fmt.Errorf("delete %s: %w", a.Name, err)
+		}
+		if err := d.Delete(ctx, ManifestName(a.Name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Warnf("failed to delete the manifest of %s: %s", a.Name, err)
+		}
+		pruned = append(pruned, a)
+	}
+	return pruned, nil
+}
+
+// ParseDuration parses a duration that may start with "d" (day) and "w" (week)
+// units followed by the units of time.ParseDuration, such as "30d" or "1w12h"
+func ParseDuration(s string) (time.Duration, error) {
+	var total time.Duration
+	rest := s
+	for rest != "" {
+		i := strings.IndexAny(rest, "dw")
+		if i < 0 {
+			d, err := time.ParseDuration(rest)
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %q", s)
+			}
+			return total + d, nil
+		}
+		// a "d" or "w" unit must follow a plain number
+		n, err := strconv.ParseFloat(rest[:i], 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		unit := 24 * time.Hour
+		if rest[i] == 'w' {
+			unit *= 7
+		}
+		total += time.Duration(n * float64(unit))
+		rest = rest[i+1:]
+	}
+	if s == "" {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return total, nil
+}
@@ -0,0 +1,89 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDuration(t *testing.T) {
+	for in, expected := range map[string]time.Duration{
+		"30d":   30 * 24 * time.Hour,
+		"2w":    14 * 24 * time.Hour,
+		"1w12h": 7*24*time.Hour + 12*time.Hour,
+		"1d30m": 24*time.Hour + 30*time.Minute,
+		"36h":   36 * time.Hour,
+	} {
+		d, err := ParseDuration(in)
+		require.NoError(t, err, in)
+		require.Equal(t, expected, d, in)
+	}
+
+	for _, in := range []string{"", "d", "30x", "-1d", "12h3d"} {
+		_, err := ParseDuration(in)
+		require.Error(t, err, in)
+	}
+}
+
+func TestParseArchiveName(t *testing.T) {
+	a, ok := ParseArchiveName("k0s_backup_1700000000.tar.gz")
+	require.True(t, ok)
+	require.Equal(t, int64(1700000000), a.Time.Unix())
+	require.Equal(t, "k0s_backup_1700000000.tar.gz", ArchiveName(a.Time))
+
+	_, ok = ParseArchiveName("k0s_backup_1700000000_controller-0.tar.gz")
+	require.True(t, ok)
+
+	for _, name := range []string{"k0s_backup_.tar.gz", "notes.txt", ".k0s_backup_1.tar.gz.123.part"} {
+		_, ok := ParseArchiveName(name)
+		require.False(t, ok, name)
+	}
+}
+
+func TestRetentionExpired(t *testing.T) {
+	now := time.Unix(100*86400, 0)
+	var archives []Archive
+	for day := 90; day < 100; day++ {
+		archives = append(archives, Archive{Name: ArchiveName(time.Unix(int64(day*86400), 0)), Time: time.Unix(int64(day*86400), 0)})
+	}
+
+	require.Empty(t, Retention{}.Expired(now, archives))
+	require.Len(t, Retention{Keep: 3}.Expired(now, archives), 7)
+	require.Len(t, Retention{KeepWithin: 5 * 24 * time.Hour}.Expired(now, archives), 6)
+	// an archive kept by any rule is kept
+	require.Len(t, Retention{Keep: 7, KeepWithin: 5 * 24 * time.Hour}.Expired(now, archives), 3)
+
+	expired := Retention{Keep: 9}.Expired(now, archives)
+	require.Len(t, expired, 1)
+	require.Equal(t, archives[0], expired[0], "the oldest archive is expired first")
+}
+
+func TestLocalDestination(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "backups")
+	d, err := ParseDestination(dir)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	for i := int64(1); i <= 3; i++ {
+		require.NoError(t, d.Put(ctx, ArchiveName(time.Unix(i, 0)), bytes.NewReader([]byte("archive"))))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README"), nil, 0o600))
+
+	archives, err := ListArchives(ctx, d)
+	require.NoError(t, err)
+	require.Len(t, archives, 3)
+	require.Equal(t, "k0s_backup_3.tar.gz", archives[0].Name)
+
+	pruned, err := Retention{Keep: 2}.Prune(ctx, d, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, []Archive{{Name: "k0s_backup_1.tar.gz", Time: time.Unix(1, 0)}}, pruned)
+
+	names, err := d.List(ctx)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"k0s_backup_2.tar.gz", "k0s_backup_3.tar.gz", "README"}, names)
+}
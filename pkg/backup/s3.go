@@ -0,0 +1,420 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultPartSize is the size of the parts of the multipart uploads, archives
+// smaller than a part are uploaded with a single request
+const DefaultPartSize = 16 << 20
+
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// S3 stores the archives in a bucket of an S3 compatible object store. The
+// requests are signed with AWS Signature Version 4 and use path-style
+// addressing, which is supported by AWS and the self-hosted stores such as
+// MinIO.
+type S3 struct {
+	// Endpoint is the base URL of the object store
+	Endpoint *url.URL
+	Region   string
+	Bucket   string
+	// Prefix is prepended to the object names
+	Prefix       string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	// PartSize is the size of the parts of multipart uploads, defaults to DefaultPartSize
+	PartSize int
+	Client   *http.Client
+
+	now func() time.Time
+}
+
+// NewS3 returns a destination for a "s3://bucket/prefix" URL. The endpoint
+// and region can be given with the "endpoint" and "region" query parameters
+// or the AWS_ENDPOINT_URL and AWS_REGION environment variables. The
+// credentials are read from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN.
+func NewS3(u *url.URL) (*S3, error) {
+	if u.Host == "" {
+		return nil, errors.New("s3 destination: no bucket given, use s3://bucket/prefix")
+	}
+
+	q := u.Query()
+	region := firstNonEmpty(q.Get("region"), os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"), "us-east-1")
+	endpoint := firstNonEmpty(
+		q.Get("endpoint"),
+		os.Getenv("AWS_ENDPOINT_URL_S3"),
+		os.Getenv("AWS_ENDPOINT_URL"),
+		fmt.Sprintf("https://s3.%s.amazonaws.com", region),
+	)
+	e, err := url.Parse(endpoint)
+	if err != nil || e.Host == "" {
+		return nil, fmt.Errorf("s3 destination: invalid endpoint %q", endpoint)
+	}
+
+	s := &S3{
+		Endpoint:     e,
+		Region:       region,
+		Bucket:       u.Host,
+		Prefix:       strings.Trim(u.Path, "/"),
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if s.AccessKey == "" || s.SecretKey == "" {
+		return nil, errors.New("s3 destination: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+	}
+	return s, nil
+}
+
+// String returns the s3 URL of the destination
+func (s *S3) String() string {
+	return fmt.Sprintf("s3://%s/%s", s.Bucket, s.Prefix)
+}
+
+func (s *S3) key(name string) string {
+	if s.Prefix == "" {
+		return name
+	}
+	return s.Prefix + "/" + name
+}
+
+// Put uploads an archive, with a multipart upload when it is larger than a
+// part so that it is streamed without being buffered in full
+func (s *S3) Put(ctx context.Context, name string, r io.Reader) error {
+	partSize := s.PartSize
+	if partSize <= 0 {
+		partSize = DefaultPartSize
+	}
+	key := s.key(name)
+
+	part := make([]byte, partSize)
+	n, err := io.ReadFull(r, part)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		_, err := s.do(ctx, http.MethodPut, key, nil, part[:n])
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	res, err := s.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil)
+	if err != nil {
+		return err
+	}
+	upload := struct {
+		UploadID string `xml:"UploadId"`
+	}{}
+	if err := xml.Unmarshal(res, &upload); err != nil {
+		return fmt.Errorf("s3: decode multipart upload: %w", err)
+	}
+
+	if err := s.uploadParts(ctx, key, upload.UploadID, r, part, n); err != nil {
+		if _, abortErr := s.do(ctx, http.MethodDelete, key, url.Values{"uploadId": {upload.UploadID}}, nil); abortErr != nil {
+			return errors.Join(err, fmt.Errorf("s3: abort multipart upload: %w", abortErr))
+		}
+		return err
+	}
+	return nil
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// uploadParts uploads the first part already read and the rest of r and completes the upload
+func (s *S3) uploadParts(ctx context.Context, key, uploadID string, r io.Reader, part []byte, n int) error {
+	var parts []completedPart
+	for number := 1; n > 0; number++ {
+		etag, err := s.uploadPart(ctx, key, uploadID, number, part[:n])
+		if err != nil {
+			return err
+		}
+		parts = append(parts, completedPart{PartNumber: number, ETag: etag})
+
+		var readErr error
+		n, readErr = io.ReadFull(r, part)
+		if readErr != nil && !errors.Is(readErr, io.EOF) && !errors.Is(readErr, io.ErrUnexpectedEOF) {
+			return readErr
+		}
+	}
+
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+	_, err = s.do(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, body)
+	return err
+}
+
+func (s *S3) uploadPart(ctx context.Context, key, uploadID string, number int, data []byte) (string, error) {
+	query := url.Values{"partNumber": {fmt.Sprint(number)}, "uploadId": {uploadID}}
+	req, err := s.request(ctx, http.MethodPut, key, query, data)
+	if err != nil {
+		return "", err
+	}
+	resp, err := s.send(req)
+	if err != nil {
+		return "", err
+	}
+	_ = resp.Body.Close()
+	return resp.Header.Get("ETag"), nil
+}
+
+// Get downloads an object
+func (s *S3) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	req, err := s.request(ctx, http.MethodGet, s.key(name), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.send(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// List returns the names of the objects directly under the prefix
+func (s *S3) List(ctx context.Context) ([]string, error) {
+	prefix := s.key("")
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}, "delimiter": {"/"}}
+
+	var names []string
+	for {
+		res, err := s.do(ctx, http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		list := struct {
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}{}
+		if err := xml.Unmarshal(res, &list); err != nil {
+			return nil, fmt.Errorf("s3: decode object list: %w", err)
+		}
+		for _, c := range list.Contents {
+			names = append(names, strings.TrimPrefix(c.Key, prefix))
+		}
+		if !list.IsTruncated || list.NextContinuationToken == "" {
+			return names, nil
+		}
+		query.Set("continuation-token", list.NextContinuationToken)
+	}
+}
+
+// Delete removes an archive
+func (s *S3) Delete(ctx context.Context, name string) error {
+	_, err := s.do(ctx, http.MethodDelete, s.key(name), nil, nil)
+	return err
+}
+
+// do sends a signed request and returns the response body
+func (s *S3) do(ctx context.Context, method, key string, query url.Values, body []byte) ([]byte, error) {
+	req, err := s.request(ctx, method, key, query, body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.send(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+func (s *S3) send(req *http.Request) (*http.Response, error) {
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &S3Error{Method: req.Method, Path: req.URL.Path, StatusCode: resp.StatusCode, Body: string(msg)}
+	}
+	return resp, nil
+}
+
+// request builds a signed path-style request for a key of the bucket
+func (s *S3) request(ctx context.Context, method, key string, query url.Values, body []byte) (*http.Request, error) {
+	u := *s.Endpoint
+	u.Path = strings.TrimSuffix(s.Endpoint.Path, "/") + "/" + s.Bucket
+	u.RawPath = strings.TrimSuffix(s.Endpoint.EscapedPath(), "/") + "/" + uriEncode(s.Bucket, false)
+	if key != "" {
+		u.Path += "/" + key
+		u.RawPath += "/" + uriEncode(key, false)
+	}
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	s.sign(req, body)
+	return req, nil
+}
+
+// sign adds the AWS Signature Version 4 headers to the request
+func (s *S3) sign(req *http.Request, body []byte) {
+	now := time.Now
+	if s.now != nil {
+		now = s.now
+	}
+	t := now().UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+
+	payloadHash := emptyPayloadHash
+	if len(body) > 0 {
+		sum := sha256.Sum256(body)
+		payloadHash = hex.EncodeToString(sum[:])
+	}
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-amz-") || name == "range" || name == "content-type" || name == "content-md5" {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.Region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), date)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s,SignedHeaders=%s,Signature=%s",
+		s.AccessKey, scope, signedHeaders, signature,
+	))
+}
+
+// S3Error is returned when the object store answers with an error status
+type S3Error struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Body       string
+}
+
+// Is matches os.ErrNotExist for missing objects
+func (e *S3Error) Is(target error) bool {
+	return target == os.ErrNotExist && e.StatusCode == http.StatusNotFound
+}
+
+func (e *S3Error) Error() string {
+	return fmt.Sprintf("s3: %s %s: %s: %s", e.Method, e.Path, http.StatusText(e.StatusCode), strings.TrimSpace(e.Body))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery encodes the query sorted by key as required by the signature
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		values := append([]string{}, query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode percent-encodes everything but the unreserved characters, and
+// the slashes unless encodeSlash is set
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,406 @@
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/alessio/shellescape"
+)
+
+const (
+	// ScheduleLeaseName is the lease in ScheduleLeaseNamespace taken by the
+	// controller running a scheduled backup
+	ScheduleLeaseName      = "cfctl-backup"
+	ScheduleLeaseNamespace = "kube-system"
+	// ScheduleLeaseDuration is how long after a controller took the lease the
+	// runs of the other controllers are skipped
+	ScheduleLeaseDuration = 10 * time.Minute
+	// scheduleStartedAnnotation records the start of the run holding the lease
+	// in seconds since the epoch
+	scheduleStartedAnnotation = "cfctl.clusterfactory.io/backup-started"
+)
+
+// Script is the shell script installed on a controller to take the scheduled
+// backups and ship them to a destination like "cfctl backup" does: with a
+// manifest, encrypted when there is an encrypter and pruned with the
+// retention policy
+type Script struct {
+	// BackupCommand takes a backup into the directory held by the BACKUP_DIR
+	// shell variable
+	BackupCommand string
+	// VersionCommand prints the version of k0s, recorded in the manifests
+	VersionCommand string
+	// KubectlCommand runs kubectl with the arguments "$@". When set, the
+	// script is installed on several controllers and a run only takes a
+	// backup on the controller getting the lease, every run takes one when
+	// empty.
+	KubectlCommand string
+	// Destination receives the archives
+	Destination Destination
+	// Retention prunes the old archives of the destination
+	Retention Retention
+	// Encrypter encrypts the archives when set, with the age or gpg command
+	// of the host
+	Encrypter Encrypter
+	// GPGKeyFiles are the paths of the public keys of the gpg recipients on the host
+	GPGKeyFiles []string
+	// ClusterID and Controller are recorded in the manifests
+	ClusterID  string
+	Controller string
+	// EnvFile is sourced by the script and holds the credentials of the destination
+	EnvFile string
+	// StatusFile records the result of the last run
+	StatusFile string
+	// IdentityFile is the path of the private key used for sftp destinations
+	IdentityFile string
+	// KnownHostsFile is the path of the known_hosts file pinning the key of
+	// the sftp server
+	KnownHostsFile string
+}
+
+// Render returns the script and the content of its environment file
+func (s Script) Render() (string, string, error) {
+	functions, env, err := s.destinationFunctions()
+	if err != nil {
+		return "", "", err
+	}
+	encrypt, err := s.encrypt()
+	if err != nil {
+		return "", "", err
+	}
+	manifest, err := s.manifestFields()
+	if err != nil {
+		return "", "", err
+	}
+
+	b := &strings.Builder{}
+	b.WriteString("#!/bin/sh\n")
+	b.WriteString("# k0s backup, installed by cfctl backup schedule\n")
+	b.WriteString("set -eu\n")
+	b.WriteString("umask 077\n\n")
+	fmt.Fprintf(b, "ENV_FILE=%s\n", shellescape.Quote(s.EnvFile))
+	fmt.Fprintf(b, "STATUS_FILE=%s\n", shellescape.Quote(s.StatusFile))
+	fmt.Fprintf(b, "KEEP=%d\n", s.Retention.Keep)
+	fmt.Fprintf(b, "KEEP_WITHIN=%d\n", int64(s.Retention.KeepWithin/time.Second))
+	b.WriteString(`if [ -f "$ENV_FILE" ]; then
+	. "$ENV_FILE"
+fi
+
+BACKUP_DIR=$(mktemp -d)
+NOW=$(date -u '+%s %Y-%m-%dT%H:%M:%SZ')
+CREATED=${NOW% *}
+CREATED_AT=${NOW#* }
+NAME="k0s_backup_${CREATED}_$(hostname -s).tar.gz"
+RESULT=failed
+
+finish() {
+	rm -rf "$BACKUP_DIR"
+	mkdir -p "$(dirname "$STATUS_FILE")"
+	printf 'time=%s\nresult=%s\narchive=%s\n' "$(date -u +%Y-%m-%dT%H:%M:%SZ)" "$RESULT" "$NAME" > "$STATUS_FILE"
+}
+trap finish EXIT
+
+`)
+	b.WriteString(functions)
+	if s.KubectlCommand != "" {
+		b.WriteString(s.lease())
+	}
+	b.WriteString(`
+# expired reads the names of the files of the destination and prints the
+# archives the retention policy does not keep, like cfctl backup --keep and
+# --keep-within
+expired() {
+	grep -E '^k0s_backup_[0-9]+(_[^.]+)?\.tar\.gz(\.age|\.gpg)?$' |
+		sed -E 's/^k0s_backup_([0-9]+)/\1 &/' |
+		sort -s -r -n -k 1,1 |
+		awk -v keep="$KEEP" -v within="$KEEP_WITHIN" -v now="$(date +%s)" '
+			{ i++ }
+			keep > 0 && i <= keep { next }
+			within > 0 && now - $1 < within { next }
+			{ print $2 }'
+}
+
+`)
+	fmt.Fprintf(b, "%s\n", s.BackupCommand)
+	b.WriteString(`ARCHIVE=$(ls "$BACKUP_DIR"/*.tar.gz | head -n 1)` + "\n")
+	fmt.Fprintf(b, "K0S_VERSION=$(%s | head -n 1)\n", s.VersionCommand)
+	b.WriteString(`
+# record the version of k0s in the archive, like cfctl backup
+mkdir "$BACKUP_DIR/archive"
+tar -xzf "$ARCHIVE" -C "$BACKUP_DIR/archive"
+printf '%s\n' "$K0S_VERSION" > "$BACKUP_DIR/archive/` + VersionFile + `"
+tar -czf "$ARCHIVE" -C "$BACKUP_DIR/archive" .
+rm -rf "$BACKUP_DIR/archive"
+`)
+	b.WriteString(encrypt)
+	b.WriteString(`
+SIZE=$(wc -c < "$ARCHIVE" | tr -d ' ')
+SHA256=$(sha256sum "$ARCHIVE" | cut -d ' ' -f 1)
+MANIFEST="$BACKUP_DIR/manifest.json"
+`)
+	format := `{\n  "archive": "%s",\n  "createdAt": "%s",\n  "size": %s,\n  "sha256": "%s",\n  "k0sVersion": "%s"`
+	if manifest != "" {
+		format += `,\n  %s`
+	}
+	format += `\n}\n`
+	fmt.Fprintf(b, `printf %s "$NAME" "$CREATED_AT" "$SIZE" "$SHA256" "$K0S_VERSION" %s > "$MANIFEST"`+"\n\n", shellescape.Quote(format), shellescape.Quote(manifest))
+	b.WriteString(`put "$ARCHIVE" "$NAME"
+put "$MANIFEST" "$NAME.manifest.json"
+RESULT=success
+`)
+	b.WriteString(`echo "backup $NAME written to ` + strings.ReplaceAll(s.Destination.String(), `"`, `\"`) + `"` + "\n")
+
+	if !s.Retention.IsZero() {
+		b.WriteString(`
+# a failure to prune does not fail the backup
+if NAMES=$(list); then
+	for f in $(printf '%s\n' "$NAMES" | expired); do
+		echo "pruning backup $f"
+		delete "$f" || echo "failed to delete $f" >&2
+		delete "$f.manifest.json" 2> /dev/null || true
+	done
+else
+	echo "failed to list the backups to prune them" >&2
+fi
+`)
+	}
+
+	return b.String(), env, nil
+}
+
+// lease returns the commands skipping the run unless the controller creates
+// the lease, or takes it over once ScheduleLeaseDuration passed since the
+// previous run took it
+func (s Script) lease() string {
+	holder := `"$(hostname)"`
+	if s.Controller != "" {
+		holder = shellescape.Quote(s.Controller)
+	}
+	jsonpath := fmt.Sprintf("jsonpath={.metadata.resourceVersion} {.metadata.annotations.%s} {.spec.holderIdentity}", strings.ReplaceAll(scheduleStartedAnnotation, ".", `\.`))
+	manifest := `{"apiVersion":"coordination.k8s.io/v1","kind":"Lease",` +
+		`"metadata":{"name":"%s","namespace":"%s","resourceVersion":"%s","annotations":{"` + scheduleStartedAnnotation + `":"%s"}},` +
+		`"spec":{"holderIdentity":"%s","leaseDurationSeconds":%s,"acquireTime":"%s","renewTime":"%s"}}`
+
+	b := &strings.Builder{}
+	fmt.Fprintf(b, `
+LEASE_NAME=%s
+LEASE_NAMESPACE=%s
+LEASE_SECONDS=%d
+HOLDER=%s
+
+kube() {
+	%s
+}
+
+# lease prints the lease of the run, for the resource version given as $1
+lease() {
+	printf %s "$LEASE_NAME" "$LEASE_NAMESPACE" "$1" "$CREATED" "$HOLDER" "$LEASE_SECONDS" "$LEASE_TIME" "$LEASE_TIME"
+}
+
+# the backup of a run is taken by a single controller: the first one creating
+# the lease, or taking it over once it expired
+LEASE_TIME=$(date -u +%%Y-%%m-%%dT%%H:%%M:%%S.000000Z)
+if ! lease "" | kube create -f - > /dev/null 2>&1; then
+	LEASE=$(kube -n "$LEASE_NAMESPACE" get lease "$LEASE_NAME" -o %s)
+	set -- $LEASE
+	if [ $((CREATED - ${2:-0})) -lt "$LEASE_SECONDS" ]; then
+		echo "skipping the backup, taken by ${3:-another controller}"
+		RESULT=skipped
+		exit 0
+	fi
+	if ! lease "$1" | kube replace -f - > /dev/null 2>&1; then
+		echo "skipping the backup, taken by another controller"
+		RESULT=skipped
+		exit 0
+	fi
+fi
+`,
+		ScheduleLeaseName, ScheduleLeaseNamespace, int64(ScheduleLeaseDuration/time.Second), holder,
+		s.KubectlCommand, shellescape.Quote(manifest), shellescape.Quote(jsonpath))
+	return b.String()
+}
+
+// manifestFields returns the JSON fields of the manifest known when the
+// script is installed
+func (s Script) manifestFields() (string, error) {
+	var fields []string
+	add := func(name string, value interface{}) error {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		fields = append(fields, fmt.Sprintf("%q: %s", name, data))
+		return nil
+	}
+	if s.Encrypter != nil {
+		if err := add("encryption", s.Encrypter.Encryption()); err != nil {
+			return "", err
+		}
+		if err := add("recipients", s.Encrypter.Recipients()); err != nil {
+			return "", err
+		}
+	}
+	if s.ClusterID != "" {
+		if err := add("clusterID", s.ClusterID); err != nil {
+			return "", err
+		}
+	}
+	if s.Controller != "" {
+		if err := add("controller", s.Controller); err != nil {
+			return "", err
+		}
+	}
+	return strings.Join(fields, ",\n  "), nil
+}
+
+// encrypt returns the commands encrypting $ARCHIVE and appending the
+// extension of the encryption to $NAME
+func (s Script) encrypt() (string, error) {
+	if s.Encrypter == nil {
+		return "", nil
+	}
+	args := []string{}
+	switch s.Encrypter.Encryption() {
+	case EncryptionAge:
+		args = append(args, "age")
+		for _, r := range s.Encrypter.Recipients() {
+			args = append(args, "-r", shellescape.Quote(r))
+		}
+		args = append(args, "-o", `"$ARCHIVE.age"`, `"$ARCHIVE"`)
+		return strings.Join(args, " ") + "\nARCHIVE=\"$ARCHIVE.age\"\nNAME=\"$NAME.age\"\n", nil
+	case EncryptionGPG:
+		if len(s.GPGKeyFiles) != len(s.Encrypter.Recipients()) {
+			return "", errors.New("scheduled gpg encryption needs the public keys of the recipients")
+		}
+		// the keys given as files are used as is, they were verified by cfctl
+		args = append(args, `GNUPGHOME="$BACKUP_DIR/.gnupg"`, "gpg", "--batch", "--yes", "--quiet")
+		for _, f := range s.GPGKeyFiles {
+			args = append(args, "--recipient-file", shellescape.Quote(f))
+		}
+		args = append(args, "--encrypt", "--output", `"$ARCHIVE.gpg"`, `"$ARCHIVE"`)
+		return `mkdir -m 700 "$BACKUP_DIR/.gnupg"` + "\n" + strings.Join(args, " ") + "\nARCHIVE=\"$ARCHIVE.gpg\"\nNAME=\"$NAME.gpg\"\n", nil
+	default:
+		return "", fmt.Errorf("scheduled backups do not support the encryption %s", s.Encrypter.Encryption())
+	}
+}
+
+// destinationFunctions returns the put, list and delete shell functions of
+// the destination and the environment they need. put ships a file under a
+// name, list prints the names of the files of the destination and delete
+// removes a file.
+func (s Script) destinationFunctions() (string, string, error) {
+	switch d := s.Destination.(type) {
+	case *Local:
+		if !path.IsAbs(d.Dir) {
+			return "", "", fmt.Errorf("scheduled backups need an absolute local directory, got %q", d.Dir)
+		}
+		return fmt.Sprintf(`DEST=%s
+
+put() {
+	mkdir -p "$DEST"
+	cp "$1" "$DEST/.$2.part"
+	mv "$DEST/.$2.part" "$DEST/$2"
+}
+
+list() {
+	if [ -d "$DEST" ]; then
+		ls -1 "$DEST"
+	fi
+}
+
+delete() {
+	rm -f "$DEST/$1"
+}
+`, shellescape.Quote(d.Dir)), "", nil
+
+	case *S3:
+		env := &strings.Builder{}
+		fmt.Fprintf(env, "AWS_ACCESS_KEY_ID=%s\n", shellescape.Quote(d.AccessKey))
+		fmt.Fprintf(env, "AWS_SECRET_ACCESS_KEY=%s\n", shellescape.Quote(d.SecretKey))
+		token := ""
+		if d.SessionToken != "" {
+			fmt.Fprintf(env, "AWS_SESSION_TOKEN=%s\n", shellescape.Quote(d.SessionToken))
+			token = ` -H "x-amz-security-token: $AWS_SESSION_TOKEN"`
+		}
+		bucket := strings.TrimSuffix(d.Endpoint.String(), "/") + "/" + uriEncode(d.Bucket, false) + "/"
+		base := bucket
+		prefix := ""
+		if d.Prefix != "" {
+			base += uriEncode(d.Prefix, false) + "/"
+			prefix = d.Prefix + "/"
+		}
+		listURL := bucket + "?delimiter=%2F&list-type=2&prefix=" + uriEncode(prefix, true)
+		// curl signs the requests itself since 7.75, the payload is not hashed
+		// to stream the archive
+		return fmt.Sprintf(`BUCKET_URL=%s
+PREFIX=%s
+
+s3() {
+	curl -fsS --aws-sigv4 %s --user "$AWS_ACCESS_KEY_ID:$AWS_SECRET_ACCESS_KEY" -H "x-amz-content-sha256: UNSIGNED-PAYLOAD"%s "$@"
+}
+
+put() {
+	s3 -T "$1" "$BUCKET_URL$2"
+}
+
+# lists the first 1000 objects, the archives of a prefix are far fewer
+list() {
+	OBJECTS=$(s3 %s) || return 1
+	printf '%%s' "$OBJECTS" | tr '<' '\n' | sed -n 's/^Key>//p' | sed "s|^$PREFIX||"
+}
+
+delete() {
+	s3 -X DELETE "$BUCKET_URL$1"
+}
+`, shellescape.Quote(base), shellescape.Quote(prefix), shellescape.Quote("aws:amz:"+d.Region+":s3"), token, shellescape.Quote(listURL)), env.String(), nil
+
+	case *SFTP:
+		if d.Password != "" {
+			return "", "", errors.New("scheduled sftp backups authenticate with a key, use ?identity=path instead of a password")
+		}
+		if d.IdentityFile == "" {
+			return "", "", errors.New("scheduled sftp backups need a private key, use sftp://user@host/path?identity=path")
+		}
+		if s.KnownHostsFile == "" {
+			return "", "", errors.New("scheduled sftp backups need the key of the server pinned in a known_hosts file")
+		}
+		host, port, err := net.SplitHostPort(d.Address)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid sftp address %q: %w", d.Address, err)
+		}
+		dir := d.Dir
+		if dir == "" {
+			dir = "."
+		}
+		return fmt.Sprintf(`DEST=%s
+
+sftp_batch() {
+	sftp -b - -i %s -P %s -o BatchMode=yes -o StrictHostKeyChecking=yes -o UserKnownHostsFile=%s %s
+}
+
+put() {
+	sftp_batch <<EOF
+put "$1" "$DEST/.$2.part"
+rename "$DEST/.$2.part" "$DEST/$2"
+EOF
+}
+
+list() {
+	FILES=$(echo "ls -1 \"$DEST\"" | sftp_batch) || return 1
+	printf '%%s\n' "$FILES" | grep -v '^sftp>' | sed 's|.*/||'
+}
+
+delete() {
+	echo "rm \"$DEST/$1\"" | sftp_batch > /dev/null
+}
+`, shellescape.Quote(strings.ReplaceAll(dir, `"`, `\"`)), shellescape.Quote(s.IdentityFile), port, shellescape.Quote(s.KnownHostsFile), shellescape.Quote(d.User+"@"+host)), "", nil
+
+	default:
+		return "", "", fmt.Errorf("scheduled backups do not support the destination %s", s.Destination)
+	}
+}
@@ -0,0 +1,201 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScriptLocal(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no sh available")
+	}
+
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "backups")
+	status := filepath.Join(dir, "status")
+	require.NoError(t, os.MkdirAll(dest, 0o755))
+	for _, name := range []string{"k0s_backup_1000.tar.gz", "k0s_backup_1000.tar.gz" + ManifestSuffix, "notes.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dest, name), []byte("old"), 0o600))
+	}
+
+	taken := filepath.Join(dir, "taken.tar.gz")
+	require.NoError(t, os.WriteFile(taken, k0sArchive(t, "etcd-snapshot.db", "pki/ca.crt"), 0o600))
+
+	// kubectl stores the lease in a file, its resource version is always 7
+	leaseFile := filepath.Join(dir, "lease.json")
+	kubectl := filepath.Join(dir, "kubectl")
+	require.NoError(t, os.WriteFile(kubectl, []byte(`case "$1" in
+create) [ -f `+leaseFile+` ] && exit 1; cat > `+leaseFile+` ;;
+replace) cat > `+leaseFile+` ;;
+-n) sed -n 's/.*backup-started":"\([0-9]*\)".*"holderIdentity":"\([^"]*\)".*/7 \1 \2/p' `+leaseFile+` ;;
+esac
+`), 0o700))
+
+	script, env, err := Script{
+		BackupCommand:  `cp ` + taken + ` "$BACKUP_DIR/k0s_backup_1.tar.gz"`,
+		VersionCommand: "echo v1.28.4+k0s.0",
+		KubectlCommand: `sh ` + kubectl + ` "$@"`,
+		Destination:    NewLocal(dest),
+		Retention:      Retention{Keep: 1},
+		ClusterID:      "kube-system:1234",
+		Controller:     "ctrl-0",
+		EnvFile:        filepath.Join(dir, "backup.env"),
+		StatusFile:     status,
+	}.Render()
+	require.NoError(t, err)
+	require.Empty(t, env)
+
+	scriptPath := filepath.Join(dir, "cfctl-backup")
+	require.NoError(t, os.WriteFile(scriptPath, []byte(script), 0o700))
+	out, err := exec.Command(sh, scriptPath).CombinedOutput()
+	require.NoError(t, err, string(out))
+	require.Contains(t, string(out), "pruning backup k0s_backup_1000.tar.gz")
+
+	names, err := NewLocal(dest).List(context.Background())
+	require.NoError(t, err)
+	require.Len(t, names, 3, "the old archive and its manifest are pruned")
+	archives, err := ListArchives(context.Background(), NewLocal(dest))
+	require.NoError(t, err)
+	require.Len(t, archives, 1)
+	archive := archives[0]
+	f, err := os.Open(filepath.Join(dest, archive.Name))
+	require.NoError(t, err)
+	defer f.Close()
+	contents, err := ScanArchive(f)
+	require.NoError(t, err)
+	require.Equal(t, []string{ComponentEtcd, ComponentPKI}, contents.Components)
+	require.Equal(t, "v1.28.4+k0s.0", contents.K0sVersion, "the version is recorded in the archive")
+
+	manifest, err := VerifyFile(filepath.Join(dest, archive.Name))
+	require.NoError(t, err)
+	require.NotNil(t, manifest)
+	require.Equal(t, archive.Name, manifest.Archive)
+	require.Equal(t, "v1.28.4+k0s.0", manifest.K0sVersion)
+	require.Equal(t, "kube-system:1234", manifest.ClusterID)
+	require.Equal(t, "ctrl-0", manifest.Controller)
+	require.Equal(t, archive.Time, manifest.CreatedAt.Local())
+
+	s, err := os.ReadFile(status)
+	require.NoError(t, err)
+	require.Contains(t, string(s), "result=success\n")
+	require.Contains(t, string(s), "archive="+archive.Name+"\n")
+
+	lease := &struct {
+		Metadata struct {
+			Name            string            `json:"name"`
+			ResourceVersion string            `json:"resourceVersion"`
+			Annotations     map[string]string `json:"annotations"`
+		} `json:"metadata"`
+		Spec struct {
+			HolderIdentity string `json:"holderIdentity"`
+		} `json:"spec"`
+	}{}
+	data, err := os.ReadFile(leaseFile)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, lease))
+	require.Equal(t, ScheduleLeaseName, lease.Metadata.Name)
+	require.Equal(t, "ctrl-0", lease.Spec.HolderIdentity)
+	require.Empty(t, lease.Metadata.ResourceVersion)
+
+	// the run of another controller is skipped while the lease is recent
+	out, err = exec.Command(sh, scriptPath).CombinedOutput()
+	require.NoError(t, err, string(out))
+	require.Contains(t, string(out), "skipping the backup, taken by ctrl-0")
+	s, err = os.ReadFile(status)
+	require.NoError(t, err)
+	require.Contains(t, string(s), "result=skipped\n")
+
+	// and takes the lease over once it expired
+	started := lease.Metadata.Annotations[scheduleStartedAnnotation]
+	require.NotEmpty(t, started)
+	require.NoError(t, os.WriteFile(leaseFile, bytes.Replace(data, []byte(`"`+started+`"`), []byte(`"0"`), 1), 0o600))
+	out, err = exec.Command(sh, scriptPath).CombinedOutput()
+	require.NoError(t, err, string(out))
+	require.NotContains(t, string(out), "skipping")
+	data, err = os.ReadFile(leaseFile)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, lease))
+	require.Equal(t, "7", lease.Metadata.ResourceVersion, "the lease is replaced")
+
+	// a failing backup is recorded in the status file
+	script, _, err = Script{
+		BackupCommand:  "false",
+		VersionCommand: "echo v1.28.4+k0s.0",
+		Destination:    NewLocal(dest),
+		StatusFile:     status,
+	}.Render()
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(scriptPath, []byte(script), 0o700))
+	require.Error(t, exec.Command(sh, scriptPath).Run())
+	s, err = os.ReadFile(status)
+	require.NoError(t, err)
+	require.Contains(t, string(s), "result=failed\n")
+
+	_, _, err = Script{Destination: NewLocal("backups")}.Render()
+	require.Error(t, err, "relative directories are ambiguous on the hosts")
+}
+
+func TestScriptRemote(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "it's secret")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	u, err := url.Parse("s3://backups/prod?endpoint=http://minio:9000&region=eu-west-1")
+	require.NoError(t, err)
+	s3, err := NewS3(u)
+	require.NoError(t, err)
+
+	script, env, err := Script{BackupCommand: "k0s backup", Destination: s3, Retention: Retention{Keep: 7}}.Render()
+	require.NoError(t, err)
+	require.Contains(t, script, `--aws-sigv4 aws:amz:eu-west-1:s3`)
+	require.Contains(t, script, `BUCKET_URL=http://minio:9000/backups/prod/`)
+	require.Contains(t, script, `'http://minio:9000/backups/?delimiter=%2F&list-type=2&prefix=prod%2F'`)
+	require.Contains(t, script, "KEEP=7\n")
+	require.NotContains(t, script, "AKID", "the credentials belong in the environment file")
+	require.Equal(t, "AWS_ACCESS_KEY_ID=AKID\nAWS_SECRET_ACCESS_KEY='it'\"'\"'s secret'\n", env)
+
+	u, err = url.Parse("sftp://backup@nas:2222/srv/k0s?identity=/home/me/.ssh/id_backup")
+	require.NoError(t, err)
+	sftp, err := NewSFTP(u)
+	require.NoError(t, err)
+	script, _, err = Script{BackupCommand: "k0s backup", Destination: sftp, IdentityFile: "/etc/cfctl/backup_id", KnownHostsFile: "/etc/cfctl/backup_known_hosts"}.Render()
+	require.NoError(t, err)
+	require.Contains(t, script, "-i /etc/cfctl/backup_id -P 2222")
+	require.Contains(t, script, "-o StrictHostKeyChecking=yes -o UserKnownHostsFile=/etc/cfctl/backup_known_hosts")
+	require.Contains(t, script, "DEST=/srv/k0s\n")
+	require.True(t, strings.Contains(script, `rename "$DEST/.$2.part" "$DEST/$2"`), script)
+
+	_, _, err = Script{Destination: sftp, IdentityFile: "/etc/cfctl/backup_id"}.Render()
+	require.Error(t, err, "the key of the server must be pinned")
+
+	sftp.IdentityFile = ""
+	_, _, err = Script{Destination: sftp}.Render()
+	require.Error(t, err)
+}
+
+func TestScriptEncryption(t *testing.T) {
+	recipient := "age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p"
+	e, err := NewEncrypter([]string{recipient})
+	require.NoError(t, err)
+	script, _, err := Script{BackupCommand: "k0s backup", Destination: NewLocal("/var/backups"), Encrypter: e}.Render()
+	require.NoError(t, err)
+	require.Contains(t, script, "age -r "+recipient+` -o "$ARCHIVE.age" "$ARCHIVE"`)
+	require.Contains(t, script, `"encryption": "age"`)
+	require.Contains(t, script, `"recipients": ["`+recipient+`"]`)
+
+	gpg := &gpgEncrypter{recipients: []string{"ops@example.com"}}
+	_, _, err = Script{Destination: NewLocal("/var/backups"), Encrypter: gpg}.Render()
+	require.Error(t, err, "the public keys are needed")
+	script, _, err = Script{Destination: NewLocal("/var/backups"), Encrypter: gpg, GPGKeyFiles: []string{"/etc/cfctl/backup_keys/0.asc"}}.Render()
+	require.NoError(t, err)
+	require.Contains(t, script, `--recipient-file /etc/cfctl/backup_keys/0.asc --encrypt --output "$ARCHIVE.gpg"`)
+}
@@ -0,0 +1,357 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SFTP stores the archives in a directory of a SFTP server
+type SFTP struct {
+	User     string
+	Password string
+	// Address is the host:port of the server
+	Address string
+	// Dir is the directory of the archives, relative to the login directory
+	// unless absolute
+	Dir string
+	// IdentityFile is the private key used to authenticate, defaults to the
+	// ssh agent and the default keys of ~/.ssh
+	IdentityFile string
+	// KnownHosts is the known_hosts file used to verify the server, defaults to ~/.ssh/known_hosts
+	KnownHosts string
+
+	// dial opens the sftp subsystem, overridden in tests
+	dial func(ctx context.Context) (io.ReadWriteCloser, error)
+}
+
+// NewSFTP returns a destination for a "sftp://user@host:port/path" URL. A path
+// starting with "/~/" is relative to the login directory. The "identity" and
+// "known-hosts" query parameters override the default ssh files.
+func NewSFTP(u *url.URL) (*SFTP, error) {
+	if u.Hostname() == "" {
+		return nil, errors.New("sftp destination: no host given, use sftp://user@host/path")
+	}
+
+	s := &SFTP{
+		Address:      u.Host,
+		Dir:          u.Path,
+		IdentityFile: u.Query().Get("identity"),
+		KnownHosts:   u.Query().Get("known-hosts"),
+	}
+	if u.Port() == "" {
+		s.Address = net.JoinHostPort(u.Hostname(), "22")
+	}
+	if strings.HasPrefix(s.Dir, "/~/") || s.Dir == "/~" {
+		s.Dir = strings.TrimPrefix(strings.TrimPrefix(s.Dir, "/~"), "/")
+	}
+	if s.Dir == "" {
+		s.Dir = "."
+	}
+
+	if u.User != nil {
+		s.User = u.User.Username()
+		s.Password, _ = u.User.Password()
+	}
+	if s.User == "" {
+		current, err := user.Current()
+		if err != nil {
+			return nil, fmt.Errorf("sftp destination: no user given: %w", err)
+		}
+		s.User = current.Username
+	}
+
+	return s, nil
+}
+
+// String returns the sftp URL of the destination
+func (s *SFTP) String() string {
+	dir := s.Dir
+	if !path.IsAbs(dir) {
+		dir = "/~/" + dir
+	}
+	return fmt.Sprintf("sftp://%s@%s%s", s.User, s.Address, path.Clean(dir))
+}
+
+// Put uploads the archive to a temporary file renamed once complete
+func (s *SFTP) Put(ctx context.Context, name string, r io.Reader) error {
+	return s.session(ctx, func(c *sftpConn) error {
+		tmp := path.Join(s.Dir, "."+name+".part")
+		handle, err := c.open(tmp, sftpFlagWrite|sftpFlagCreate|sftpFlagTruncate, 0o600)
+		if err != nil {
+			return fmt.Errorf("open %s: %w", tmp, err)
+		}
+		if err := c.writeFrom(handle, r); err != nil {
+			_ = c.close(handle)
+			_ = c.remove(tmp)
+			return fmt.Errorf("write %s: %w", tmp, err)
+		}
+		if err := c.close(handle); err != nil {
+			_ = c.remove(tmp)
+			return fmt.Errorf("close %s: %w", tmp, err)
+		}
+		if err := c.rename(tmp, path.Join(s.Dir, name)); err != nil {
+			_ = c.remove(tmp)
+			return fmt.Errorf("rename %s: %w", tmp, err)
+		}
+		return nil
+	})
+}
+
+// Get downloads a file, the connection is closed with the reader
+func (s *SFTP) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	dial := s.dial
+	if dial == nil {
+		dial = s.dialSSH
+	}
+	rwc, err := dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c, err := newSFTPConn(rwc)
+	if err != nil {
+		_ = rwc.Close()
+		return nil, fmt.Errorf("sftp %s: %w", s.Address, err)
+	}
+	file := path.Join(s.Dir, name)
+	handle, err := c.open(file, sftpFlagRead, 0)
+	if err != nil {
+		_ = rwc.Close()
+		return nil, fmt.Errorf("open %s: %w", file, err)
+	}
+	return &sftpFile{conn: c, handle: handle, closer: rwc}, nil
+}
+
+// List returns the names of the regular files of the directory
+func (s *SFTP) List(ctx context.Context) ([]string, error) {
+	var names []string
+	err := s.session(ctx, func(c *sftpConn) error {
+		entries, err := c.readDir(s.Dir)
+		if err != nil {
+			return fmt.Errorf("read directory %s: %w", s.Dir, err)
+		}
+		for _, e := range entries {
+			if e.regular {
+				names = append(names, e.name)
+			}
+		}
+		return nil
+	})
+	return names, err
+}
+
+// Delete removes an archive
+func (s *SFTP) Delete(ctx context.Context, name string) error {
+	return s.session(ctx, func(c *sftpConn) error {
+		return c.remove(path.Join(s.Dir, name))
+	})
+}
+
+// session runs fn with a sftp connection to the server
+func (s *SFTP) session(ctx context.Context, fn func(*sftpConn) error) error {
+	dial := s.dial
+	if dial == nil {
+		dial = s.dialSSH
+	}
+	rwc, err := dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer rwc.Close()
+
+	c, err := newSFTPConn(rwc)
+	if err != nil {
+		return fmt.Errorf("sftp %s: %w", s.Address, err)
+	}
+	return fn(c)
+}
+
+// sshSubsystem closes the ssh session and client with the subsystem
+type sshSubsystem struct {
+	io.Reader
+	io.WriteCloser
+	session *ssh.Session
+	client  *ssh.Client
+}
+
+func (s *sshSubsystem) Close() error {
+	_ = s.WriteCloser.Close()
+	_ = s.session.Close()
+	return s.client.Close()
+}
+
+// dialSSH connects to the server and starts the sftp subsystem
+func (s *SFTP) dialSSH(ctx context.Context) (io.ReadWriteCloser, error) {
+	config, closeAgent, err := s.clientConfig()
+	if err != nil {
+		return nil, err
+	}
+	defer closeAgent()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.Address)
+	if err != nil {
+		return nil, err
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, s.Address, config)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("ssh %s: %w", s.Address, err)
+	}
+	client := ssh.NewClient(sshConn, chans, reqs)
+
+	session, err := client.NewSession()
+	if err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+	if err := session.RequestSubsystem("sftp"); err != nil {
+		_ = client.Close()
+		return nil, fmt.Errorf("ssh %s: start sftp subsystem: %w", s.Address, err)
+	}
+
+	return &sshSubsystem{Reader: stdout, WriteCloser: stdin, session: session, client: client}, nil
+}
+
+// hostKeyCallback verifies the key of the server with the known hosts
+func (s *SFTP) hostKeyCallback() (ssh.HostKeyCallback, error) {
+	knownHostsFile := s.KnownHosts
+	if knownHostsFile == "" {
+		home, _ := os.UserHomeDir()
+		knownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	hostKeyCallback, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("sftp destination: read known hosts: %w", err)
+	}
+	return hostKeyCallback, nil
+}
+
+// KnownHostsLine returns the known_hosts line of the key of the server once
+// verified with the known hosts, so that other hosts can pin it
+func (s *SFTP) KnownHostsLine(ctx context.Context) (string, error) {
+	hostKeyCallback, err := s.hostKeyCallback()
+	if err != nil {
+		return "", err
+	}
+
+	var line string
+	config := &ssh.ClientConfig{
+		User: s.User,
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			if err := hostKeyCallback(hostname, remote, key); err != nil {
+				return err
+			}
+			line = knownhosts.Line([]string{knownhosts.Normalize(s.Address)}, key)
+			return nil
+		},
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.Address)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	// the key is verified during the handshake, the authentication that
+	// follows is expected to fail
+	sshConn, _, _, err := ssh.NewClientConn(conn, s.Address, config)
+	if err == nil {
+		_ = sshConn.Close()
+	}
+	if line == "" {
+		return "", fmt.Errorf("ssh %s: %w", s.Address, err)
+	}
+	return line, nil
+}
+
+// clientConfig returns the ssh client configuration and a function closing the
+// connection to the ssh agent once authenticated
+func (s *SFTP) clientConfig() (*ssh.ClientConfig, func(), error) {
+	home, _ := os.UserHomeDir()
+	closeAgent := func() {}
+
+	hostKeyCallback, err := s.hostKeyCallback()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var auth []ssh.AuthMethod
+	if s.Password != "" {
+		auth = append(auth, ssh.Password(s.Password))
+	}
+
+	var signers []ssh.Signer
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" && s.IdentityFile == "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			closeAgent = func() { _ = conn.Close() }
+			if agentSigners, err := agent.NewClient(conn).Signers(); err == nil {
+				signers = append(signers, agentSigners...)
+			}
+		}
+	}
+
+	identities := []string{s.IdentityFile}
+	if s.IdentityFile == "" {
+		identities = []string{
+			filepath.Join(home, ".ssh", "id_ed25519"),
+			filepath.Join(home, ".ssh", "id_ecdsa"),
+			filepath.Join(home, ".ssh", "id_rsa"),
+		}
+	}
+	for _, f := range identities {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			if s.IdentityFile != "" {
+				closeAgent()
+				return nil, nil, fmt.Errorf("sftp destination: %w", err)
+			}
+			continue
+		}
+		signer, err := ssh.ParsePrivateKey(data)
+		if err != nil {
+			if s.IdentityFile != "" {
+				closeAgent()
+				return nil, nil, fmt.Errorf("sftp destination: %s: %w", f, err)
+			}
+			// encrypted keys are expected to be loaded in the agent
+			continue
+		}
+		signers = append(signers, signer)
+	}
+	if len(signers) > 0 {
+		auth = append(auth, ssh.PublicKeys(signers...))
+	}
+	if len(auth) == 0 {
+		closeAgent()
+		return nil, nil, errors.New("sftp destination: no ssh key or agent found to authenticate")
+	}
+
+	return &ssh.ClientConfig{
+		User:            s.User,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+	}, closeAgent, nil
+}
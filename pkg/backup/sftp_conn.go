@@ -0,0 +1,457 @@
+package backup
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// A minimal client of the version 3 of the SSH File Transfer Protocol
+// (draft-ietf-secsh-filexfer-02), implementing what the destination needs.
+
+const (
+	sftpInit     = 1
+	sftpVersion  = 2
+	sftpOpen     = 3
+	sftpClose    = 4
+	sftpRead     = 5
+	sftpWrite    = 6
+	sftpOpenDir  = 11
+	sftpReadDir  = 12
+	sftpRemove   = 13
+	sftpRename   = 18
+	sftpStatus   = 101
+	sftpHandle   = 102
+	sftpData     = 103
+	sftpName     = 104
+	sftpProtocol = 3
+
+	sftpFlagRead     = 0x01
+	sftpFlagWrite    = 0x02
+	sftpFlagCreate   = 0x08
+	sftpFlagTruncate = 0x10
+
+	sftpAttrSize        = 0x01
+	sftpAttrUIDGID      = 0x02
+	sftpAttrPermissions = 0x04
+	sftpAttrACModTime   = 0x08
+	sftpAttrExtended    = 0x80000000
+
+	sftpStatusOK  = 0
+	sftpStatusEOF = 1
+
+	// sftpChunkSize is the payload of the write requests, the maximum most servers accept
+	sftpChunkSize = 32 << 10
+	// sftpWindow is the number of write requests sent before waiting for their status
+	sftpWindow = 16
+)
+
+// SFTPStatusError is a status returned by the server for a failed request
+type SFTPStatusError struct {
+	Code    uint32
+	Message string
+}
+
+func (e *SFTPStatusError) Error() string {
+	return fmt.Sprintf("sftp status %d: %s", e.Code, e.Message)
+}
+
+// Is matches os.ErrNotExist for the "no such file" status
+func (e *SFTPStatusError) Is(target error) bool {
+	return target == os.ErrNotExist && e.Code == 2
+}
+
+type sftpConn struct {
+	rw     io.ReadWriter
+	nextID uint32
+}
+
+type sftpEntry struct {
+	name    string
+	regular bool
+}
+
+// newSFTPConn negotiates the protocol version
+func newSFTPConn(rw io.ReadWriter) (*sftpConn, error) {
+	c := &sftpConn{rw: rw}
+	var p sftpPacket
+	p.byte(sftpInit)
+	p.uint32(sftpProtocol)
+	if err := c.send(p); err != nil {
+		return nil, err
+	}
+	typ, data, err := c.recv()
+	if err != nil {
+		return nil, err
+	}
+	if typ != sftpVersion {
+		return nil, fmt.Errorf("unexpected sftp packet %d during init", typ)
+	}
+	r := sftpReader(data)
+	if v, err := r.uint32(); err != nil || v < sftpProtocol {
+		return nil, fmt.Errorf("unsupported sftp server version %d", v)
+	}
+	return c, nil
+}
+
+func (c *sftpConn) send(p sftpPacket) error {
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(p)))
+	_, err := c.rw.Write(append(length[:], p...))
+	return err
+}
+
+func (c *sftpConn) recv() (byte, []byte, error) {
+	var length [4]byte
+	if _, err := io.ReadFull(c.rw, length[:]); err != nil {
+		return 0, nil, err
+	}
+	n := binary.BigEndian.Uint32(length[:])
+	if n == 0 || n > 256<<10 {
+		return 0, nil, fmt.Errorf("invalid sftp packet length %d", n)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(c.rw, data); err != nil {
+		return 0, nil, err
+	}
+	return data[0], data[1:], nil
+}
+
+// request starts a packet of the given type with a new request id
+func (c *sftpConn) request(typ byte) (sftpPacket, uint32) {
+	c.nextID++
+	var p sftpPacket
+	p.byte(typ)
+	p.uint32(c.nextID)
+	return p, c.nextID
+}
+
+// response reads a response and returns its id, type and payload
+func (c *sftpConn) response() (uint32, byte, sftpReader, error) {
+	typ, data, err := c.recv()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	r := sftpReader(data)
+	id, err := r.uint32()
+	return id, typ, r, err
+}
+
+// call sends a request and reads its response, converting failure statuses to errors
+func (c *sftpConn) call(p sftpPacket, id uint32, expect byte) (sftpReader, error) {
+	if err := c.send(p); err != nil {
+		return nil, err
+	}
+	rid, typ, r, err := c.response()
+	if err != nil {
+		return nil, err
+	}
+	if rid != id {
+		return nil, fmt.Errorf("unexpected sftp response id %d, expected %d", rid, id)
+	}
+	if typ == sftpStatus {
+		err := r.status()
+		if err == nil && expect != sftpStatus {
+			return nil, errors.New("unexpected sftp status response")
+		}
+		return r, err
+	}
+	if typ != expect {
+		return nil, fmt.Errorf("unexpected sftp packet %d, expected %d", typ, expect)
+	}
+	return r, nil
+}
+
+func (c *sftpConn) open(path string, flags uint32, perm os.FileMode) (string, error) {
+	p, id := c.request(sftpOpen)
+	p.string(path)
+	p.uint32(flags)
+	p.uint32(sftpAttrPermissions)
+	p.uint32(uint32(perm.Perm()))
+	r, err := c.call(p, id, sftpHandle)
+	if err != nil {
+		return "", err
+	}
+	return r.string()
+}
+
+func (c *sftpConn) close(handle string) error {
+	p, id := c.request(sftpClose)
+	p.string(handle)
+	_, err := c.call(p, id, sftpStatus)
+	return err
+}
+
+func (c *sftpConn) remove(path string) error {
+	p, id := c.request(sftpRemove)
+	p.string(path)
+	_, err := c.call(p, id, sftpStatus)
+	return err
+}
+
+func (c *sftpConn) rename(from, to string) error {
+	p, id := c.request(sftpRename)
+	p.string(from)
+	p.string(to)
+	_, err := c.call(p, id, sftpStatus)
+	return err
+}
+
+// writeFrom writes r to the file, keeping up to sftpWindow requests in flight
+func (c *sftpConn) writeFrom(handle string, r io.Reader) error {
+	var offset uint64
+	inflight := make(map[uint32]struct{}, sftpWindow)
+	buf := make([]byte, sftpChunkSize)
+
+	wait := func() error {
+		id, typ, resp, err := c.response()
+		if err != nil {
+			return err
+		}
+		if _, ok := inflight[id]; !ok || typ != sftpStatus {
+			return fmt.Errorf("unexpected sftp response %d to a write", typ)
+		}
+		delete(inflight, id)
+		return resp.status()
+	}
+
+	for {
+		n, readErr := io.ReadFull(r, buf)
+		if n > 0 {
+			for len(inflight) >= sftpWindow {
+				if err := wait(); err != nil {
+					return err
+				}
+			}
+			p, id := c.request(sftpWrite)
+			p.string(handle)
+			p.uint64(offset)
+			p.string(string(buf[:n]))
+			if err := c.send(p); err != nil {
+				return err
+			}
+			inflight[id] = struct{}{}
+			offset += uint64(n)
+		}
+		if errors.Is(readErr, io.EOF) || errors.Is(readErr, io.ErrUnexpectedEOF) {
+			break
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+
+	for len(inflight) > 0 {
+		if err := wait(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// read reads up to n bytes of the file at offset, io.EOF at the end of the file
+func (c *sftpConn) read(handle string, offset uint64, n uint32) ([]byte, error) {
+	p, id := c.request(sftpRead)
+	p.string(handle)
+	p.uint64(offset)
+	p.uint32(n)
+	r, err := c.call(p, id, sftpData)
+	var status *SFTPStatusError
+	if errors.As(err, &status) && status.Code == sftpStatusEOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, err := r.string()
+	return []byte(data), err
+}
+
+// sftpFile reads a file sequentially
+type sftpFile struct {
+	conn   *sftpConn
+	handle string
+	closer io.Closer
+	offset uint64
+	buf    []byte
+}
+
+func (f *sftpFile) Read(p []byte) (int, error) {
+	if len(f.buf) == 0 {
+		data, err := f.conn.read(f.handle, f.offset, sftpChunkSize)
+		if err != nil {
+			return 0, err
+		}
+		f.offset += uint64(len(data))
+		f.buf = data
+	}
+	n := copy(p, f.buf)
+	f.buf = f.buf[n:]
+	return n, nil
+}
+
+func (f *sftpFile) Close() error {
+	_ = f.conn.close(f.handle)
+	return f.closer.Close()
+}
+
+func (c *sftpConn) readDir(path string) ([]sftpEntry, error) {
+	p, id := c.request(sftpOpenDir)
+	p.string(path)
+	r, err := c.call(p, id, sftpHandle)
+	if err != nil {
+		return nil, err
+	}
+	handle, err := r.string()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = c.close(handle) }()
+
+	var entries []sftpEntry
+	for {
+		p, id := c.request(sftpReadDir)
+		p.string(handle)
+		r, err := c.call(p, id, sftpName)
+		var status *SFTPStatusError
+		if errors.As(err, &status) && status.Code == sftpStatusEOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		count, err := r.uint32()
+		if err != nil {
+			return nil, err
+		}
+		for i := uint32(0); i < count; i++ {
+			name, err := r.string()
+			if err != nil {
+				return nil, err
+			}
+			if _, err := r.string(); err != nil { // long name
+				return nil, err
+			}
+			mode, err := r.attrs()
+			if err != nil {
+				return nil, err
+			}
+			if name == "." || name == ".." {
+				continue
+			}
+			entries = append(entries, sftpEntry{name: name, regular: mode&0o170000 == 0o100000})
+		}
+	}
+}
+
+// sftpPacket builds a packet payload
+type sftpPacket []byte
+
+func (p *sftpPacket) byte(b byte) {
+	*p = append(*p, b)
+}
+
+func (p *sftpPacket) uint32(v uint32) {
+	*p = binary.BigEndian.AppendUint32(*p, v)
+}
+
+func (p *sftpPacket) uint64(v uint64) {
+	*p = binary.BigEndian.AppendUint64(*p, v)
+}
+
+func (p *sftpPacket) string(s string) {
+	p.uint32(uint32(len(s)))
+	*p = append(*p, s...)
+}
+
+var errSFTPShortPacket = errors.New("short sftp packet")
+
+// sftpReader decodes a packet payload
+type sftpReader []byte
+
+func (r *sftpReader) uint32() (uint32, error) {
+	if len(*r) < 4 {
+		return 0, errSFTPShortPacket
+	}
+	v := binary.BigEndian.Uint32(*r)
+	*r = (*r)[4:]
+	return v, nil
+}
+
+func (r *sftpReader) uint64() (uint64, error) {
+	if len(*r) < 8 {
+		return 0, errSFTPShortPacket
+	}
+	v := binary.BigEndian.Uint64(*r)
+	*r = (*r)[8:]
+	return v, nil
+}
+
+func (r *sftpReader) string() (string, error) {
+	n, err := r.uint32()
+	if err != nil {
+		return "", err
+	}
+	if uint32(len(*r)) < n {
+		return "", errSFTPShortPacket
+	}
+	s := string((*r)[:n])
+	*r = (*r)[n:]
+	return s, nil
+}
+
+// status decodes a status payload, returning nil for the OK status
+func (r *sftpReader) status() error {
+	code, err := r.uint32()
+	if err != nil {
+		return err
+	}
+	if code == sftpStatusOK {
+		return nil
+	}
+	msg, _ := r.string()
+	return &SFTPStatusError{Code: code, Message: msg}
+}
+
+// attrs decodes file attributes and returns the permissions
+func (r *sftpReader) attrs() (uint32, error) {
+	flags, err := r.uint32()
+	if err != nil {
+		return 0, err
+	}
+	if flags&sftpAttrSize != 0 {
+		if _, err := r.uint64(); err != nil {
+			return 0, err
+		}
+	}
+	if flags&sftpAttrUIDGID != 0 {
+		if _, err := r.uint64(); err != nil {
+			return 0, err
+		}
+	}
+	var mode uint32
+	if flags&sftpAttrPermissions != 0 {
+		if mode, err = r.uint32(); err != nil {
+			return 0, err
+		}
+	}
+	if flags&sftpAttrACModTime != 0 {
+		if _, err := r.uint64(); err != nil {
+			return 0, err
+		}
+	}
+	if flags&sftpAttrExtended != 0 {
+		count, err := r.uint32()
+		if err != nil {
+			return 0, err
+		}
+		for i := uint32(0); i < 2*count; i++ {
+			if _, err := r.string(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return mode, nil
+}
@@ -0,0 +1,259 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// queuedConn queues the writes so that the server never blocks on a client
+// sending pipelined requests, like the window of a ssh channel
+type queuedConn struct {
+	io.Reader
+	queue chan []byte
+}
+
+func (q *queuedConn) Write(p []byte) (int, error) {
+	q.queue <- append([]byte{}, p...)
+	return len(p), nil
+}
+
+// serveSFTP is a minimal SFTP server serving root for the requests used by the client
+func serveSFTP(conn io.ReadWriteCloser, root string) {
+	defer conn.Close()
+	queue := make(chan []byte, 1024)
+	defer close(queue)
+	go func() {
+		for p := range queue {
+			if _, err := conn.Write(p); err != nil {
+				return
+			}
+		}
+	}()
+	c := &sftpConn{rw: &queuedConn{Reader: conn, queue: queue}}
+	files := make(map[string]*os.File)
+	dirs := make(map[string][]os.DirEntry)
+
+	reply := func(id uint32, typ byte, fill func(p *sftpPacket)) {
+		var p sftpPacket
+		p.byte(typ)
+		p.uint32(id)
+		fill(&p)
+		_ = c.send(p)
+	}
+	status := func(id uint32, err error) {
+		reply(id, sftpStatus, func(p *sftpPacket) {
+			switch {
+			case err == nil:
+				p.uint32(sftpStatusOK)
+			case errors.Is(err, io.EOF):
+				p.uint32(sftpStatusEOF)
+			case errors.Is(err, os.ErrNotExist):
+				p.uint32(2)
+			default:
+				p.uint32(4)
+			}
+			if err != nil {
+				p.string(err.Error())
+			} else {
+				p.string("")
+			}
+			p.string("")
+		})
+	}
+
+	for {
+		typ, data, err := c.recv()
+		if err != nil {
+			return
+		}
+		r := sftpReader(data)
+		if typ == sftpInit {
+			var p sftpPacket
+			p.byte(sftpVersion)
+			p.uint32(sftpProtocol)
+			_ = c.send(p)
+			continue
+		}
+		id, _ := r.uint32()
+		switch typ {
+		case sftpOpen:
+			name, _ := r.string()
+			flags, _ := r.uint32()
+			mode := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+			if flags == sftpFlagRead {
+				mode = os.O_RDONLY
+			}
+			f, err := os.OpenFile(filepath.Join(root, name), mode, 0o600)
+			if err != nil {
+				status(id, err)
+				continue
+			}
+			files[name] = f
+			reply(id, sftpHandle, func(p *sftpPacket) { p.string(name) })
+		case sftpWrite:
+			handle, _ := r.string()
+			offset, _ := r.uint64()
+			payload, _ := r.string()
+			_, err := files[handle].WriteAt([]byte(payload), int64(offset))
+			status(id, err)
+		case sftpRead:
+			handle, _ := r.string()
+			offset, _ := r.uint64()
+			n, _ := r.uint32()
+			buf := make([]byte, n)
+			read, err := files[handle].ReadAt(buf, int64(offset))
+			if read == 0 {
+				status(id, err)
+				continue
+			}
+			reply(id, sftpData, func(p *sftpPacket) { p.string(string(buf[:read])) })
+		case sftpClose:
+			handle, _ := r.string()
+			if f, ok := files[handle]; ok {
+				status(id, f.Close())
+				delete(files, handle)
+			} else {
+				delete(dirs, handle)
+				status(id, nil)
+			}
+		case sftpRename:
+			from, _ := r.string()
+			to, _ := r.string()
+			status(id, os.Rename(filepath.Join(root, from), filepath.Join(root, to)))
+		case sftpRemove:
+			name, _ := r.string()
+			status(id, os.Remove(filepath.Join(root, name)))
+		case sftpOpenDir:
+			name, _ := r.string()
+			entries, err := os.ReadDir(filepath.Join(root, name))
+			if err != nil {
+				status(id, err)
+				continue
+			}
+			dirs[name] = entries
+			reply(id, sftpHandle, func(p *sftpPacket) { p.string(name) })
+		case sftpReadDir:
+			handle, _ := r.string()
+			entries := dirs[handle]
+			if len(entries) == 0 {
+				status(id, io.EOF)
+				continue
+			}
+			dirs[handle] = nil
+			reply(id, sftpName, func(p *sftpPacket) {
+				p.uint32(uint32(len(entries)))
+				for _, e := range entries {
+					p.string(e.Name())
+					p.string(e.Name())
+					info, _ := e.Info()
+					p.uint32(sftpAttrSize | sftpAttrPermissions)
+					p.uint64(uint64(info.Size()))
+					mode := uint32(0o100600)
+					if e.IsDir() {
+						mode = 0o040700
+					}
+					p.uint32(mode)
+				}
+			})
+		default:
+			status(id, errors.New("unsupported"))
+		}
+	}
+}
+
+func TestSFTPDestination(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(root, "backups"), 0o700))
+	require.NoError(t, os.Mkdir(filepath.Join(root, "backups", "subdir"), 0o700))
+
+	d, err := ParseDestination("sftp://backup@storage.example.com/~/backups")
+	require.NoError(t, err)
+	s := d.(*SFTP)
+	require.Equal(t, "storage.example.com:22", s.Address)
+	require.Equal(t, "backups", s.Dir)
+	require.Equal(t, "sftp://backup@storage.example.com:22/~/backups", s.String())
+
+	s.dial = func(context.Context) (io.ReadWriteCloser, error) {
+		client, server := net.Pipe()
+		go serveSFTP(server, root)
+		return client, nil
+	}
+
+	ctx := context.Background()
+	archive := bytes.Repeat([]byte("k0s"), 100000)
+	require.NoError(t, s.Put(ctx, "k0s_backup_1.tar.gz", bytes.NewReader(archive)))
+	require.NoError(t, s.Put(ctx, "k0s_backup_2.tar.gz", bytes.NewReader([]byte("second"))))
+
+	written, err := os.ReadFile(filepath.Join(root, "backups", "k0s_backup_1.tar.gz"))
+	require.NoError(t, err)
+	require.Equal(t, archive, written)
+
+	names, err := s.List(ctx)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"k0s_backup_1.tar.gz", "k0s_backup_2.tar.gz"}, names)
+
+	rc, err := s.Get(ctx, "k0s_backup_1.tar.gz")
+	require.NoError(t, err)
+	read, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	require.Equal(t, archive, read)
+	_, err = s.Get(ctx, "missing")
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	require.NoError(t, s.Delete(ctx, "k0s_backup_1.tar.gz"))
+	require.ErrorIs(t, s.Delete(ctx, "k0s_backup_1.tar.gz"), os.ErrNotExist)
+	require.NoFileExists(t, filepath.Join(root, "backups", "k0s_backup_1.tar.gz"))
+}
+
+func TestSFTPKnownHostsLine(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	hostKey, err := ssh.NewSignerFromKey(priv)
+	require.NoError(t, err)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			config := &ssh.ServerConfig{
+				PasswordCallback: func(ssh.ConnMetadata, []byte) (*ssh.Permissions, error) {
+					return nil, errors.New("denied")
+				},
+			}
+			config.AddHostKey(hostKey)
+			_, _, _, _ = ssh.NewServerConn(conn, config)
+			_ = conn.Close()
+		}
+	}()
+
+	line := knownhosts.Line([]string{knownhosts.Normalize(l.Addr().String())}, hostKey.PublicKey())
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	require.NoError(t, os.WriteFile(knownHosts, []byte(line+"\n"), 0o600))
+
+	s := &SFTP{User: "backup", Address: l.Addr().String(), KnownHosts: knownHosts}
+	got, err := s.KnownHostsLine(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, line, got)
+
+	require.NoError(t, os.WriteFile(knownHosts, nil, 0o600))
+	_, err = s.KnownHostsLine(context.Background())
+	require.ErrorContains(t, err, "knownhosts: key is unknown")
+}
@@ -0,0 +1,189 @@
+// Package cron validates cron schedules and converts them to systemd calendar
+// events.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Schedule is a validated five fields cron expression or a macro such as @daily
+type Schedule struct {
+	expr   string
+	fields []string
+}
+
+var macros = map[string]string{
+	"@yearly":   "yearly",
+	"@annually": "yearly",
+	"@monthly":  "monthly",
+	"@weekly":   "weekly",
+	"@daily":    "daily",
+	"@midnight": "daily",
+	"@hourly":   "hourly",
+}
+
+type field struct {
+	name     string
+	min, max int
+	names    []string
+}
+
+var fields = []field{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"", "jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat", "sun"}},
+}
+
+// Parse validates a cron expression
+func Parse(expr string) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if strings.HasPrefix(expr, "@") {
+		if _, ok := macros[expr]; !ok {
+			return Schedule{}, fmt.Errorf("unknown cron macro %q", expr)
+		}
+		return Schedule{expr: expr}, nil
+	}
+
+	parts := strings.Fields(expr)
+	if len(parts) != len(fields) {
+		return Schedule{}, fmt.Errorf("invalid cron expression %q: expected 5 fields (minute hour day-of-month month day-of-week)", expr)
+	}
+	for i, p := range parts {
+		if err := fields[i].validate(p); err != nil {
+			return Schedule{}, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+		}
+	}
+	return Schedule{expr: strings.Join(parts, " "), fields: parts}, nil
+}
+
+// String returns the cron expression
+func (s Schedule) String() string {
+	return s.expr
+}
+
+// OnCalendar returns the systemd calendar event of the schedule. The day of
+// month and day of week can not be both restricted, cron runs when either
+// matches while systemd requires both.
+func (s Schedule) OnCalendar() (string, error) {
+	if m, ok := macros[s.expr]; ok {
+		return m, nil
+	}
+	if s.fields == nil {
+		return "", fmt.Errorf("empty cron schedule")
+	}
+
+	minute, hour, dom, month, dow := s.fields[0], s.fields[1], s.fields[2], s.fields[3], s.fields[4]
+	if dom != "*" && dow != "*" {
+		return "", fmt.Errorf("cron schedule %q restricts both the day of month and the day of week, which systemd timers do not support", s.expr)
+	}
+
+	var b strings.Builder
+	if dow != "*" {
+		d, err := fields[4].calendar(dow, true)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(d + " ")
+	}
+	var parts []string
+	for i, f := range []string{month, dom, hour, minute} {
+		c, err := fields[3-i].calendar(f, false)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, c)
+	}
+	fmt.Fprintf(&b, "*-%s-%s %s:%s:00", parts[0], parts[1], parts[2], parts[3])
+	return b.String(), nil
+}
+
+// value parses a number or a name of the field
+func (f field) value(s string) (int, error) {
+	for i, n := range f.names {
+		if n != "" && strings.EqualFold(s, n) {
+			return i, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid %s %q", f.name, s)
+	}
+	return v, nil
+}
+
+// validate checks a list of values, ranges and steps
+func (f field) validate(s string) error {
+	for _, item := range strings.Split(s, ",") {
+		rng, step, hasStep := strings.Cut(item, "/")
+		if hasStep {
+			if n, err := strconv.Atoi(step); err != nil || n <= 0 {
+				return fmt.Errorf("invalid %s step %q", f.name, step)
+			}
+		}
+		if rng == "*" {
+			continue
+		}
+		from, to, isRange := strings.Cut(rng, "-")
+		a, err := f.value(from)
+		if err != nil {
+			return err
+		}
+		if isRange {
+			b, err := f.value(to)
+			if err != nil {
+				return err
+			}
+			if b < a {
+				return fmt.Errorf("invalid %s range %q", f.name, rng)
+			}
+		}
+	}
+	return nil
+}
+
+// calendar converts a validated field to the systemd syntax
+func (f field) calendar(s string, weekday bool) (string, error) {
+	if s == "*" {
+		return "*", nil
+	}
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		rng, step, hasStep := strings.Cut(item, "/")
+		from, to, isRange := strings.Cut(rng, "-")
+		if hasStep && (weekday || isRange) {
+			return "", fmt.Errorf("cron %s %q: steps are only supported on \"*\" or a start value with systemd timers", f.name, item)
+		}
+
+		if rng == "*" {
+			from = strconv.Itoa(f.min)
+		}
+		a, err := f.value(from)
+		if err != nil {
+			return "", err
+		}
+		conv := f.format(a, weekday)
+		if isRange {
+			b, err := f.value(to)
+			if err != nil {
+				return "", err
+			}
+			conv += ".." + f.format(b, weekday)
+		}
+		if hasStep {
+			conv += "/" + step
+		}
+		items = append(items, conv)
+	}
+	return strings.Join(items, ","), nil
+}
+
+func (f field) format(v int, weekday bool) string {
+	if weekday {
+		return strings.ToUpper(f.names[v][:1]) + f.names[v][1:]
+	}
+	return fmt.Sprintf("%02d", v)
+}
@@ -0,0 +1,39 @@
+package cron
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOnCalendar(t *testing.T) {
+	for expr, expected := range map[string]string{
+		"0 2 * * *":        "*-*-* 02:00:00",
+		"*/15 * * * *":     "*-*-* *:00/15:00",
+		"30 1,13 * * *":    "*-*-* 01,13:30:00",
+		"0 3 * * 1-5":      "Mon..Fri *-*-* 03:00:00",
+		"0 3 * * sun":      "Sun *-*-* 03:00:00",
+		"0 0 1 */3 *":      "*-01/3-01 00:00:00",
+		"0 4 15 jan *":     "*-01-15 04:00:00",
+		"@daily":           "daily",
+		"  0  2  *  *  * ": "*-*-* 02:00:00",
+	} {
+		s, err := Parse(expr)
+		require.NoError(t, err, expr)
+		c, err := s.OnCalendar()
+		require.NoError(t, err, expr)
+		require.Equal(t, expected, c, expr)
+	}
+
+	for _, expr := range []string{"", "0 2 * *", "60 * * * *", "0 2 * * 8", "@sometimes", "0 2 5-1 * *", "*/0 * * * *"} {
+		_, err := Parse(expr)
+		require.Error(t, err, expr)
+	}
+
+	for _, expr := range []string{"0 2 1 * 1", "0 2 * * */2", "0 1-10/2 * * *"} {
+		s, err := Parse(expr)
+		require.NoError(t, err, expr)
+		_, err = s.OnCalendar()
+		require.Error(t, err, expr)
+	}
+}
@@ -0,0 +1,91 @@
+// Package ipmi contains clients for managing compute nodes through their BMC
+package ipmi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// PowerActions lists the power actions accepted by the backends
+var PowerActions = []string{"on", "off", "cycle", "status", "soft", "reset"}
+
+// Backend performs BMC operations on hosts
+type Backend interface {
+	// Power sends a power action to the host and returns the response message
+	Power(ctx context.Context, host, action string) (string, error)
+}
+
+// APIBackend talks to an ipmi-api server over HTTP(S)
+type APIBackend struct {
+	Address    string
+	Credential Credential
+	Client     *http.Client
+}
+
+// NewAPIBackend returns an APIBackend for the API at address
+func NewAPIBackend(address string, credential Credential, client *http.Client) *APIBackend {
+	return &APIBackend{
+		Address:    strings.TrimSuffix(address, "/"),
+		Credential: credential,
+		Client:     client,
+	}
+}
+
+// Power sends a power action to the host
+func (b *APIBackend) Power(ctx context.Context, host, action string) (string, error) {
+	body, err := b.post(ctx, host, action)
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+func (b *APIBackend) post(ctx context.Context, host string, endpoint ...string) ([]byte, error) {
+	postData, err := json.Marshal(b.Credential)
+	if err != nil {
+		return nil, err
+	}
+
+	segments := append([]string{"host", url.PathEscape(host)}, endpoint...)
+	requestPath := fmt.Sprintf("%s/%s", b.Address, strings.Join(segments, "/"))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, requestPath, bytes.NewReader(postData))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := b.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("ipmi response body couldn't be read: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &StatusError{Host: host, StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	return body, nil
+}
+
+// StatusError is returned when the API responds with a non-OK status code
+type StatusError struct {
+	Host       string
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s: ipmi API returned non-OK status code %d: %s", e.Host, e.StatusCode, strings.TrimSpace(e.Body))
+}
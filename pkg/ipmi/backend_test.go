@@ -0,0 +1,92 @@
+package ipmi
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIBackendTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var c Credential
+		if err := json.NewDecoder(r.Body).Decode(&c); err != nil || c.Username != "admin" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(r.URL.Path))
+	}))
+	defer srv.Close()
+
+	caPath := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caPath, caPEM, 0600))
+
+	credential := Credential{Username: "admin", Password: "secret"}
+
+	client, err := NewHTTPClient(TLSOptions{})
+	require.NoError(t, err)
+	_, err = NewAPIBackend(srv.URL, credential, client).Power(context.Background(), "cn1", "status")
+	require.Error(t, err, "untrusted server certificate must be rejected")
+
+	client, err = NewHTTPClient(TLSOptions{CACert: caPath})
+	require.NoError(t, err)
+	out, err := NewAPIBackend(srv.URL+"/", credential, client).Power(context.Background(), "cn1", "status")
+	require.NoError(t, err)
+	require.Equal(t, "/host/cn1/status", out)
+
+	client, err = NewHTTPClient(TLSOptions{Insecure: true})
+	require.NoError(t, err)
+	_, err = NewAPIBackend(srv.URL, Credential{Username: "nobody"}, client).Power(context.Background(), "cn1", "status")
+	var statusErr *StatusError
+	require.ErrorAs(t, err, &statusErr)
+	require.Equal(t, http.StatusUnauthorized, statusErr.StatusCode)
+
+	_, err = NewHTTPClient(TLSOptions{ClientCert: caPath})
+	require.Error(t, err, "a client certificate without a key must be rejected")
+}
+
+func TestAPIBackendReadout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/host/cn1/sensors":
+			_, _ = w.Write([]byte(`[{"name":"CPU1 Temp","type":"Temperature","reading":42.5,"unit":"degrees C","status":"ok"},{"name":"PSU2","type":"Power Supply","status":"cr"}]`))
+		case "/host/cn1/sel":
+			_, _ = w.Write([]byte(`[{"id":"1","timestamp":"2023-10-01T10:00:00Z","sensor":"PSU2","event":"Power Supply AC lost","asserted":true}]`))
+		case "/host/cn1/sel/clear":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	b := NewAPIBackend(srv.URL, Credential{}, srv.Client())
+
+	sensors, err := b.Sensors(context.Background(), "cn1")
+	require.NoError(t, err)
+	require.Len(t, sensors, 2)
+	require.Equal(t, 42.5, *sensors[0].Reading)
+	require.Nil(t, sensors[1].Reading)
+
+	entries, err := b.SEL(context.Background(), "cn1")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.True(t, entries[0].Asserted)
+	require.NoError(t, b.ClearSEL(context.Background(), "cn1"))
+
+	_, err = b.Inventory(context.Background(), "cn1")
+	require.Error(t, err)
+
+	var out strings.Builder
+	require.NoError(t, WriteSensorsTable(&out, []HostReport{{Host: "cn1", Sensors: sensors}}))
+	require.Contains(t, out.String(), "42.5 degrees C")
+	require.Contains(t, out.String(), "n/a")
+}
@@ -0,0 +1,106 @@
+package ipmi
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Credential holds the BMC credentials sent to the API
+type Credential struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// DefaultNetrcPath returns $NETRC or ~/.netrc
+func DefaultNetrcPath() string {
+	if p := os.Getenv("NETRC"); p != "" {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".netrc")
+}
+
+// LookupNetrc returns the credentials for machine from a netrc file. The
+// "default" entry is used when there is no entry for the machine. The boolean
+// is false when the file does not exist or holds no matching entry.
+func LookupNetrc(path, machine string) (Credential, bool, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return Credential{}, false, nil
+		}
+		return Credential{}, false, fmt.Errorf("read netrc: %w", err)
+	}
+
+	return parseNetrc(string(content), machine)
+}
+
+func parseNetrc(content, machine string) (Credential, bool, error) {
+	var (
+		found, fallback       Credential
+		hasFound, hasFallback bool
+		current               *Credential
+	)
+
+	lines := strings.Split(content, "\n")
+	for i := 0; i < len(lines); i++ {
+		fields := strings.Fields(lines[i])
+		for j := 0; j < len(fields); j++ {
+			switch fields[j] {
+			case "machine":
+				if j+1 >= len(fields) {
+					return Credential{}, false, fmt.Errorf("netrc line %d: machine without a name", i+1)
+				}
+				j++
+				current = nil
+				if fields[j] == machine && !hasFound {
+					hasFound = true
+					current = &found
+				}
+			case "default":
+				current = nil
+				if !hasFallback {
+					hasFallback = true
+					current = &fallback
+				}
+			case "login", "password", "account":
+				if j+1 >= len(fields) {
+					return Credential{}, false, fmt.Errorf("netrc line %d: %s without a value", i+1, fields[j])
+				}
+				if current != nil {
+					switch fields[j] {
+					case "login":
+						current.Username = fields[j+1]
+					case "password":
+						current.Password = fields[j+1]
+					}
+				}
+				j++
+			case "macdef":
+				// macro definitions run until the next empty line
+				for i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != "" {
+					i++
+				}
+				j = len(fields)
+			default:
+				if strings.HasPrefix(fields[j], "#") {
+					j = len(fields)
+				}
+			}
+		}
+	}
+
+	if hasFound {
+		return found, true, nil
+	}
+	if hasFallback {
+		return fallback, true, nil
+	}
+	return Credential{}, false, nil
+}
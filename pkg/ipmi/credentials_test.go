@@ -0,0 +1,42 @@
+package ipmi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNetrc(t *testing.T) {
+	content := `# ipmi credentials
+machine ipmi.internal login admin password s3cret
+machine other.internal
+  login other
+  password other
+
+macdef init
+machine ipmi.internal login macro password macro
+
+default login fallback password fallback
+`
+	c, ok, err := parseNetrc(content, "ipmi.internal")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, Credential{Username: "admin", Password: "s3cret"}, c)
+
+	c, ok, err = parseNetrc(content, "other.internal")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, Credential{Username: "other", Password: "other"}, c)
+
+	c, ok, err = parseNetrc(content, "unknown.internal")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, Credential{Username: "fallback", Password: "fallback"}, c)
+
+	_, ok, err = parseNetrc("machine a login b password c", "d")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	_, _, err = parseNetrc("machine a login", "a")
+	require.Error(t, err)
+}
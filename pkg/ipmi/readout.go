@@ -0,0 +1,105 @@
+package ipmi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Sensor is a BMC sensor reading
+type Sensor struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	Reading *float64 `json:"reading,omitempty"`
+	Unit    string   `json:"unit,omitempty"`
+	Status  string   `json:"status"`
+}
+
+// Component is a field replaceable unit of the host such as a board, a PSU or a disk
+type Component struct {
+	Name         string `json:"name"`
+	Manufacturer string `json:"manufacturer,omitempty"`
+	Model        string `json:"model,omitempty"`
+	SerialNumber string `json:"serialNumber,omitempty"`
+	Firmware     string `json:"firmware,omitempty"`
+}
+
+// Inventory describes the hardware and firmware of a host
+type Inventory struct {
+	Manufacturer string      `json:"manufacturer,omitempty"`
+	Model        string      `json:"model,omitempty"`
+	SerialNumber string      `json:"serialNumber,omitempty"`
+	BIOSVersion  string      `json:"biosVersion,omitempty"`
+	BMCFirmware  string      `json:"bmcFirmware,omitempty"`
+	Components   []Component `json:"components,omitempty"`
+}
+
+// SELEntry is an entry of the BMC system event log
+type SELEntry struct {
+	ID        string    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	Sensor    string    `json:"sensor"`
+	Event     string    `json:"event"`
+	Severity  string    `json:"severity,omitempty"`
+	Asserted  bool      `json:"asserted"`
+}
+
+// ReadoutBackend is a Backend that can also read the sensors, inventory and event log of hosts
+type ReadoutBackend interface {
+	Backend
+	// Sensors returns the sensor readings of the host
+	Sensors(ctx context.Context, host string) ([]Sensor, error)
+	// Inventory returns the hardware inventory of the host
+	Inventory(ctx context.Context, host string) (*Inventory, error)
+	// SEL returns the system event log entries of the host
+	SEL(ctx context.Context, host string) ([]SELEntry, error)
+	// ClearSEL clears the system event log of the host
+	ClearSEL(ctx context.Context, host string) error
+}
+
+var _ ReadoutBackend = &APIBackend{}
+
+// Sensors returns the sensor readings of the host
+func (b *APIBackend) Sensors(ctx context.Context, host string) ([]Sensor, error) {
+	var sensors []Sensor
+	if err := b.postJSON(ctx, host, &sensors, "sensors"); err != nil {
+		return nil, err
+	}
+	return sensors, nil
+}
+
+// Inventory returns the hardware inventory of the host
+func (b *APIBackend) Inventory(ctx context.Context, host string) (*Inventory, error) {
+	inventory := &Inventory{}
+	if err := b.postJSON(ctx, host, inventory, "inventory"); err != nil {
+		return nil, err
+	}
+	return inventory, nil
+}
+
+// SEL returns the system event log entries of the host
+func (b *APIBackend) SEL(ctx context.Context, host string) ([]SELEntry, error) {
+	var entries []SELEntry
+	if err := b.postJSON(ctx, host, &entries, "sel"); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// ClearSEL clears the system event log of the host
+func (b *APIBackend) ClearSEL(ctx context.Context, host string) error {
+	_, err := b.post(ctx, host, "sel", "clear")
+	return err
+}
+
+func (b *APIBackend) postJSON(ctx context.Context, host string, o interface{}, endpoint ...string) error {
+	body, err := b.post(ctx, host, endpoint...)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, o); err != nil {
+		return fmt.Errorf("%s: failed to decode ipmi API response: %w", host, err)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package ipmi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// HostReport holds the readout of a single host
+type HostReport struct {
+	Host      string     `json:"host"`
+	Sensors   []Sensor   `json:"sensors,omitempty"`
+	Inventory *Inventory `json:"inventory,omitempty"`
+	SEL       []SELEntry `json:"sel,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// WriteJSON writes the reports as an indented JSON array
+func WriteJSON(w io.Writer, reports []HostReport) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(reports)
+}
+
+// WriteSensorsTable writes the sensor readings of the reports as a table
+func WriteSensorsTable(w io.Writer, reports []HostReport) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "HOST\tSENSOR\tTYPE\tREADING\tSTATUS")
+	for _, r := range reports {
+		for _, s := range r.Sensors {
+			reading := "n/a"
+			if s.Reading != nil {
+				reading = strconv.FormatFloat(*s.Reading, 'f', -1, 64)
+				if s.Unit != "" {
+					reading += " " + s.Unit
+				}
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", r.Host, s.Name, s.Type, reading, s.Status)
+		}
+	}
+	return tw.Flush()
+}
+
+// WriteInventoryTable writes the inventories of the reports as a table
+func WriteInventoryTable(w io.Writer, reports []HostReport) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "HOST\tCOMPONENT\tMANUFACTURER\tMODEL\tSERIAL\tFIRMWARE")
+	for _, r := range reports {
+		if r.Inventory == nil {
+			continue
+		}
+		i := r.Inventory
+		var bios string
+		if i.BIOSVersion != "" {
+			bios = "BIOS " + i.BIOSVersion
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Host, "system", i.Manufacturer, i.Model, i.SerialNumber, bios)
+		if i.BMCFirmware != "" {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Host, "bmc", "", "", "", i.BMCFirmware)
+		}
+		for _, c := range i.Components {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Host, c.Name, c.Manufacturer, c.Model, c.SerialNumber, c.Firmware)
+		}
+	}
+	return tw.Flush()
+}
+
+// WriteSELTable writes the system event log entries of the reports as a table
+func WriteSELTable(w io.Writer, reports []HostReport) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "HOST\tID\tTIME\tSENSOR\tEVENT\tSEVERITY\tSTATE")
+	for _, r := range reports {
+		for _, e := range r.SEL {
+			state := "deasserted"
+			if e.Asserted {
+				state = "asserted"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.Host, e.ID, e.Timestamp.Format(time.RFC3339), e.Sensor, e.Event, e.Severity, state)
+		}
+	}
+	return tw.Flush()
+}
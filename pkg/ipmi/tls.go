@@ -0,0 +1,74 @@
+package ipmi
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+const timeOut = time.Second * 30
+
+// TLSOptions describes how the client authenticates the API server and itself
+type TLSOptions struct {
+	// CACert is the path to a PEM bundle used to verify the API server certificate
+	CACert string
+	// ClientCert is the path to a PEM client certificate for mutual TLS
+	ClientCert string
+	// ClientKey is the path to the PEM private key of ClientCert
+	ClientKey string
+	// Insecure disables the verification of the API server certificate
+	Insecure bool
+}
+
+// TLSConfig builds a tls.Config from the options
+func (o TLSOptions) TLSConfig() (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if o.Insecure {
+		cfg.InsecureSkipVerify = true
+	}
+
+	if o.CACert != "" {
+		pem, err := os.ReadFile(o.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("read ca certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", o.CACert)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if o.ClientCert != "" || o.ClientKey != "" {
+		if o.ClientCert == "" || o.ClientKey == "" {
+			return nil, fmt.Errorf("both a client certificate and a client key are required for mutual TLS")
+		}
+		cert, err := tls.LoadX509KeyPair(o.ClientCert, o.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+// NewHTTPClient returns a http client configured with the TLS options
+func NewHTTPClient(o TLSOptions) (*http.Client, error) {
+	cfg, err := o.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = cfg
+
+	return &http.Client{
+		Timeout:   timeOut,
+		Transport: transport,
+	}, nil
+}
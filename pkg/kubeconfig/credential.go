@@ -0,0 +1,89 @@
+package kubeconfig
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ExecCredentialAPIVersion is the version of the exec credential plugin API
+const ExecCredentialAPIVersion = "client.authentication.k8s.io/v1"
+
+// ExecCredential is what an exec credential plugin prints for kubectl
+type ExecCredential struct {
+	APIVersion string                `json:"apiVersion"`
+	Kind       string                `json:"kind"`
+	Status     *ExecCredentialStatus `json:"status"`
+}
+
+// ExecCredentialStatus holds a client certificate and its expiry
+type ExecCredentialStatus struct {
+	ExpirationTimestamp   time.Time `json:"expirationTimestamp"`
+	ClientCertificateData string    `json:"clientCertificateData"`
+	ClientKeyData         string    `json:"clientKeyData"`
+}
+
+// NewExecCredential returns the credential of a PEM encoded client
+// certificate and key, expiring with the certificate
+func NewExecCredential(certPEM, keyPEM []byte) (*ExecCredential, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("invalid client certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid client certificate: %w", err)
+	}
+	return &ExecCredential{
+		APIVersion: ExecCredentialAPIVersion,
+		Kind:       "ExecCredential",
+		Status: &ExecCredentialStatus{
+			ExpirationTimestamp:   cert.NotAfter.UTC(),
+			ClientCertificateData: string(certPEM),
+			ClientKeyData:         string(keyPEM),
+		},
+	}, nil
+}
+
+// ReadExecCredential reads a credential saved with Save
+func ReadExecCredential(path string) (*ExecCredential, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &ExecCredential{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("invalid credential %s: %w", path, err)
+	}
+	if c.Status == nil {
+		return nil, fmt.Errorf("invalid credential %s: no status", path)
+	}
+	return c, nil
+}
+
+// ValidFor returns true when the credential does not expire within d
+func (c *ExecCredential) ValidFor(d time.Duration) bool {
+	return c.Status != nil && time.Until(c.Status.ExpirationTimestamp) > d
+}
+
+// Marshal returns the JSON encoding of the credential
+func (c *ExecCredential) Marshal() ([]byte, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// Save writes the credential to a file readable only by the current user
+func (c *ExecCredential) Save(path string) error {
+	data, err := c.Marshal()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
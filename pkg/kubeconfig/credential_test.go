@@ -0,0 +1,68 @@
+package kubeconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testCertificate(t *testing.T, notAfter time.Time) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "alice"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestNewExecCredential(t *testing.T) {
+	notAfter := time.Now().Add(time.Hour).Truncate(time.Second)
+	c, err := NewExecCredential(testCertificate(t, notAfter), []byte("key"))
+	require.NoError(t, err)
+	require.Equal(t, ExecCredentialAPIVersion, c.APIVersion)
+	require.Equal(t, "ExecCredential", c.Kind)
+	require.True(t, notAfter.Equal(c.Status.ExpirationTimestamp))
+	require.Equal(t, "key", c.Status.ClientKeyData)
+
+	require.True(t, c.ValidFor(5*time.Minute))
+	require.False(t, c.ValidFor(2*time.Hour))
+
+	_, err = NewExecCredential([]byte("cert"), []byte("key"))
+	require.ErrorContains(t, err, "invalid client certificate")
+}
+
+func TestExecCredentialSave(t *testing.T) {
+	c, err := NewExecCredential(testCertificate(t, time.Now().Add(time.Hour)), []byte("key"))
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "credential.json")
+	require.NoError(t, c.Save(path))
+	st, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), st.Mode().Perm())
+
+	read, err := ReadExecCredential(path)
+	require.NoError(t, err)
+	require.Equal(t, c.Status.ClientCertificateData, read.Status.ClientCertificateData)
+	require.True(t, c.Status.ExpirationTimestamp.Equal(read.Status.ExpirationTimestamp))
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"kind":"ExecCredential"}`), 0o600))
+	_, err = ReadExecCredential(path)
+	require.ErrorContains(t, err, "no status")
+}
@@ -0,0 +1,107 @@
+// Package kubeconfig builds the kubeconfigs of the users of the clusters and
+// merges them into the kubeconfig of the local user
+package kubeconfig
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// DefaultPath returns the first path of $KUBECONFIG or ~/.kube/config
+func DefaultPath() string {
+	for _, p := range filepath.SplitList(os.Getenv(clientcmd.RecommendedConfigPathEnvVar)) {
+		if p != "" {
+			return p
+		}
+	}
+	return clientcmd.RecommendedHomeFile
+}
+
+// load reads a kubeconfig file, an empty config when it does not exist
+func load(path string) (*clientcmdapi.Config, error) {
+	cfg, err := clientcmd.LoadFromFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return clientcmdapi.NewConfig(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load kubeconfig %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Merge inserts the current context of the kubeconfig data into the
+// kubeconfig file at path, replacing the cluster, user and context named
+// name. The file is created when it does not exist.
+func Merge(path string, data []byte, name string, setCurrent bool) error {
+	src, err := clientcmd.Load(data)
+	if err != nil {
+		return fmt.Errorf("load cluster kubeconfig: %w", err)
+	}
+	srcContext, ok := src.Contexts[src.CurrentContext]
+	if !ok {
+		return fmt.Errorf("the cluster kubeconfig has no current context")
+	}
+	cluster, ok := src.Clusters[srcContext.Cluster]
+	if !ok {
+		return fmt.Errorf("the cluster kubeconfig has no cluster %q", srcContext.Cluster)
+	}
+	user, ok := src.AuthInfos[srcContext.AuthInfo]
+	if !ok {
+		return fmt.Errorf("the cluster kubeconfig has no user %q", srcContext.AuthInfo)
+	}
+
+	cfg, err := load(path)
+	if err != nil {
+		return err
+	}
+
+	cfg.Clusters[name] = cluster
+	cfg.AuthInfos[name] = user
+	context := clientcmdapi.NewContext()
+	context.Cluster = name
+	context.AuthInfo = name
+	context.Namespace = srcContext.Namespace
+	cfg.Contexts[name] = context
+	if setCurrent || cfg.CurrentContext == "" {
+		cfg.CurrentContext = name
+	}
+
+	return clientcmd.WriteToFile(*cfg, path)
+}
+
+// Remove deletes the context name from the kubeconfig file at path along with
+// its cluster and user when no other context uses them. It returns false when
+// there is no such context.
+func Remove(path, name string) (bool, error) {
+	cfg, err := load(path)
+	if err != nil {
+		return false, err
+	}
+	context, ok := cfg.Contexts[name]
+	if !ok {
+		return false, nil
+	}
+	delete(cfg.Contexts, name)
+
+	clusterUsed, userUsed := false, false
+	for _, c := range cfg.Contexts {
+		clusterUsed = clusterUsed || c.Cluster == context.Cluster
+		userUsed = userUsed || c.AuthInfo == context.AuthInfo
+	}
+	if !clusterUsed {
+		delete(cfg.Clusters, context.Cluster)
+	}
+	if !userUsed {
+		delete(cfg.AuthInfos, context.AuthInfo)
+	}
+	if cfg.CurrentContext == name {
+		cfg.CurrentContext = ""
+	}
+
+	return true, clientcmd.WriteToFile(*cfg, path)
+}
@@ -0,0 +1,97 @@
+package kubeconfig
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const clusterKubeconfig = `apiVersion: v1
+clusters:
+- cluster:
+    server: https://10.0.0.1:6443
+  name: k0s
+contexts:
+- context:
+    cluster: k0s
+    user: admin
+  name: k0s
+current-context: k0s
+kind: Config
+users:
+- name: admin
+  user:
+    token: secret
+`
+
+const userKubeconfig = `apiVersion: v1
+clusters:
+- cluster:
+    server: https://other:6443
+  name: other
+contexts:
+- context:
+    cluster: other
+    user: other
+  name: other
+current-context: other
+kind: Config
+users:
+- name: other
+  user:
+    token: other
+`
+
+func TestDefaultPath(t *testing.T) {
+	t.Setenv("KUBECONFIG", "/tmp/a"+string(filepath.ListSeparator)+"/tmp/b")
+	require.Equal(t, "/tmp/a", DefaultPath())
+	t.Setenv("KUBECONFIG", "")
+	require.Equal(t, clientcmd.RecommendedHomeFile, DefaultPath())
+}
+
+func TestMergeAndRemove(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".kube", "config")
+
+	// a missing file is created and gets the current context
+	require.NoError(t, Merge(path, []byte(clusterKubeconfig), "prod", false))
+	cfg, err := clientcmd.LoadFromFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "prod", cfg.CurrentContext)
+	require.Equal(t, "https://10.0.0.1:6443", cfg.Clusters["prod"].Server)
+	require.Equal(t, "secret", cfg.AuthInfos["prod"].Token)
+	require.Equal(t, "prod", cfg.Contexts["prod"].AuthInfo)
+
+	// existing entries are kept and the context is replaced
+	other, err := clientcmd.Load([]byte(userKubeconfig))
+	require.NoError(t, err)
+	require.NoError(t, clientcmd.WriteToFile(*other, path))
+	require.NoError(t, Merge(path, []byte(clusterKubeconfig), "prod", false))
+	require.NoError(t, Merge(path, []byte(clusterKubeconfig), "prod", false))
+	cfg, err = clientcmd.LoadFromFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "other", cfg.CurrentContext)
+	require.Len(t, cfg.Contexts, 2)
+	require.Len(t, cfg.Clusters, 2)
+
+	require.NoError(t, Merge(path, []byte(clusterKubeconfig), "prod", true))
+	cfg, err = clientcmd.LoadFromFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "prod", cfg.CurrentContext)
+
+	found, err := Remove(path, "prod")
+	require.NoError(t, err)
+	require.True(t, found)
+	cfg, err = clientcmd.LoadFromFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "", cfg.CurrentContext)
+	require.NotContains(t, cfg.Contexts, "prod")
+	require.NotContains(t, cfg.Clusters, "prod")
+	require.NotContains(t, cfg.AuthInfos, "prod")
+	require.Contains(t, cfg.Contexts, "other")
+
+	found, err = Remove(path, "prod")
+	require.NoError(t, err)
+	require.False(t, found)
+}
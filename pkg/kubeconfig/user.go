@@ -0,0 +1,184 @@
+package kubeconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// MinExpiry is the shortest validity kubernetes accepts for a signed certificate
+const MinExpiry = 10 * time.Minute
+
+// UserSigner is the kubernetes signer of the client certificates of the users
+const UserSigner = "kubernetes.io/kube-apiserver-client"
+
+// MastersGroup is the group of the cluster admins, the CertificateSubjectRestriction
+// admission plugin refuses to sign it with UserSigner
+const MastersGroup = "system:masters"
+
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+// ObjectName turns s into a valid kubernetes object name
+func ObjectName(s string) string {
+	name := invalidNameChars.ReplaceAllString(strings.ToLower(s), "-")
+	name = strings.Trim(name, ".-")
+	if len(name) > 253 {
+		name = name[:253]
+	}
+	return name
+}
+
+// ValidateGroups checks that the cluster signs a certificate for the groups
+func ValidateGroups(groups []string) error {
+	for _, g := range groups {
+		if g == MastersGroup {
+			return fmt.Errorf("the cluster does not sign certificates for the %s group, bind a cluster role such as cluster-admin to another group instead", MastersGroup)
+		}
+	}
+	return nil
+}
+
+// UserCertificateRequest generates a private key and a certificate signing
+// request for a user belonging to groups, both PEM encoded
+func UserCertificateRequest(user string, groups []string) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("generate key: %w", err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("encode key: %w", err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+
+	template := &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: user, Organization: groups},
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create certificate request: %w", err)
+	}
+	csrPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})
+
+	return keyPEM, csrPEM, nil
+}
+
+// CSRManifest returns a CertificateSigningRequest for a client certificate
+// valid for expiry
+func CSRManifest(name string, csrPEM []byte, expiry time.Duration) (string, error) {
+	if expiry < MinExpiry {
+		return "", fmt.Errorf("the expiry can not be shorter than %s", MinExpiry)
+	}
+	return manifest(map[string]interface{}{
+		"apiVersion": "certificates.k8s.io/v1",
+		"kind":       "CertificateSigningRequest",
+		"metadata": map[string]interface{}{
+			"name":   name,
+			"labels": map[string]string{"app.kubernetes.io/managed-by": "cfctl"},
+		},
+		"spec": map[string]interface{}{
+			"request":           csrPEM,
+			"signerName":        UserSigner,
+			"expirationSeconds": int64(expiry.Seconds()),
+			"usages":            []string{"client auth"},
+		},
+	})
+}
+
+// RoleBindingManifest returns a RoleBinding of the cluster role to the user in
+// the namespace, or a ClusterRoleBinding when the namespace is empty
+func RoleBindingManifest(namespace, role, user string) (string, error) {
+	meta := map[string]interface{}{
+		"name":   ObjectName("cfctl:" + user + ":" + role),
+		"labels": map[string]string{"app.kubernetes.io/managed-by": "cfctl"},
+	}
+	kind := "ClusterRoleBinding"
+	if namespace != "" {
+		kind = "RoleBinding"
+		meta["namespace"] = namespace
+	}
+	return manifest(map[string]interface{}{
+		"apiVersion": "rbac.authorization.k8s.io/v1",
+		"kind":       kind,
+		"metadata":   meta,
+		"roleRef": map[string]string{
+			"apiGroup": "rbac.authorization.k8s.io",
+			"kind":     "ClusterRole",
+			"name":     role,
+		},
+		"subjects": []map[string]string{
+			{"apiGroup": "rbac.authorization.k8s.io", "kind": "User", "name": user},
+		},
+	})
+}
+
+// manifest encodes an object as JSON, which kubectl reads as YAML
+func manifest(obj map[string]interface{}) (string, error) {
+	data, err := json.MarshalIndent(obj, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// UserConfig returns a kubeconfig for a user authenticating with a client
+// certificate, for the cluster of the current context of the admin kubeconfig
+func UserConfig(admin []byte, user, contextName string, certPEM, keyPEM []byte) ([]byte, error) {
+	authInfo := clientcmdapi.NewAuthInfo()
+	authInfo.ClientCertificateData = certPEM
+	authInfo.ClientKeyData = keyPEM
+	return withAuthInfo(admin, user, contextName, authInfo)
+}
+
+// ExecConfig returns a kubeconfig for a user getting its credentials from the
+// exec credential plugin command, for the cluster of the current context of
+// the admin kubeconfig
+func ExecConfig(admin []byte, user, contextName, command string, args []string) ([]byte, error) {
+	authInfo := clientcmdapi.NewAuthInfo()
+	authInfo.Exec = &clientcmdapi.ExecConfig{
+		APIVersion:      ExecCredentialAPIVersion,
+		Command:         command,
+		Args:            args,
+		InteractiveMode: clientcmdapi.IfAvailableExecInteractiveMode,
+	}
+	return withAuthInfo(admin, user, contextName, authInfo)
+}
+
+// withAuthInfo returns a kubeconfig for the cluster of the current context of
+// the admin kubeconfig with the user authInfo
+func withAuthInfo(admin []byte, user, contextName string, authInfo *clientcmdapi.AuthInfo) ([]byte, error) {
+	src, err := clientcmd.Load(admin)
+	if err != nil {
+		return nil, fmt.Errorf("load admin kubeconfig: %w", err)
+	}
+	srcContext, ok := src.Contexts[src.CurrentContext]
+	if !ok {
+		return nil, fmt.Errorf("the admin kubeconfig has no current context")
+	}
+	cluster, ok := src.Clusters[srcContext.Cluster]
+	if !ok {
+		return nil, fmt.Errorf("the admin kubeconfig has no cluster %q", srcContext.Cluster)
+	}
+
+	cfg := clientcmdapi.NewConfig()
+	cfg.Clusters[srcContext.Cluster] = cluster
+	cfg.AuthInfos[user] = authInfo
+	context := clientcmdapi.NewContext()
+	context.Cluster = srcContext.Cluster
+	context.AuthInfo = user
+	cfg.Contexts[contextName] = context
+	cfg.CurrentContext = contextName
+
+	return clientcmd.Write(*cfg)
+}
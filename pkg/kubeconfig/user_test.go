@@ -0,0 +1,113 @@
+package kubeconfig
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+func TestObjectName(t *testing.T) {
+	require.Equal(t, "cfctl-alice-1", ObjectName("cfctl-Alice-1"))
+	require.Equal(t, "cfctl-alice-example.com-view", ObjectName("cfctl:alice@example.com:view"))
+}
+
+func TestUserCertificateRequest(t *testing.T) {
+	keyPEM, csrPEM, err := UserCertificateRequest("alice", []string{"dev", "ops"})
+	require.NoError(t, err)
+
+	block, _ := pem.Decode(keyPEM)
+	require.Equal(t, "EC PRIVATE KEY", block.Type)
+	_, err = x509.ParseECPrivateKey(block.Bytes)
+	require.NoError(t, err)
+
+	block, _ = pem.Decode(csrPEM)
+	require.Equal(t, "CERTIFICATE REQUEST", block.Type)
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	require.NoError(t, err)
+	require.NoError(t, csr.CheckSignature())
+	require.Equal(t, "alice", csr.Subject.CommonName)
+	require.Equal(t, []string{"dev", "ops"}, csr.Subject.Organization)
+}
+
+func TestValidateGroups(t *testing.T) {
+	require.NoError(t, ValidateGroups(nil))
+	require.NoError(t, ValidateGroups([]string{"dev", "ops"}))
+	require.ErrorContains(t, ValidateGroups([]string{"dev", "system:masters"}), "system:masters")
+}
+
+func TestCSRManifest(t *testing.T) {
+	_, err := CSRManifest("csr", []byte("request"), time.Minute)
+	require.ErrorContains(t, err, "can not be shorter")
+
+	m, err := CSRManifest("csr", []byte("request"), 24*time.Hour)
+	require.NoError(t, err)
+	var obj struct {
+		Kind string
+		Spec struct {
+			Request           []byte
+			SignerName        string
+			ExpirationSeconds int64
+			Usages            []string
+		}
+	}
+	require.NoError(t, json.Unmarshal([]byte(m), &obj))
+	require.Equal(t, "CertificateSigningRequest", obj.Kind)
+	require.Equal(t, []byte("request"), obj.Spec.Request)
+	require.Equal(t, UserSigner, obj.Spec.SignerName)
+	require.Equal(t, int64(86400), obj.Spec.ExpirationSeconds)
+	require.Equal(t, []string{"client auth"}, obj.Spec.Usages)
+}
+
+func TestRoleBindingManifest(t *testing.T) {
+	var obj struct {
+		Kind     string
+		Metadata struct{ Name, Namespace string }
+		RoleRef  struct{ Kind, Name string }
+		Subjects []struct{ Kind, Name string }
+	}
+
+	m, err := RoleBindingManifest("dev", "edit", "alice")
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal([]byte(m), &obj))
+	require.Equal(t, "RoleBinding", obj.Kind)
+	require.Equal(t, "dev", obj.Metadata.Namespace)
+	require.Equal(t, "cfctl-alice-edit", obj.Metadata.Name)
+	require.Equal(t, "edit", obj.RoleRef.Name)
+	require.Equal(t, "alice", obj.Subjects[0].Name)
+
+	m, err = RoleBindingManifest("", "view", "alice")
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal([]byte(m), &obj))
+	require.Equal(t, "ClusterRoleBinding", obj.Kind)
+}
+
+func TestUserConfig(t *testing.T) {
+	data, err := UserConfig([]byte(clusterKubeconfig), "alice", "alice@k0s", []byte("cert"), []byte("key"))
+	require.NoError(t, err)
+	cfg, err := clientcmd.Load(data)
+	require.NoError(t, err)
+	require.Equal(t, "alice@k0s", cfg.CurrentContext)
+	require.Equal(t, "https://10.0.0.1:6443", cfg.Clusters[cfg.Contexts["alice@k0s"].Cluster].Server)
+	require.Equal(t, []byte("cert"), cfg.AuthInfos["alice"].ClientCertificateData)
+	require.Equal(t, []byte("key"), cfg.AuthInfos["alice"].ClientKeyData)
+	require.NotContains(t, cfg.AuthInfos, "admin")
+}
+
+func TestExecConfig(t *testing.T) {
+	data, err := ExecConfig([]byte(clusterKubeconfig), "alice", "alice@k0s", "/usr/bin/cfctl", []string{"credential", "--user", "alice"})
+	require.NoError(t, err)
+	cfg, err := clientcmd.Load(data)
+	require.NoError(t, err)
+	require.Equal(t, "alice@k0s", cfg.CurrentContext)
+	exec := cfg.AuthInfos["alice"].Exec
+	require.NotNil(t, exec)
+	require.Equal(t, ExecCredentialAPIVersion, exec.APIVersion)
+	require.Equal(t, "/usr/bin/cfctl", exec.Command)
+	require.Equal(t, []string{"credential", "--user", "alice"}, exec.Args)
+	require.Empty(t, cfg.AuthInfos["alice"].ClientKeyData)
+}
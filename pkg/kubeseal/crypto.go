@@ -0,0 +1,88 @@
+// Package kubeseal implements the Sealed Secrets encryption so that secrets
+// can be sealed without the kubeseal binary.
+package kubeseal
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// sessionKeyBytes is the size of the AES-256 session key
+const sessionKeyBytes = 32
+
+// ErrTooShort is returned when the ciphertext is too short to be valid
+var ErrTooShort = errors.New("sealed value too short")
+
+// HybridEncrypt encrypts the plaintext with a random AES-GCM session key which
+// itself is encrypted with RSA-OAEP using the label. The output layout is the
+// same as the one of the sealed secrets controller:
+//
+//	uint16 length of the RSA ciphertext | RSA ciphertext | AES-GCM ciphertext
+func HybridEncrypt(rnd io.Reader, pubKey *rsa.PublicKey, plaintext, label []byte) ([]byte, error) {
+	sessionKey := make([]byte, sessionKeyBytes)
+	if _, err := io.ReadFull(rnd, sessionKey); err != nil {
+		return nil, fmt.Errorf("generate session key: %w", err)
+	}
+
+	block, err := aes.NewCipher(sessionKey)
+	if err != nil {
+		return nil, err
+	}
+	aed, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	rsaCiphertext, err := rsa.EncryptOAEP(sha256.New(), rnd, pubKey, sessionKey, label)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt session key: %w", err)
+	}
+
+	ciphertext := make([]byte, 2, 2+len(rsaCiphertext)+len(plaintext)+aed.Overhead())
+	binary.BigEndian.PutUint16(ciphertext, uint16(len(rsaCiphertext)))
+	ciphertext = append(ciphertext, rsaCiphertext...)
+
+	// the session key is used only once, a zero nonce is fine
+	zeroNonce := make([]byte, aed.NonceSize())
+
+	return aed.Seal(ciphertext, zeroNonce, plaintext, nil), nil
+}
+
+// HybridDecrypt reverses HybridEncrypt
+func HybridDecrypt(privKey *rsa.PrivateKey, ciphertext, label []byte) ([]byte, error) {
+	if len(ciphertext) < 2 {
+		return nil, ErrTooShort
+	}
+	rsaLen := int(binary.BigEndian.Uint16(ciphertext))
+	if len(ciphertext) < rsaLen+2 {
+		return nil, ErrTooShort
+	}
+
+	rsaCiphertext := ciphertext[2 : rsaLen+2]
+	aesCiphertext := ciphertext[rsaLen+2:]
+
+	sessionKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privKey, rsaCiphertext, label)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt session key: %w", err)
+	}
+
+	block, err := aes.NewCipher(sessionKey)
+	if err != nil {
+		return nil, err
+	}
+	aed, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	zeroNonce := make([]byte, aed.NonceSize())
+
+	return aed.Open(nil, zeroNonce, aesCiphertext, nil)
+}
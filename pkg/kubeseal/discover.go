@@ -0,0 +1,275 @@
+package kubeseal
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"gopkg.in/yaml.v2"
+)
+
+// DirConfigFile is the name of the per-directory configuration file. The
+// nearest file in the directory of a secret or its parents up to the root
+// applies.
+const DirConfigFile = ".kubeseal.yaml"
+
+// DefaultInclude matches the secret files sealed by default
+var DefaultInclude = []string{"**/*-secret.yaml.local", "**/*-secret.yml.local"}
+
+var secretFileRegex = regexp.MustCompile(`^(.*)-secret\.(yml|yaml)\.local$`)
+
+var sealedSecretFileRegex = regexp.MustCompile(`^(.*)-sealed-secret\.(yml|yaml)$`)
+
+// DirConfig is the content of a .kubeseal.yaml file
+type DirConfig struct {
+	// Scope of the secrets of the directory (strict, namespace-wide, cluster-wide)
+	Scope string `yaml:"scope,omitempty"`
+	// Namespace of the secrets of the directory that do not define one
+	Namespace string `yaml:"namespace,omitempty"`
+}
+
+// SecretFile is a plaintext secret file to seal
+type SecretFile struct {
+	// Source is the path of the plaintext secret file
+	Source string
+	// Sealed is the path of the sealed secret file
+	Sealed string
+	// Config is the directory configuration applying to the file
+	Config DirConfig
+}
+
+// Discovery finds the secret files to seal
+type Discovery struct {
+	// Roots are the directories to walk, defaults to the current directory
+	Roots []string
+	// Include are the doublestar patterns of the files to seal, matched against
+	// the slash separated path relative to the root. Defaults to DefaultInclude.
+	Include []string
+	// Exclude are the doublestar patterns of the files and directories to skip
+	Exclude []string
+
+	configs map[string]*DirConfig
+}
+
+// SealedPath returns the path of the sealed file of a secret file:
+// "foo-secret.yaml.local" is sealed into "foo-sealed-secret.yaml" and other
+// files such as "foo.yaml.local" or "foo.yaml" into "foo.sealed.yaml".
+func SealedPath(source string) string {
+	if res := secretFileRegex.FindStringSubmatch(source); len(res) == 3 {
+		return fmt.Sprintf("%s-sealed-secret.%s", res[1], res[2])
+	}
+	p := strings.TrimSuffix(source, ".local")
+	ext := filepath.Ext(p)
+	return strings.TrimSuffix(p, ext) + ".sealed" + ext
+}
+
+// IsSealedPath returns true when the file is named like the files SealedPath
+// returns, such as "foo-sealed-secret.yaml" or "foo.sealed.yaml"
+func IsSealedPath(path string) bool {
+	return len(SourcePaths(path)) > 0
+}
+
+// SourcePaths returns the paths of the secret files SealedPath seals into the
+// sealed file, in order of preference, nil when the file is not named like a
+// sealed file
+func SourcePaths(sealed string) []string {
+	if res := sealedSecretFileRegex.FindStringSubmatch(sealed); len(res) == 3 {
+		return []string{fmt.Sprintf("%s-secret.%s.local", res[1], res[2])}
+	}
+	ext := filepath.Ext(sealed)
+	base := strings.TrimSuffix(sealed, ext)
+	if ext == "" || ext == ".local" || !strings.HasSuffix(base, ".sealed") || filepath.Base(base) == ".sealed" {
+		return nil
+	}
+	base = strings.TrimSuffix(base, ".sealed")
+	return []string{base + ext + ".local", base + ext}
+}
+
+// Find walks the roots and returns the secret files matching the patterns,
+// except the files named like sealed files (see IsSealedPath) and the
+// directory configurations
+func (d *Discovery) Find() ([]SecretFile, error) {
+	include := d.Include
+	if len(include) == 0 {
+		include = DefaultInclude
+	}
+
+	var files []SecretFile
+	err := d.walk(func(root, path, rel string) error {
+		// never seal a sealed file again or a directory configuration, even
+		// when the patterns match them
+		if IsSealedPath(rel) || filepath.Base(path) == DirConfigFile || !matchAny(include, rel) {
+			return nil
+		}
+		config, err := d.DirConfig(root, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, SecretFile{
+			Source: path,
+			Sealed: SealedPath(path),
+			Config: config,
+		})
+		return nil
+	})
+	return files, err
+}
+
+// FindSealed walks the roots and returns the sealed files of the secret files
+// matching the patterns. The Source of a sealed file whose secret file is
+// missing is the path the secret file is expected at.
+func (d *Discovery) FindSealed() ([]SecretFile, error) {
+	include := d.Include
+	if len(include) == 0 {
+		include = DefaultInclude
+	}
+
+	var files []SecretFile
+	err := d.walk(func(root, path, rel string) error {
+		var sources []string
+		for _, candidate := range SourcePaths(rel) {
+			if matchAny(include, candidate) && !matchAny(d.Exclude, candidate) {
+				sources = append(sources, filepath.Join(root, filepath.FromSlash(candidate)))
+			}
+		}
+		if len(sources) == 0 {
+			return nil
+		}
+		source := sources[0]
+		for _, candidate := range sources {
+			if _, err := os.Stat(candidate); err == nil {
+				source = candidate
+				break
+			}
+		}
+		config, err := d.DirConfig(root, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, SecretFile{
+			Source: source,
+			Sealed: path,
+			Config: config,
+		})
+		return nil
+	})
+	return files, err
+}
+
+// walk calls fn with the files of the roots that are not excluded, with their
+// root and their slash separated path relative to the root. The errors are
+// collected and the walk goes on.
+func (d *Discovery) walk(fn func(root, path, rel string) error) error {
+	for _, p := range append(append([]string{}, d.Include...), d.Exclude...) {
+		if !doublestar.ValidatePattern(p) {
+			return fmt.Errorf("invalid pattern %q", p)
+		}
+	}
+
+	roots := d.Roots
+	if len(roots) == 0 {
+		roots = []string{"."}
+	}
+
+	var errs []error
+	for _, root := range roots {
+		err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				errs = append(errs, err)
+				if entry != nil && entry.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+
+			if rel != "." && matchAny(d.Exclude, rel) {
+				if entry.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if entry.IsDir() {
+				return nil
+			}
+			if err := fn(root, path, rel); err != nil {
+				errs = append(errs, err)
+			}
+			return nil
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// DirConfig returns the configuration of the nearest .kubeseal.yaml in the
+// directory of path or its parents, without going above root
+func (d *Discovery) DirConfig(root, path string) (DirConfig, error) {
+	root = filepath.Clean(root)
+	dir := filepath.Dir(filepath.Clean(path))
+	for {
+		config, err := d.loadDirConfig(dir)
+		if err != nil {
+			return DirConfig{}, err
+		}
+		if config != nil {
+			return *config, nil
+		}
+		parent := filepath.Dir(dir)
+		if dir == root || parent == dir {
+			return DirConfig{}, nil
+		}
+		dir = parent
+	}
+}
+
+// loadDirConfig reads the .kubeseal.yaml of a directory, returning nil when there is none
+func (d *Discovery) loadDirConfig(dir string) (*DirConfig, error) {
+	if config, ok := d.configs[dir]; ok {
+		return config, nil
+	}
+	if d.configs == nil {
+		d.configs = make(map[string]*DirConfig)
+	}
+
+	path := filepath.Join(dir, DirConfigFile)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		d.configs[dir] = nil
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	config := &DirConfig{}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if _, err := ParseScope(config.Scope); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	d.configs[dir] = config
+	return config, nil
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := doublestar.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
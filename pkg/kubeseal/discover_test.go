@@ -0,0 +1,127 @@
+package kubeseal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSealedPath(t *testing.T) {
+	require.Equal(t, "apps/db-sealed-secret.yaml", SealedPath("apps/db-secret.yaml.local"))
+	require.Equal(t, "apps/db-sealed-secret.yml", SealedPath("apps/db-secret.yml.local"))
+	require.Equal(t, "apps/db.sealed.yaml", SealedPath("apps/db.yaml.local"))
+	require.Equal(t, "apps/db.sealed.yaml", SealedPath("apps/db.yaml"))
+}
+
+func TestDiscoveryFind(t *testing.T) {
+	root := t.TempDir()
+	for path, content := range map[string]string{
+		"top-secret.yaml.local":            "",
+		"apps/db-secret.yaml.local":        "",
+		"apps/db-sealed-secret.yaml":       "",
+		"apps/.kubeseal.yaml":              "scope: namespace-wide\nnamespace: apps\n",
+		"apps/nested/api-secret.yml.local": "",
+		"vendor/lib-secret.yaml.local":     "",
+		"other/plain.yaml.local":           "",
+	} {
+		p := filepath.Join(root, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0644))
+	}
+
+	d := &Discovery{Roots: []string{root}, Exclude: []string{"vendor"}}
+	files, err := d.Find()
+	require.NoError(t, err)
+
+	found := make(map[string]SecretFile)
+	for _, f := range files {
+		rel, err := filepath.Rel(root, f.Source)
+		require.NoError(t, err)
+		found[filepath.ToSlash(rel)] = f
+	}
+	require.Len(t, found, 3)
+	require.Contains(t, found, "top-secret.yaml.local")
+	require.Equal(t, DirConfig{}, found["top-secret.yaml.local"].Config)
+	require.Equal(t, filepath.Join(root, "apps", "db-sealed-secret.yaml"), found["apps/db-secret.yaml.local"].Sealed)
+	require.Equal(t, DirConfig{Scope: "namespace-wide", Namespace: "apps"}, found["apps/db-secret.yaml.local"].Config)
+	require.Equal(t, DirConfig{Scope: "namespace-wide", Namespace: "apps"}, found["apps/nested/api-secret.yml.local"].Config)
+
+	d = &Discovery{Roots: []string{root}, Include: []string{"other/*.local"}}
+	files, err = d.Find()
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	require.Equal(t, filepath.Join(root, "other", "plain.sealed.yaml"), files[0].Sealed)
+
+	// the sealed files are never sources, even when the patterns match them
+	d = &Discovery{Roots: []string{root}, Include: []string{"**/*.yaml", "**/*.local"}}
+	files, err = d.Find()
+	require.NoError(t, err)
+	for _, f := range files {
+		require.False(t, IsSealedPath(f.Source), f.Source)
+	}
+	require.Len(t, files, 5)
+
+	require.NoError(t, os.WriteFile(filepath.Join(root, "apps", DirConfigFile), []byte("scope: everywhere\n"), 0644))
+	d = &Discovery{Roots: []string{root}}
+	files, err = d.Find()
+	require.Error(t, err, "an invalid scope must be reported")
+	require.Len(t, files, 2, "the files outside of the broken directory are still found")
+
+	_, err = (&Discovery{Roots: []string{root}, Include: []string{"[a-"}}).Find()
+	require.Error(t, err)
+}
+
+func TestSourcePaths(t *testing.T) {
+	require.Equal(t, []string{"apps/db-secret.yaml.local"}, SourcePaths("apps/db-sealed-secret.yaml"))
+	require.Equal(t, []string{"apps/db-secret.yml.local"}, SourcePaths("apps/db-sealed-secret.yml"))
+	require.Equal(t, []string{"apps/db.yaml.local", "apps/db.yaml"}, SourcePaths("apps/db.sealed.yaml"))
+	require.Nil(t, SourcePaths("apps/db-secret.yaml.local"))
+	require.Nil(t, SourcePaths("apps/db.yaml"))
+	require.Nil(t, SourcePaths("apps/db.sealed.yaml.local"))
+	require.True(t, IsSealedPath("db.sealed.yml"))
+	require.False(t, IsSealedPath("db-sealed.yaml"))
+
+	for _, source := range []string{"apps/db-secret.yaml.local", "apps/db.yaml.local", "apps/db.yaml"} {
+		require.Contains(t, SourcePaths(SealedPath(source)), source)
+	}
+}
+
+func TestDiscoveryFindSealed(t *testing.T) {
+	root := t.TempDir()
+	for path, content := range map[string]string{
+		"apps/db-secret.yaml.local":     "",
+		"apps/db-sealed-secret.yaml":    "",
+		"apps/.kubeseal.yaml":           "namespace: apps\n",
+		"apps/orphan-sealed-secret.yml": "",
+		"other/plain.yaml":              "",
+		"other/plain.sealed.yaml":       "",
+		"vendor/lib-sealed-secret.yaml": "",
+	} {
+		p := filepath.Join(root, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0644))
+	}
+
+	d := &Discovery{Roots: []string{root}, Exclude: []string{"vendor"}}
+	files, err := d.FindSealed()
+	require.NoError(t, err)
+	found := make(map[string]SecretFile)
+	for _, f := range files {
+		rel, err := filepath.Rel(root, f.Sealed)
+		require.NoError(t, err)
+		found[filepath.ToSlash(rel)] = f
+	}
+	require.Len(t, found, 2, "the .sealed.yaml files are not selected by the default include")
+	require.Equal(t, filepath.Join(root, "apps", "db-secret.yaml.local"), found["apps/db-sealed-secret.yaml"].Source)
+	require.Equal(t, DirConfig{Namespace: "apps"}, found["apps/db-sealed-secret.yaml"].Config)
+	require.Equal(t, filepath.Join(root, "apps", "orphan-secret.yml.local"), found["apps/orphan-sealed-secret.yml"].Source, "the missing source is reported")
+
+	d = &Discovery{Roots: []string{root}, Include: []string{"other/*"}}
+	files, err = d.FindSealed()
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	require.Equal(t, filepath.Join(root, "other", "plain.sealed.yaml"), files[0].Sealed)
+	require.Equal(t, filepath.Join(root, "other", "plain.yaml"), files[0].Source, "the existing source is preferred")
+}
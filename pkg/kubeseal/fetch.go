@@ -0,0 +1,109 @@
+package kubeseal
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"k8s.io/client-go/rest"
+)
+
+// KeyLabel labels the key secrets of the sealed secrets controller
+const KeyLabel = "sealedsecrets.bitnami.com/sealed-secrets-key=active"
+
+// CertificatePath returns the kube api path of the certificate served by the
+// controller, proxied through its service
+func CertificatePath(namespace, name string) string {
+	return fmt.Sprintf("/api/v1/namespaces/%s/services/http:%s:/proxy/v1/cert.pem", url.PathEscape(namespace), url.PathEscape(name))
+}
+
+// KeySecretsPath returns the kube api path listing the key secrets of the controller
+func KeySecretsPath(namespace string) string {
+	return fmt.Sprintf("/api/v1/namespaces/%s/secrets?labelSelector=%s", url.PathEscape(namespace), url.QueryEscape(KeyLabel))
+}
+
+// CertificateFromSecrets returns the certificate of the newest key secret of
+// a list of key secrets in JSON
+func CertificateFromSecrets(data []byte) ([]byte, error) {
+	secrets := struct {
+		Items []struct {
+			Metadata struct {
+				CreationTimestamp string `json:"creationTimestamp"`
+			} `json:"metadata"`
+			Data map[string]string `json:"data"`
+		} `json:"items"`
+	}{}
+	if err := json.Unmarshal(data, &secrets); err != nil {
+		return nil, fmt.Errorf("failed to decode the list of secrets: %w", err)
+	}
+
+	var newest, created string
+	for _, s := range secrets.Items {
+		// RFC3339 timestamps in UTC sort lexically
+		if crt, ok := s.Data["tls.crt"]; ok && s.Metadata.CreationTimestamp >= created {
+			newest, created = crt, s.Metadata.CreationTimestamp
+		}
+	}
+	if newest == "" {
+		return nil, errors.New("no active sealed secrets key found")
+	}
+
+	return base64.StdEncoding.DecodeString(newest)
+}
+
+// FetchCertificate fetches the certificate of the controller from the kube
+// api with the credentials of config, from the controller through its service
+// or, when the controller can not be reached, from its newest key secret
+func FetchCertificate(ctx context.Context, config *rest.Config, namespace, name string) ([]byte, error) {
+	client, err := rest.HTTPClientFor(config)
+	if err != nil {
+		return nil, err
+	}
+	base := strings.TrimSuffix(config.Host, "/")
+	if !strings.Contains(base, "://") {
+		base = "https://" + base
+	}
+
+	cert, err := get(ctx, client, base+CertificatePath(namespace, name))
+	if err == nil {
+		if _, err = ParseCertificate(cert); err == nil {
+			return cert, nil
+		}
+	}
+	secrets, serr := get(ctx, client, base+KeySecretsPath(namespace))
+	if serr != nil {
+		return nil, fmt.Errorf("failed to fetch the certificate from the controller: %w, nor from its key secrets: %w", err, serr)
+	}
+	cert, serr = CertificateFromSecrets(secrets)
+	if serr != nil {
+		return nil, fmt.Errorf("failed to fetch the certificate from the controller: %w, nor from its key secrets: %w", err, serr)
+	}
+	return cert, nil
+}
+
+// get returns the body of a successful GET request
+func get(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: http %d: %s", req.URL.Path, resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
@@ -0,0 +1,53 @@
+package kubeseal
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/rest"
+)
+
+func TestFetchCertificate(t *testing.T) {
+	_, cert := testKeyPair(t)
+	_, old := testKeyPair(t)
+	serving := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		switch {
+		case r.URL.Path == "/api/v1/namespaces/sealed-secrets/services/http:sealed-secrets:/proxy/v1/cert.pem" && serving:
+			_, _ = w.Write(cert)
+		case r.URL.Path == "/api/v1/namespaces/sealed-secrets/secrets" && r.URL.Query().Get("labelSelector") == KeyLabel:
+			fmt.Fprintf(w, `{"items":[{"metadata":{"creationTimestamp":"2024-01-02T00:00:00Z"},"data":{"tls.crt":%q}},{"metadata":{"creationTimestamp":"2023-01-02T00:00:00Z"},"data":{"tls.crt":%q}}]}`,
+				base64.StdEncoding.EncodeToString(cert), base64.StdEncoding.EncodeToString(old))
+		default:
+			http.Error(w, "service unavailable", http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	config := &rest.Config{Host: srv.URL, BearerToken: "token"}
+
+	data, err := FetchCertificate(context.Background(), config, "sealed-secrets", "sealed-secrets")
+	require.NoError(t, err)
+	require.Equal(t, cert, data)
+
+	// the newest key secret is used when the controller can not be reached
+	serving = false
+	data, err = FetchCertificate(context.Background(), config, "sealed-secrets", "sealed-secrets")
+	require.NoError(t, err)
+	require.Equal(t, cert, data)
+
+	_, err = FetchCertificate(context.Background(), config, "other", "sealed-secrets")
+	require.ErrorContains(t, err, "http 503")
+}
+
+func TestCertificateFromSecrets(t *testing.T) {
+	_, err := CertificateFromSecrets([]byte(`{"items":[]}`))
+	require.ErrorContains(t, err, "no active sealed secrets key found")
+	_, err = CertificateFromSecrets([]byte(`not json`))
+	require.Error(t, err)
+}
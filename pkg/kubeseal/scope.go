@@ -0,0 +1,96 @@
+package kubeseal
+
+import "fmt"
+
+// Scope defines which secrets a sealed value can be decrypted into
+type Scope int
+
+const (
+	// ScopeDefault takes the scope from the annotations of the secret
+	ScopeDefault Scope = iota
+	// ScopeStrict binds the value to the secret name and namespace
+	ScopeStrict
+	// ScopeNamespaceWide binds the value to the namespace
+	ScopeNamespaceWide
+	// ScopeClusterWide allows the value to be used in any secret
+	ScopeClusterWide
+)
+
+const (
+	// NamespaceWideAnnotation marks a secret as namespace-wide
+	NamespaceWideAnnotation = "sealedsecrets.bitnami.com/namespace-wide"
+	// ClusterWideAnnotation marks a secret as cluster-wide
+	ClusterWideAnnotation = "sealedsecrets.bitnami.com/cluster-wide"
+)
+
+// ParseScope parses a scope name as accepted by kubeseal --scope
+func ParseScope(s string) (Scope, error) {
+	switch s {
+	case "":
+		return ScopeDefault, nil
+	case "strict":
+		return ScopeStrict, nil
+	case "namespace-wide":
+		return ScopeNamespaceWide, nil
+	case "cluster-wide":
+		return ScopeClusterWide, nil
+	default:
+		return ScopeDefault, fmt.Errorf("unknown scope %q (strict, namespace-wide, cluster-wide)", s)
+	}
+}
+
+// String returns the kubeseal name of the scope
+func (s Scope) String() string {
+	switch s {
+	case ScopeStrict:
+		return "strict"
+	case ScopeNamespaceWide:
+		return "namespace-wide"
+	case ScopeClusterWide:
+		return "cluster-wide"
+	default:
+		return ""
+	}
+}
+
+// ScopeFromAnnotations returns the scope requested by the annotations of a secret
+func ScopeFromAnnotations(annotations map[string]string) Scope {
+	if annotations[ClusterWideAnnotation] == "true" {
+		return ScopeClusterWide
+	}
+	if annotations[NamespaceWideAnnotation] == "true" {
+		return ScopeNamespaceWide
+	}
+	return ScopeStrict
+}
+
+// applyAnnotations sets the scope annotations for the scope and removes the others
+func (s Scope) applyAnnotations(annotations map[string]string) map[string]string {
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	delete(annotations, NamespaceWideAnnotation)
+	delete(annotations, ClusterWideAnnotation)
+	switch s {
+	case ScopeNamespaceWide:
+		annotations[NamespaceWideAnnotation] = "true"
+	case ScopeClusterWide:
+		annotations[ClusterWideAnnotation] = "true"
+	}
+	if len(annotations) == 0 {
+		return nil
+	}
+	return annotations
+}
+
+// EncryptionLabel returns the RSA-OAEP label binding a value to its scope
+func EncryptionLabel(namespace, name string, scope Scope) []byte {
+	switch scope {
+	case ScopeClusterWide:
+		return []byte("")
+	case ScopeNamespaceWide:
+		return []byte(namespace)
+	default:
+		return []byte(fmt.Sprintf("%s/%s", namespace, name))
+	}
+}
@@ -0,0 +1,238 @@
+package kubeseal
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultNamespace is used for secrets that do not define a namespace
+const DefaultNamespace = "default"
+
+// ObjectMeta is the subset of kubernetes object metadata used by secrets
+type ObjectMeta struct {
+	Name        string            `yaml:"name,omitempty"`
+	Namespace   string            `yaml:"namespace,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+// Secret is a kubernetes v1 Secret
+type Secret struct {
+	APIVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Metadata   ObjectMeta        `yaml:"metadata"`
+	Type       string            `yaml:"type,omitempty"`
+	Immutable  *bool             `yaml:"immutable,omitempty"`
+	Data       map[string]string `yaml:"data,omitempty"`
+	StringData map[string]string `yaml:"stringData,omitempty"`
+}
+
+// SecretTemplate describes the secret the controller creates from a sealed secret
+type SecretTemplate struct {
+	Metadata  ObjectMeta `yaml:"metadata"`
+	Type      string     `yaml:"type,omitempty"`
+	Immutable *bool      `yaml:"immutable,omitempty"`
+}
+
+// SealedSecretSpec is the spec of a SealedSecret
+type SealedSecretSpec struct {
+	Template      SecretTemplate    `yaml:"template"`
+	EncryptedData map[string]string `yaml:"encryptedData"`
+}
+
+// SealedSecret is a bitnami.com/v1alpha1 SealedSecret
+type SealedSecret struct {
+	APIVersion string           `yaml:"apiVersion"`
+	Kind       string           `yaml:"kind"`
+	Metadata   ObjectMeta       `yaml:"metadata"`
+	Spec       SealedSecretSpec `yaml:"spec"`
+}
+
+// Sealer encrypts secrets for a sealed secrets controller
+type Sealer struct {
+	// PublicKey is the public key of the controller
+	PublicKey *rsa.PublicKey
+	// Scope overrides the scope requested by the secret annotations
+	Scope Scope
+	// Namespace is used for secrets without a namespace, defaults to DefaultNamespace
+	Namespace string
+	// Annotations are added to the metadata of the sealed secrets
+	Annotations map[string]string
+	// Fingerprint of the certificate, recorded in the CertFingerprintAnnotation
+	Fingerprint string
+	// Rand is the source of randomness, defaults to crypto/rand
+	Rand io.Reader
+}
+
+// ParseCertificate parses a PEM encoded sealed secrets certificate
+func ParseCertificate(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("failed to decode certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := cert.PublicKey.(*rsa.PublicKey); !ok {
+		return nil, errors.New("the certificate does not hold a RSA public key")
+	}
+	return cert, nil
+}
+
+// NewSealer returns a Sealer using the public key of the certificate
+func NewSealer(cert *x509.Certificate) (*Sealer, error) {
+	pub, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("the certificate does not hold a RSA public key")
+	}
+	return &Sealer{PublicKey: pub, Fingerprint: Fingerprint(cert)}, nil
+}
+
+func (s *Sealer) rand() io.Reader {
+	if s.Rand == nil {
+		return rand.Reader
+	}
+	return s.Rand
+}
+
+// EncryptValue encrypts a single value for the given secret name, namespace and scope
+// and returns it base64 encoded
+func (s *Sealer) EncryptValue(namespace, name string, scope Scope, value []byte) (string, error) {
+	ciphertext, err := HybridEncrypt(s.rand(), s.PublicKey, value, EncryptionLabel(namespace, name, scope))
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// Seal converts a secret into a sealed secret
+func (s *Sealer) Seal(secret *Secret) (*SealedSecret, error) {
+	if secret.Kind != "Secret" {
+		return nil, fmt.Errorf("expected a Secret, got kind %q", secret.Kind)
+	}
+	if secret.Metadata.Name == "" {
+		return nil, errors.New("the secret has no name")
+	}
+
+	scope := s.Scope
+	if scope == ScopeDefault {
+		scope = ScopeFromAnnotations(secret.Metadata.Annotations)
+	}
+
+	meta := secret.Metadata
+	if meta.Namespace == "" && scope != ScopeClusterWide {
+		meta.Namespace = s.Namespace
+		if meta.Namespace == "" {
+			meta.Namespace = DefaultNamespace
+		}
+	}
+	meta.Annotations = scope.applyAnnotations(copyMap(meta.Annotations))
+	meta.Labels = copyMap(meta.Labels)
+
+	annotations := copyMap(s.Annotations)
+	if s.Fingerprint != "" {
+		if annotations == nil {
+			annotations = make(map[string]string, 1)
+		}
+		annotations[CertFingerprintAnnotation] = s.Fingerprint
+	}
+
+	sealed := &SealedSecret{
+		APIVersion: "bitnami.com/v1alpha1",
+		Kind:       "SealedSecret",
+		Metadata: ObjectMeta{
+			Name:        meta.Name,
+			Namespace:   meta.Namespace,
+			Annotations: scope.applyAnnotations(annotations),
+		},
+		Spec: SealedSecretSpec{
+			Template: SecretTemplate{
+				Metadata:  meta,
+				Type:      secret.Type,
+				Immutable: secret.Immutable,
+			},
+			EncryptedData: make(map[string]string, len(secret.Data)+len(secret.StringData)),
+		},
+	}
+
+	for key, value := range secret.Data {
+		plain, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("data.%s is not valid base64: %w", key, err)
+		}
+		if sealed.Spec.EncryptedData[key], err = s.EncryptValue(meta.Namespace, meta.Name, scope, plain); err != nil {
+			return nil, err
+		}
+	}
+
+	// stringData takes precedence over data like it does in the API server
+	for key, value := range secret.StringData {
+		var err error
+		if sealed.Spec.EncryptedData[key], err = s.EncryptValue(meta.Namespace, meta.Name, scope, []byte(value)); err != nil {
+			return nil, err
+		}
+	}
+
+	return sealed, nil
+}
+
+// SealYAML seals the secrets of a manifest and returns the sealed secrets
+// manifest. Every document of a multi-document manifest must be a secret.
+func (s *Sealer) SealYAML(data []byte) ([]byte, error) {
+	var out bytes.Buffer
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for i := 0; ; i++ {
+		var secret *Secret
+		if err := dec.Decode(&secret); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("parse secret: %w", err)
+		}
+		if secret == nil {
+			// empty document
+			continue
+		}
+
+		sealed, err := s.Seal(secret)
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", i+1, err)
+		}
+
+		doc, err := yaml.Marshal(sealed)
+		if err != nil {
+			return nil, err
+		}
+		if out.Len() > 0 {
+			out.WriteString("---\n")
+		}
+		out.Write(doc)
+	}
+
+	if out.Len() == 0 {
+		return nil, errors.New("no secret found")
+	}
+
+	return out.Bytes(), nil
+}
+
+func copyMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,164 @@
+package kubeseal
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func testKeyPair(t *testing.T) (*rsa.PrivateKey, []byte) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sealed-secret"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	return key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func unseal(t *testing.T, key *rsa.PrivateKey, sealed *SealedSecret, scope Scope) map[string]string {
+	t.Helper()
+	out := make(map[string]string)
+	meta := sealed.Spec.Template.Metadata
+	for k, v := range sealed.Spec.EncryptedData {
+		ciphertext, err := base64.StdEncoding.DecodeString(v)
+		require.NoError(t, err)
+		plain, err := HybridDecrypt(key, ciphertext, EncryptionLabel(meta.Namespace, meta.Name, scope))
+		require.NoError(t, err)
+		out[k] = string(plain)
+	}
+	return out
+}
+
+func TestHybridEncryptRoundTrip(t *testing.T) {
+	key, _ := testKeyPair(t)
+	ciphertext, err := HybridEncrypt(rand.Reader, &key.PublicKey, []byte("hello"), []byte("ns/name"))
+	require.NoError(t, err)
+
+	plain, err := HybridDecrypt(key, ciphertext, []byte("ns/name"))
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(plain))
+
+	_, err = HybridDecrypt(key, ciphertext, []byte("ns/other"))
+	require.Error(t, err, "a value sealed for another name must not decrypt")
+
+	_, err = HybridDecrypt(key, ciphertext[:1], nil)
+	require.ErrorIs(t, err, ErrTooShort)
+}
+
+func TestSealYAML(t *testing.T) {
+	key, certPEM := testKeyPair(t)
+	cert, err := ParseCertificate(certPEM)
+	require.NoError(t, err)
+	sealer, err := NewSealer(cert)
+	require.NoError(t, err)
+
+	secret := []byte(`apiVersion: v1
+kind: Secret
+metadata:
+  name: db
+  labels:
+    app: db
+type: Opaque
+data:
+  user: YWRtaW4=
+stringData:
+  password: s3cret
+`)
+
+	out, err := sealer.SealYAML(secret)
+	require.NoError(t, err)
+
+	sealed := &SealedSecret{}
+	require.NoError(t, yaml.Unmarshal(out, sealed))
+	require.Equal(t, "SealedSecret", sealed.Kind)
+	require.Equal(t, DefaultNamespace, sealed.Metadata.Namespace)
+	require.Equal(t, "db", sealed.Spec.Template.Metadata.Labels["app"])
+	require.Equal(t, "Opaque", sealed.Spec.Template.Type)
+	require.Equal(t, map[string]string{"user": "admin", "password": "s3cret"}, unseal(t, key, sealed, ScopeStrict))
+
+	sealer.Scope = ScopeClusterWide
+	out, err = sealer.SealYAML(secret)
+	require.NoError(t, err)
+	sealed = &SealedSecret{}
+	require.NoError(t, yaml.Unmarshal(out, sealed))
+	require.Equal(t, "true", sealed.Metadata.Annotations[ClusterWideAnnotation])
+	require.Equal(t, map[string]string{"user": "admin", "password": "s3cret"}, unseal(t, key, sealed, ScopeClusterWide))
+
+	sealer.Scope = ScopeDefault
+	out, err = sealer.SealYAML([]byte(`apiVersion: v1
+kind: Secret
+metadata:
+  name: db
+  namespace: prod
+  annotations:
+    sealedsecrets.bitnami.com/namespace-wide: "true"
+stringData:
+  password: s3cret
+`))
+	require.NoError(t, err)
+	sealed = &SealedSecret{}
+	require.NoError(t, yaml.Unmarshal(out, sealed))
+	require.Equal(t, "true", sealed.Metadata.Annotations[NamespaceWideAnnotation])
+	require.Equal(t, map[string]string{"password": "s3cret"}, unseal(t, key, sealed, ScopeNamespaceWide))
+
+	_, err = sealer.SealYAML([]byte("kind: ConfigMap\nmetadata:\n  name: x\n"))
+	require.Error(t, err)
+}
+
+func TestSealYAMLMultiDocument(t *testing.T) {
+	key, certPEM := testKeyPair(t)
+	cert, err := ParseCertificate(certPEM)
+	require.NoError(t, err)
+	sealer, err := NewSealer(cert)
+	require.NoError(t, err)
+
+	out, err := sealer.SealYAML([]byte(`---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: first
+stringData:
+  a: one
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: second
+stringData:
+  b: two
+`))
+	require.NoError(t, err)
+
+	dec := yaml.NewDecoder(bytes.NewReader(out))
+	var names []string
+	for {
+		sealed := &SealedSecret{}
+		if err := dec.Decode(sealed); err != nil {
+			require.ErrorIs(t, err, io.EOF)
+			break
+		}
+		names = append(names, sealed.Metadata.Name)
+		require.Len(t, unseal(t, key, sealed, ScopeStrict), 1)
+	}
+	require.Equal(t, []string{"first", "second"}, names)
+
+	_, err = sealer.SealYAML([]byte("---\n"))
+	require.Error(t, err)
+}
@@ -0,0 +1,172 @@
+package kubeseal
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// SourceHashAnnotation records the hash of the plaintext a sealed secret was created from
+	SourceHashAnnotation = "cfctl.clusterfactory.io/source-hash"
+	// CertFingerprintAnnotation records the fingerprint of the certificate a sealed secret was encrypted for
+	CertFingerprintAnnotation = "cfctl.clusterfactory.io/cert-fingerprint"
+)
+
+const (
+	sha256Prefix     = "sha256:"
+	hmacSHA256Prefix = "hmac-sha256:"
+)
+
+// SourceHash returns the value of the source hash annotation for the plaintext.
+// A keyed HMAC is used when key is not empty, otherwise a plain SHA-256. The
+// HMAC should be preferred for low entropy secrets that could be brute-forced
+// from their hash.
+func SourceHash(plaintext, key []byte) string {
+	if len(key) > 0 {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(plaintext)
+		return hmacSHA256Prefix + hex.EncodeToString(mac.Sum(nil))
+	}
+	sum := sha256.Sum256(plaintext)
+	return sha256Prefix + hex.EncodeToString(sum[:])
+}
+
+// Fingerprint returns the SHA-256 fingerprint of a certificate
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return sha256Prefix + hex.EncodeToString(sum[:])
+}
+
+// Status describes the state of a sealed file compared to its source
+type Status int
+
+const (
+	// UpToDate means the sealed file was created from the current source
+	UpToDate Status = iota
+	// Missing means the sealed file does not exist
+	Missing
+	// Unrecorded means the sealed file has no source hash annotation, such as
+	// the files sealed before the hash was recorded. Whether it is up to date
+	// is unknown.
+	Unrecorded
+	// Changed means the source has changed since it was sealed
+	Changed
+)
+
+// String returns a human readable status
+func (s Status) String() string {
+	switch s {
+	case UpToDate:
+		return "up to date"
+	case Missing:
+		return "missing"
+	case Unrecorded:
+		return "no source hash recorded"
+	case Changed:
+		return "source changed"
+	default:
+		return "unknown"
+	}
+}
+
+// Stale returns true when the sealed file needs to be (re)created. Unrecorded
+// files are not stale, they are only resealed on demand.
+func (s Status) Stale() bool {
+	return s == Missing || s == Changed
+}
+
+// CheckStatus compares the source with the source hash recorded in the sealed
+// file. Every document of the sealed file must carry a matching annotation.
+func CheckStatus(source []byte, sealedPath string, key []byte) (Status, error) {
+	data, err := os.ReadFile(sealedPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return Missing, nil
+		}
+		return Missing, err
+	}
+
+	docs, err := annotationsOf(data)
+	if err != nil {
+		return Missing, fmt.Errorf("%s: %w", sealedPath, err)
+	}
+	if len(docs) == 0 {
+		return Unrecorded, nil
+	}
+
+	for _, annotations := range docs {
+		recorded := annotations[SourceHashAnnotation]
+		switch {
+		case recorded == "":
+			return Unrecorded, nil
+		case strings.HasPrefix(recorded, hmacSHA256Prefix) && len(key) == 0:
+			return Changed, fmt.Errorf("%s: the source hash is keyed, a hash key is required to verify it", sealedPath)
+		case strings.HasPrefix(recorded, hmacSHA256Prefix):
+			if !hmac.Equal([]byte(recorded), []byte(SourceHash(source, key))) {
+				return Changed, nil
+			}
+		case recorded != SourceHash(source, nil):
+			return Changed, nil
+		}
+	}
+
+	return UpToDate, nil
+}
+
+// CheckFingerprint returns true when every document of the sealed file was
+// encrypted for the certificate with the given fingerprint. Files sealed before
+// the fingerprint was recorded are reported as not matching.
+func CheckFingerprint(sealedPath string, fingerprint string) (bool, error) {
+	data, err := os.ReadFile(sealedPath)
+	if err != nil {
+		return false, err
+	}
+
+	docs, err := annotationsOf(data)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", sealedPath, err)
+	}
+	if len(docs) == 0 {
+		return false, nil
+	}
+
+	for _, annotations := range docs {
+		if annotations[CertFingerprintAnnotation] != fingerprint {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// annotationsOf returns the metadata annotations of every document of a manifest
+func annotationsOf(data []byte) ([]map[string]string, error) {
+	var result []map[string]string
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var obj *struct {
+			Metadata ObjectMeta `yaml:"metadata"`
+		}
+		if err := dec.Decode(&obj); err != nil {
+			if errors.Is(err, io.EOF) {
+				return result, nil
+			}
+			return nil, err
+		}
+		if obj == nil {
+			// empty document
+			continue
+		}
+		result = append(result, obj.Metadata.Annotations)
+	}
+}
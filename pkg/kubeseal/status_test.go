@@ -0,0 +1,91 @@
+package kubeseal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckStatus(t *testing.T) {
+	_, certPEM := testKeyPair(t)
+	cert, err := ParseCertificate(certPEM)
+	require.NoError(t, err)
+	sealer, err := NewSealer(cert)
+	require.NoError(t, err)
+
+	source := []byte("apiVersion: v1\nkind: Secret\nmetadata:\n  name: foo\nstringData:\n  password: hunter2\n")
+	sealedPath := filepath.Join(t.TempDir(), "foo-sealed-secret.yaml")
+	key := []byte("hash-key")
+
+	status, err := CheckStatus(source, sealedPath, key)
+	require.NoError(t, err)
+	require.Equal(t, Missing, status)
+
+	sealed, err := sealer.SealYAML(source)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(sealedPath, sealed, 0644))
+	status, err = CheckStatus(source, sealedPath, key)
+	require.NoError(t, err)
+	require.Equal(t, Unrecorded, status)
+	require.False(t, status.Stale())
+
+	sealer.Annotations = map[string]string{SourceHashAnnotation: SourceHash(source, key)}
+	sealed, err = sealer.SealYAML(source)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(sealedPath, sealed, 0644))
+	status, err = CheckStatus(source, sealedPath, key)
+	require.NoError(t, err)
+	require.Equal(t, UpToDate, status)
+
+	edited := append(source, []byte("  user: admin\n")...)
+	status, err = CheckStatus(edited, sealedPath, key)
+	require.NoError(t, err)
+	require.Equal(t, Changed, status)
+	require.True(t, status.Stale())
+
+	status, err = CheckStatus(source, sealedPath, []byte("other-key"))
+	require.NoError(t, err)
+	require.Equal(t, Changed, status)
+
+	_, err = CheckStatus(source, sealedPath, nil)
+	require.Error(t, err, "a keyed hash cannot be verified without the key")
+}
+
+func TestSourceHash(t *testing.T) {
+	require.Regexp(t, `^sha256:[0-9a-f]{64}$`, SourceHash([]byte("a"), nil))
+	require.Regexp(t, `^hmac-sha256:[0-9a-f]{64}$`, SourceHash([]byte("a"), []byte("k")))
+	require.NotEqual(t, SourceHash([]byte("a"), []byte("k1")), SourceHash([]byte("a"), []byte("k2")))
+}
+
+func TestCheckFingerprint(t *testing.T) {
+	source := []byte("apiVersion: v1\nkind: Secret\nmetadata:\n  name: foo\nstringData:\n  password: hunter2\n")
+	sealedPath := filepath.Join(t.TempDir(), "foo-sealed-secret.yaml")
+
+	var fingerprints []string
+	for i := 0; i < 2; i++ {
+		_, certPEM := testKeyPair(t)
+		cert, err := ParseCertificate(certPEM)
+		require.NoError(t, err)
+		sealer, err := NewSealer(cert)
+		require.NoError(t, err)
+		require.Equal(t, Fingerprint(cert), sealer.Fingerprint)
+		fingerprints = append(fingerprints, sealer.Fingerprint)
+
+		if i == 0 {
+			sealed, err := sealer.SealYAML(source)
+			require.NoError(t, err)
+			require.NoError(t, os.WriteFile(sealedPath, sealed, 0644))
+		}
+	}
+	require.NotEqual(t, fingerprints[0], fingerprints[1])
+
+	current, err := CheckFingerprint(sealedPath, fingerprints[0])
+	require.NoError(t, err)
+	require.True(t, current)
+
+	current, err = CheckFingerprint(sealedPath, fingerprints[1])
+	require.NoError(t, err)
+	require.False(t, current, "a rotated certificate must be detected")
+}
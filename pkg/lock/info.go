@@ -0,0 +1,134 @@
+// Package lock describes the cfctl instances holding the lock files of the hosts
+// and the lock lease of the cluster
+package lock
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Expiry is how long a lock file is held after its last refresh, the
+// instance holding it touches it every 10 seconds
+const Expiry = 30 * time.Second
+
+// Info is the content of a lock file
+type Info struct {
+	// ID identifies the instance of cfctl holding the lock: the machine id
+	// and the process id
+	ID       string `json:"id"`
+	User     string `json:"user,omitempty"`
+	Hostname string `json:"hostname,omitempty"`
+	// Command is the command line of the instance without the flag values
+	// and arguments, see Command
+	Command string    `json:"command,omitempty"`
+	Started time.Time `json:"started,omitempty"`
+	Version string    `json:"version,omitempty"`
+}
+
+// New returns the lock information of the running cfctl instance
+func New(id, version string) *Info {
+	info := &Info{
+		ID:      id,
+		Command: Command(os.Args),
+		Started: time.Now().UTC().Truncate(time.Second),
+		Version: version,
+	}
+	if u, err := user.Current(); err == nil {
+		info.User = u.Username
+	}
+	if h, err := os.Hostname(); err == nil {
+		info.Hostname = h
+	}
+	return info
+}
+
+// subcommandPattern matches the names of the cfctl subcommands
+var subcommandPattern = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// Command returns a command line that is safe to record: the name of the
+// program, its subcommands and the names of the flags, without their values
+// nor the arguments, which may hold secrets
+func Command(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	words := []string{filepath.Base(args[0])}
+	subcommands := true
+	for _, arg := range args[1:] {
+		if arg == "--" {
+			break
+		}
+		if strings.HasPrefix(arg, "-") {
+			subcommands = false
+			name, _, _ := strings.Cut(arg, "=")
+			words = append(words, name)
+			continue
+		}
+		if subcommands && subcommandPattern.MatchString(arg) {
+			words = append(words, arg)
+			continue
+		}
+		subcommands = false
+	}
+	return strings.Join(words, " ")
+}
+
+// Parse reads the content of a lock file, the lock files of older versions
+// of cfctl only hold the id
+func Parse(content string) *Info {
+	content = strings.TrimSpace(content)
+	info := &Info{}
+	if err := json.Unmarshal([]byte(content), info); err != nil || info.ID == "" {
+		return &Info{ID: content}
+	}
+	return info
+}
+
+// Marshal returns the content of the lock file
+func (i *Info) Marshal() (string, error) {
+	data, err := json.Marshal(i)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Holder describes who holds the lock, such as "alice@laptop"
+func (i *Info) Holder() string {
+	switch {
+	case i.User != "" && i.Hostname != "":
+		return i.User + "@" + i.Hostname
+	case i.Hostname != "":
+		return i.Hostname
+	case i.User != "":
+		return i.User
+	default:
+		return "instance " + i.ID
+	}
+}
+
+// String describes the lock for the error messages
+func (i *Info) String() string {
+	s := i.Holder()
+	if i.Command != "" {
+		s += fmt.Sprintf(" running %q", i.Command)
+	}
+	if !i.Started.IsZero() {
+		s += " since " + i.Started.Local().Format(time.RFC3339)
+	}
+	if i.Version != "" {
+		s += " (cfctl " + i.Version + ")"
+	}
+	return s
+}
+
+// Expired returns true when a lock file last refreshed at modTime is expired
+func Expired(modTime time.Time) bool {
+	return time.Since(modTime) >= Expiry
+}
@@ -0,0 +1,56 @@
+package lock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	t.Run("metadata", func(t *testing.T) {
+		info := &Info{
+			ID:       "abc-42",
+			User:     "alice",
+			Hostname: "laptop",
+			Command:  "cfctl apply --config cluster.yaml",
+			Started:  time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+			Version:  "v0.5.0",
+		}
+		content, err := info.Marshal()
+		require.NoError(t, err)
+
+		parsed := Parse(content + "\n")
+		require.Equal(t, info, parsed)
+		require.Equal(t, "alice@laptop", parsed.Holder())
+		require.Contains(t, parsed.String(), `alice@laptop running "cfctl apply --config cluster.yaml" since `)
+		require.Contains(t, parsed.String(), "(cfctl v0.5.0)")
+	})
+
+	t.Run("legacy", func(t *testing.T) {
+		parsed := Parse("abc-42\n")
+		require.Equal(t, &Info{ID: "abc-42"}, parsed)
+		require.Equal(t, "instance abc-42", parsed.String())
+	})
+}
+
+func TestNew(t *testing.T) {
+	info := New("abc-42", "v0.5.0")
+	require.Equal(t, "abc-42", info.ID)
+	require.Equal(t, "v0.5.0", info.Version)
+	require.NotEmpty(t, info.Command)
+	require.WithinDuration(t, time.Now(), info.Started, 2*time.Second)
+}
+
+func TestCommand(t *testing.T) {
+	require.Equal(t, "cfctl apply --config --force", Command([]string{"/usr/local/bin/cfctl", "apply", "--config", "cluster.yaml", "--force"}))
+	require.Equal(t, "cfctl backup --encrypt-to", Command([]string{"cfctl", "backup", "--encrypt-to=age1secret"}))
+	require.Equal(t, "cfctl restore --config", Command([]string{"cfctl", "restore", "k0s_backup_1.tar.gz", "--config", "c.yaml", "secret"}))
+	require.Equal(t, "cfctl kubeseal rotate", Command([]string{"cfctl", "kubeseal", "rotate", "--", "--not-a-flag"}))
+	require.Empty(t, Command(nil))
+}
+
+func TestExpired(t *testing.T) {
+	require.False(t, Expired(time.Now().Add(-10*time.Second)))
+	require.True(t, Expired(time.Now().Add(-time.Minute)))
+}
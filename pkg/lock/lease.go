@@ -0,0 +1,113 @@
+package lock
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// LeaseName is the name of the cluster lock lease in LeaseNamespace
+const LeaseName = "cfctl"
+
+// LeaseNamespace is the namespace of the cluster lock lease
+const LeaseNamespace = "kube-system"
+
+// InfoAnnotation holds the lock information of the holder of the lease
+const InfoAnnotation = "cfctl.clusterfactory.io/lock"
+
+// microTime is the format of the times of the leases
+const microTime = "2006-01-02T15:04:05.000000Z07:00"
+
+// Lease is a coordination.k8s.io/v1 lease locking a cluster
+type Lease struct {
+	APIVersion string        `json:"apiVersion"`
+	Kind       string        `json:"kind"`
+	Metadata   LeaseMetadata `json:"metadata"`
+	Spec       LeaseSpec     `json:"spec"`
+}
+
+// LeaseMetadata is the metadata of a lease
+type LeaseMetadata struct {
+	Name            string            `json:"name"`
+	Namespace       string            `json:"namespace"`
+	ResourceVersion string            `json:"resourceVersion,omitempty"`
+	Annotations     map[string]string `json:"annotations,omitempty"`
+}
+
+// LeaseSpec is the holder of a lease
+type LeaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          string `json:"acquireTime,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+}
+
+// NewLease returns the lease held by an instance of cfctl
+func NewLease(info *Info, now time.Time) (*Lease, error) {
+	content, err := info.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	t := FormatTime(now)
+	return &Lease{
+		APIVersion: "coordination.k8s.io/v1",
+		Kind:       "Lease",
+		Metadata: LeaseMetadata{
+			Name:        LeaseName,
+			Namespace:   LeaseNamespace,
+			Annotations: map[string]string{InfoAnnotation: content},
+		},
+		Spec: LeaseSpec{
+			HolderIdentity:       info.ID,
+			LeaseDurationSeconds: int(Expiry.Seconds()),
+			AcquireTime:          t,
+			RenewTime:            t,
+		},
+	}, nil
+}
+
+// ParseLease parses the JSON output of "kubectl get lease"
+func ParseLease(data []byte) (*Lease, error) {
+	l := &Lease{}
+	if err := json.Unmarshal(data, l); err != nil {
+		return nil, fmt.Errorf("invalid lease: %w", err)
+	}
+	return l, nil
+}
+
+// Manifest returns the JSON manifest of the lease
+func (l *Lease) Manifest() (string, error) {
+	data, err := json.Marshal(l)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Holder returns the lock information of the holder of the lease
+func (l *Lease) Holder() *Info {
+	if content, ok := l.Metadata.Annotations[InfoAnnotation]; ok {
+		if info := Parse(content); info.ID == l.Spec.HolderIdentity {
+			return info
+		}
+	}
+	return &Info{ID: l.Spec.HolderIdentity}
+}
+
+// Expired returns true when the lease is not held or was not renewed in time
+func (l *Lease) Expired(now time.Time) bool {
+	if l.Spec.HolderIdentity == "" {
+		return true
+	}
+	renew, err := time.Parse(time.RFC3339, l.Spec.RenewTime)
+	if err != nil {
+		return true
+	}
+	duration := time.Duration(l.Spec.LeaseDurationSeconds) * time.Second
+	return !now.Before(renew.Add(duration))
+}
+
+// FormatTime formats a time like the times of the leases
+func FormatTime(t time.Time) string {
+	return t.UTC().Format(microTime)
+}
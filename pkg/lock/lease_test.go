@@ -0,0 +1,43 @@
+package lock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLease(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 123456000, time.UTC)
+	info := &Info{ID: "abc-42", User: "alice", Hostname: "laptop", Command: "cfctl apply"}
+
+	lease, err := NewLease(info, now)
+	require.NoError(t, err)
+	require.Equal(t, "abc-42", lease.Spec.HolderIdentity)
+	require.Equal(t, 30, lease.Spec.LeaseDurationSeconds)
+	require.Equal(t, "2024-01-02T03:04:05.123456Z", lease.Spec.RenewTime)
+
+	manifest, err := lease.Manifest()
+	require.NoError(t, err)
+	parsed, err := ParseLease([]byte(manifest))
+	require.NoError(t, err)
+	require.Equal(t, lease, parsed)
+	require.Equal(t, info, parsed.Holder())
+
+	require.False(t, parsed.Expired(now.Add(29*time.Second)))
+	require.True(t, parsed.Expired(now.Add(30*time.Second)))
+
+	t.Run("foreign holder", func(t *testing.T) {
+		lease := &Lease{Spec: LeaseSpec{HolderIdentity: "other", RenewTime: FormatTime(now), LeaseDurationSeconds: 15}}
+		require.Equal(t, &Info{ID: "other"}, lease.Holder())
+		require.False(t, lease.Expired(now))
+		require.True(t, lease.Expired(now.Add(15*time.Second)))
+	})
+
+	t.Run("released", func(t *testing.T) {
+		require.True(t, (&Lease{}).Expired(now))
+	})
+
+	_, err = ParseLease([]byte("{"))
+	require.Error(t, err)
+}
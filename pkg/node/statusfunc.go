@@ -62,7 +62,7 @@ func KubeNodeReadyFunc(h *cluster.Host) retryFunc {
 				h,
 				h.K0sDataDir(),
 				"get node -l kubernetes.io/hostname=%s -o json",
-				h.Metadata.Hostname,
+				h.NodeName(),
 			),
 			exec.HideOutput(),
 			exec.Sudo(h),
@@ -80,11 +80,11 @@ func KubeNodeReadyFunc(h *cluster.Host) retryFunc {
 					if c.Status == "True" {
 						return nil
 					}
-					return fmt.Errorf("node %s is not ready", h.Metadata.Hostname)
+					return fmt.Errorf("node %s is not ready", h.NodeName())
 				}
 			}
 		}
-		return fmt.Errorf("node %s 'Ready' condition not found", h.Metadata.Hostname)
+		return fmt.Errorf("node %s 'Ready' condition not found", h.NodeName())
 	}
 }
 
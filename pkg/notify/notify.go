@@ -0,0 +1,211 @@
+// Package notify sends the events of the cfctl operations to webhooks
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+)
+
+// Formats of the payloads
+const (
+	// FormatJSON sends the event as a JSON object
+	FormatJSON = "json"
+	// FormatSlack sends a message to a Slack incoming webhook
+	FormatSlack = "slack"
+	// FormatMattermost sends a message to a Mattermost incoming webhook
+	FormatMattermost = "mattermost"
+)
+
+// Statuses of the events
+const (
+	StatusStart   = "start"
+	StatusSuccess = "success"
+	StatusFailure = "failure"
+)
+
+// SignatureHeader is the header holding the HMAC signature of the payload
+const SignatureHeader = "X-Cfctl-Signature"
+
+// EventHeader is the header holding the name of the event
+const EventHeader = "X-Cfctl-Event"
+
+// DefaultTimeout is the timeout of the requests when the webhook has none
+const DefaultTimeout = 10 * time.Second
+
+// Event is an event of a cfctl operation
+type Event struct {
+	// Action is the operation such as "apply"
+	Action string `json:"action"`
+	// Status is "start", "success" or "failure"
+	Status    string    `json:"status"`
+	Cluster   string    `json:"cluster,omitempty"`
+	ClusterID string    `json:"clusterID,omitempty"`
+	Operator  string    `json:"operator,omitempty"`
+	Version   string    `json:"version,omitempty"`
+	Time      time.Time `json:"time"`
+	// Duration is the duration of the operation, in seconds
+	Duration float64 `json:"duration,omitempty"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// Name returns the name of the event such as "apply-start"
+func (e *Event) Name() string {
+	return e.Action + "-" + e.Status
+}
+
+// Text describes the event for the chat messages
+func (e *Event) Text() string {
+	var sb strings.Builder
+	sb.WriteString("cfctl " + e.Action)
+	switch e.Status {
+	case StatusStart:
+		sb.WriteString(" started")
+	case StatusSuccess:
+		sb.WriteString(" succeeded")
+	case StatusFailure:
+		sb.WriteString(" failed")
+	default:
+		sb.WriteString(" " + e.Status)
+	}
+	if e.Cluster != "" {
+		sb.WriteString(" on cluster " + e.Cluster)
+	}
+	if e.ClusterID != "" {
+		sb.WriteString(" (" + e.ClusterID + ")")
+	}
+	if e.Operator != "" {
+		sb.WriteString(" by " + e.Operator)
+	}
+	if e.Duration > 0 {
+		d := time.Duration(e.Duration * float64(time.Second)).Truncate(time.Second)
+		sb.WriteString(" after " + d.String())
+	}
+	if e.Error != "" {
+		sb.WriteString(": " + e.Error)
+	}
+	return sb.String()
+}
+
+// Operator returns the identity of the user running cfctl, such as "alice@laptop"
+func Operator() string {
+	var name, host string
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	if h, err := os.Hostname(); err == nil {
+		host = h
+	}
+	switch {
+	case name != "" && host != "":
+		return name + "@" + host
+	case name != "":
+		return name
+	default:
+		return host
+	}
+}
+
+// Webhook is an HTTP endpoint receiving the events
+type Webhook struct {
+	URL string
+	// Format is "json", "slack" or "mattermost", "json" by default
+	Format string
+	// Secret signs the payloads with HMAC-SHA256 when set
+	Secret string
+	// Headers are added to the requests
+	Headers map[string]string
+	// Timeout of the requests, DefaultTimeout when 0
+	Timeout time.Duration
+}
+
+// Payload returns the body of the request sent for an event
+func (w *Webhook) Payload(e *Event) ([]byte, error) {
+	switch w.Format {
+	case FormatSlack, FormatMattermost:
+		return json.Marshal(map[string]string{"text": e.Text()})
+	case FormatJSON, "":
+		return json.Marshal(e)
+	default:
+		return nil, fmt.Errorf("unknown webhook format %q", w.Format)
+	}
+}
+
+// Sign returns the signature of a payload, such as "sha256=<hex>"
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Send posts an event to the webhook
+func (w *Webhook) Send(ctx context.Context, e *Event) error {
+	payload, err := w.Payload(e)
+	if err != nil {
+		return err
+	}
+
+	timeout := w.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("invalid webhook url for %s: %w", Endpoint(w.URL), unwrapURLError(err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, e.Name())
+	for k, v := range w.Headers {
+		req.Header.Set(k, v)
+	}
+	if w.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(w.Secret, payload))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send %s to %s: %w", e.Name(), Endpoint(w.URL), unwrapURLError(err))
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("failed to send %s to %s: http %d", e.Name(), Endpoint(w.URL), resp.StatusCode)
+	}
+	return nil
+}
+
+// Endpoint returns the scheme and the host of a webhook URL for the logs. The
+// path and the query are left out, they hold the credentials of the Slack and
+// Mattermost webhooks.
+func Endpoint(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "<invalid url>"
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// unwrapURLError drops the *url.Error around an error, its message holds the
+// whole URL
+func unwrapURLError(err error) error {
+	var uerr *url.Error
+	if errors.As(err, &uerr) {
+		return uerr.Err
+	}
+	return err
+}
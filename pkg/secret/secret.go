@@ -0,0 +1,50 @@
+// Package secret resolves the secrets given as references to environment
+// variables or files
+package secret
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Resolve resolves a secret reference. "env:NAME" reads the environment
+// variable NAME, "file:PATH" reads the first line of the file at PATH and
+// "literal:VALUE" returns VALUE, for values starting with one of the prefixes.
+// Anything else is returned as is.
+func Resolve(ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, "env:"):
+		name := strings.TrimPrefix(ref, "env:")
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return v, nil
+	case strings.HasPrefix(ref, "file:"):
+		return ReadFile(strings.TrimPrefix(ref, "file:"))
+	case strings.HasPrefix(ref, "literal:"):
+		return strings.TrimPrefix(ref, "literal:"), nil
+	default:
+		return ref, nil
+	}
+}
+
+// ReadFile reads a secret from the first line of a file
+func ReadFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("read secret: %w", err)
+	}
+	defer f.Close()
+
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("read secret: %w", err)
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
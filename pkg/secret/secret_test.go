@@ -0,0 +1,33 @@
+package secret
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolve(t *testing.T) {
+	t.Setenv("CFCTL_TEST_SECRET", "from-env")
+	v, err := Resolve("env:CFCTL_TEST_SECRET")
+	require.NoError(t, err)
+	require.Equal(t, "from-env", v)
+
+	_, err = Resolve("env:CFCTL_TEST_SECRET_UNSET")
+	require.Error(t, err)
+
+	path := filepath.Join(t.TempDir(), "secret")
+	require.NoError(t, os.WriteFile(path, []byte("from-file\nignored\n"), 0600))
+	v, err = Resolve("file:" + path)
+	require.NoError(t, err)
+	require.Equal(t, "from-file", v)
+
+	v, err = Resolve("literal")
+	require.NoError(t, err)
+	require.Equal(t, "literal", v)
+
+	v, err = Resolve("literal:env:not-a-reference")
+	require.NoError(t, err)
+	require.Equal(t, "env:not-a-reference", v)
+}